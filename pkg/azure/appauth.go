@@ -0,0 +1,59 @@
+package azure
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// =============================================================================
+// Autenticación de la Aplicación Cliente (appidacr / azpacr)
+// =============================================================================
+
+// ErrInsufficientAppAuth indica que la aplicación cliente se autenticó con un método más débil
+// que el exigido con WithMinAppAuthLevel.
+var ErrInsufficientAppAuth = errors.New("client application authentication level is insufficient")
+
+// Niveles de autenticación de la aplicación cliente, según los claims `appidacr` (v1.0) y
+// `azpacr` (v2.0).
+const (
+	// AppAuthPublicClient indica un cliente público, sin credenciales.
+	AppAuthPublicClient = 0
+	// AppAuthSecret indica un cliente autenticado con un secreto compartido.
+	AppAuthSecret = 1
+	// AppAuthCertificate indica un cliente autenticado con un certificado.
+	AppAuthCertificate = 2
+)
+
+// WithMinAppAuthLevel exige que los tokens de aplicación (TokenTypeApplication) procedan de un
+// cliente autenticado al menos con el nivel indicado, p. ej. AppAuthCertificate para rechazar las
+// aplicaciones que usan un secreto. Los tokens delegados no se ven afectados.
+func WithMinAppAuthLevel(level int) Option {
+	return func(v *Validator) {
+		v.minAppAuthLevel = level
+	}
+}
+
+// appAuthLevel devuelve el nivel de autenticación del cliente: `azpacr` en tokens v2.0 y
+// `appidacr` en tokens v1.0, o "" si el token no lo incluye.
+func appAuthLevel(mapClaims jwt.MapClaims) string {
+	if azpacr, ok := mapClaims["azpacr"].(string); ok && azpacr != "" {
+		return azpacr
+	}
+
+	appidacr, _ := mapClaims["appidacr"].(string)
+	return appidacr
+}
+
+// checkAppAuthLevel aplica WithMinAppAuthLevel a los claims construidos.
+func (v *Validator) checkAppAuthLevel(claims *UserClaims) error {
+	if v.minAppAuthLevel <= AppAuthPublicClient || claims.TokenType != TokenTypeApplication {
+		return nil
+	}
+
+	if level, err := strconv.Atoi(claims.AppIDACR); err != nil || level < v.minAppAuthLevel {
+		return newValidationError(ErrInsufficientAppAuth, "appidacr", strconv.Itoa(v.minAppAuthLevel), claims.AppIDACR)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestWithMinAppAuthLevel(t *testing.T) {
+	v, keySet := newTestValidator(t, WithMinAppAuthLevel(AppAuthCertificate))
+	appToken := withClaim("idtyp", "app")
+
+	tests := []struct {
+		name         string
+		mutate       []func(jwt.MapClaims)
+		wantAppIDACR string
+		wantErr      error
+	}{
+		{name: "appidacr=2", mutate: []func(jwt.MapClaims){appToken, v1Token, withClaim("appidacr", "2")}, wantAppIDACR: "2"},
+		{name: "appidacr=1", mutate: []func(jwt.MapClaims){appToken, v1Token, withClaim("appidacr", "1")}, wantErr: ErrInsufficientAppAuth},
+		{name: "azpacr=2", mutate: []func(jwt.MapClaims){appToken, withClaim("azpacr", "2")}, wantAppIDACR: "2"},
+		{name: "azpacr=1", mutate: []func(jwt.MapClaims){appToken, withClaim("azpacr", "1")}, wantErr: ErrInsufficientAppAuth},
+		{name: "missing level", mutate: []func(jwt.MapClaims){appToken}, wantErr: ErrInsufficientAppAuth},
+		// Los tokens delegados no se ven afectados.
+		{name: "delegated with secret", mutate: []func(jwt.MapClaims){withClaim("idtyp", "user"), withClaim("azpacr", "1")}, wantAppIDACR: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.AppIDACR != tt.wantAppIDACR {
+				t.Fatalf("AppIDACR = %q, want %q", claims.AppIDACR, tt.wantAppIDACR)
+			}
+		})
+	}
+
+	// Sin la opción se aceptan los clientes autenticados con secreto.
+	v, keySet = newTestValidator(t)
+	if _, err := v.Validate(context.Background(), testToken(keySet, appToken, withClaim("azpacr", "1"))); err != nil {
+		t.Fatalf("without WithMinAppAuthLevel: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// Diagnóstico de Audiencias
+// =============================================================================
+
+// CheckAudience comprueba, sin verificar la firma, si la audiencia de un token de ejemplo
+// coincide con la audiencia configurada. Pensado para el arranque o las herramientas de
+// diagnóstico, donde permite detectar una audiencia mal configurada antes de recibir tráfico;
+// nunca debe usarse para autorizar peticiones. Aplica la misma equivalencia entre `{guid}` y
+// `api://{guid}` que la validación.
+func CheckAudience(tokenString, audience string) error {
+	mapClaims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, mapClaims); err != nil {
+		return fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+	}
+
+	tokenAudiences, err := tokenAudience(mapClaims)
+	if err != nil {
+		return err
+	}
+	if !audiencesIntersect([]string{audience}, tokenAudiences) {
+		return newValidationError(ErrInvalidAudience, "aud", audience, tokenAudiences)
+	}
+	return nil
+}
+
+// tokenAudience devuelve el claim `aud` normalizado a una lista: Azure lo emite como cadena en los
+// tokens v1.0 y puede emitirlo como array en los v2.0, y ambas formas se comparan igual. Un `aud`
+// que no es cadena ni array de cadenas devuelve ErrTokenParsingFailed; solo se comprueba cuando la
+// validación de audiencia está activa.
+func tokenAudience(mapClaims jwt.MapClaims) (jwt.ClaimStrings, error) {
+	// GetAudience ignora los valores que no son cadena ni array (p. ej. un número) y devuelve
+	// una lista vacía sin error.
+	switch aud := mapClaims["aud"].(type) {
+	case nil, string, []string, []any:
+	default:
+		return nil, fmt.Errorf("%w: aud has invalid type %T", ErrTokenParsingFailed, aud)
+	}
+
+	audience, err := mapClaims.GetAudience()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+	}
+	return audience, nil
+}
+
+// checkAudienceConfig detecta audiencias (las indicadas y las de WithIssuerAudiences) que por
+// error contienen la URL de los JWKS, el emisor o el ID del inquilino en lugar del App ID o el
+// App ID URI de la API, y avisa de las que tienen espacios sobrantes, que nunca coincidirían con
+// el claim `aud`.
+func (v *Validator) checkAudienceConfig(audiences []string, ep endpoints) error {
+	for _, issuerAudiences := range v.issuerAudiences {
+		audiences = append(audiences[:len(audiences):len(audiences)], issuerAudiences...)
+	}
+
+	for _, audience := range audiences {
+		if audience == "" {
+			continue
+		}
+		if strings.TrimSpace(audience) != audience {
+			v.logger.Warn("Audience has leading or trailing whitespace and will never match", zap.String("audience", audience))
+		}
+
+		for _, url := range append([]string{ep.jwksV1URL, ep.jwksV2URL}, ep.issuers...) {
+			switch {
+			case url == "":
+			case audience == url:
+				return fmt.Errorf("la audiencia %q es la URL de los JWKS o del emisor; use el App ID (client ID) o el App ID URI de la API", audience)
+			case isGUID(audience) && strings.Contains(url, audience):
+				return fmt.Errorf("la audiencia %q parece ser el ID del inquilino; use el App ID (client ID) o el App ID URI de la API", audience)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTokenAudience(t *testing.T) {
+	tests := []struct {
+		name    string
+		aud     any
+		want    jwt.ClaimStrings
+		wantErr bool
+	}{
+		{name: "v1 string", aud: "api://a", want: jwt.ClaimStrings{"api://a"}},
+		{name: "v2 single-element array", aud: []any{"api://a"}, want: jwt.ClaimStrings{"api://a"}},
+		{name: "array", aud: []any{"api://a", "api://b"}, want: jwt.ClaimStrings{"api://a", "api://b"}},
+		{name: "missing", aud: nil, want: nil},
+		{name: "number", aud: 123.0, wantErr: true},
+		{name: "array with number", aud: []any{"api://a", 1.0}, wantErr: true},
+		{name: "object", aud: map[string]any{"aud": "api://a"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{}
+			if tt.aud != nil {
+				claims["aud"] = tt.aud
+			}
+
+			got, err := tokenAudience(claims)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTokenParsingFailed) {
+					t.Fatalf("got %v, want ErrTokenParsingFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudiencesIntersect(t *testing.T) {
+	const appID, otherAppID = "3fa85f64-5717-4562-b3fc-2c963f66afa6", "9b2c7e1d-4f3a-4c5b-8d6e-0a1b2c3d4e5f"
+	tests := []struct {
+		name  string
+		valid []string
+		aud   jwt.ClaimStrings
+		want  bool
+	}{
+		{name: "string match", valid: []string{"api://a"}, aud: jwt.ClaimStrings{"api://a"}, want: true},
+		{name: "array match", valid: []string{"api://a"}, aud: jwt.ClaimStrings{"api://b", "api://a"}, want: true},
+		{name: "no match", valid: []string{"api://a"}, aud: jwt.ClaimStrings{"api://b"}, want: false},
+		{name: "app ID URI of GUID", valid: []string{appID}, aud: jwt.ClaimStrings{"api://" + appID}, want: true},
+		{name: "GUID of app ID URI", valid: []string{"api://" + appID}, aud: jwt.ClaimStrings{appID}, want: true},
+		{name: "app ID URI of another GUID", valid: []string{appID}, aud: jwt.ClaimStrings{"api://" + otherAppID}, want: false},
+		{name: "GUID of another app ID URI", valid: []string{"api://" + appID}, aud: jwt.ClaimStrings{otherAppID}, want: false},
+		{name: "app ID URI with a path", valid: []string{appID}, aud: jwt.ClaimStrings{"api://" + appID + "/orders"}, want: false},
+		{name: "non-GUID app ID URI", valid: []string{"orders"}, aud: jwt.ClaimStrings{"api://orders"}, want: false},
+		{name: "empty audience never matches", valid: []string{""}, aud: jwt.ClaimStrings{""}, want: false},
+		{name: "no token audiences", valid: []string{"api://a"}, aud: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := audiencesIntersect(tt.valid, tt.aud); got != tt.want {
+				t.Fatalf("audiencesIntersect(%v, %v) = %v, want %v", tt.valid, tt.aud, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAudienceShapes(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	tests := []struct {
+		name    string
+		aud     any
+		wantErr error
+	}{
+		{name: "string", aud: testAudience},
+		{name: "array", aud: []string{"api://other", testAudience}},
+		{name: "array without audience", aud: []string{"api://other"}, wantErr: ErrInvalidAudience},
+		{name: "empty string", aud: "", wantErr: ErrInvalidAudience},
+		{name: "number", aud: 123, wantErr: ErrTokenParsingFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := testToken(keySet, withClaim("aud", tt.aud))
+			_, err := v.Validate(context.Background(), token)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInvalidAudienceTypeIgnoredWithoutAudienceCheck(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	token := testToken(keySet, withClaim("aud", 123))
+
+	if w := serve(v.MiddlewareWithoutAudience(okHandler), token); w.Code != http.StatusOK {
+		t.Errorf("MiddlewareWithoutAudience: status %d, want 200", w.Code)
+	}
+	if w := serve(v.Protect(ProtectOptions{SkipAudience: true})(okHandler), token); w.Code != http.StatusOK {
+		t.Errorf("Protect with SkipAudience: status %d, want 200", w.Code)
+	}
+
+	lenient, lenientKeys := newTestValidator(t, WithoutAudienceValidation())
+	if _, err := lenient.Validate(context.Background(), testToken(lenientKeys, withClaim("aud", 123))); err != nil {
+		t.Errorf("WithoutAudienceValidation: %v", err)
+	}
+}
+
+func TestCheckAudience(t *testing.T) {
+	_, keySet := newTestValidator(t)
+
+	if err := CheckAudience(testToken(keySet), testAudience); err != nil {
+		t.Errorf("matching audience: %v", err)
+	}
+	if err := CheckAudience(testToken(keySet, withClaim("aud", []string{testAudience})), testAudience); err != nil {
+		t.Errorf("matching audience array: %v", err)
+	}
+	if err := CheckAudience(testToken(keySet), "api://other"); !errors.Is(err, ErrInvalidAudience) {
+		t.Errorf("other audience: got %v, want ErrInvalidAudience", err)
+	}
+	if err := CheckAudience(testToken(keySet, withClaim("aud", 123)), testAudience); !errors.Is(err, ErrTokenParsingFailed) {
+		t.Errorf("invalid aud type: got %v, want ErrTokenParsingFailed", err)
+	}
+}
+
+func TestValidateForAudience(t *testing.T) {
+	const apiA, apiB = "api://orders", "api://billing"
+	v, keySet := newTestValidator(t)
+	tokenForA := testToken(keySet, withClaim("aud", apiA))
+
+	if _, err := v.ValidateForAudience(context.Background(), tokenForA, apiA); err != nil {
+		t.Fatalf("token for API-A validated for API-A: %v", err)
+	}
+	if _, err := v.ValidateForAudience(context.Background(), tokenForA, apiB); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("token for API-A validated for API-B: got %v, want ErrInvalidAudience", err)
+	}
+	if _, err := v.ValidateForAudience(context.Background(), tokenForA, apiB, apiA); err != nil {
+		t.Fatalf("token for API-A validated for API-B or API-A: %v", err)
+	}
+
+	// La audiencia por llamada no modifica la configurada.
+	if _, err := v.Validate(context.Background(), tokenForA); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("Validate of a token for API-A: got %v, want ErrInvalidAudience", err)
+	}
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate with the configured audience: %v", err)
+	}
+}
+
+func TestValidateAudienceGUIDEquivalence(t *testing.T) {
+	const appID = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	tests := []struct {
+		name     string
+		audience string
+		aud      string
+		wantErr  bool
+	}{
+		{name: "GUID config, URI token", audience: appID, aud: "api://" + appID},
+		{name: "URI config, GUID token", audience: "api://" + appID, aud: appID},
+		{name: "GUID config, other URI token", audience: appID, aud: "api://9b2c7e1d-4f3a-4c5b-8d6e-0a1b2c3d4e5f", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, WithAudiences(tt.audience))
+			_, err := v.Validate(context.Background(), testToken(keySet, withClaim("aud", tt.aud)))
+			if tt.wantErr != errors.Is(err, ErrInvalidAudience) {
+				t.Fatalf("got %v, want invalid audience: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithAudienceValidationFunc(t *testing.T) {
+	pattern := regexp.MustCompile(`^api://orders-[a-z]+$`)
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	// Sin WithAudiences: la función es la única regla de audiencia.
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudienceValidationFunc(func(aud jwt.ClaimStrings) bool {
+			return slices.ContainsFunc(aud, pattern.MatchString)
+		}),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	tests := []struct {
+		aud     any
+		wantErr bool
+	}{
+		{aud: "api://orders-eu"},
+		{aud: []string{"api://other", "api://orders-us"}},
+		{aud: "api://orders-EU", wantErr: true},
+		{aud: testAudience, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := v.Validate(context.Background(), testToken(keySet, withClaim("aud", tt.aud)))
+		if tt.wantErr != errors.Is(err, ErrInvalidAudience) {
+			t.Errorf("aud %v: got %v, want invalid audience: %t", tt.aud, err, tt.wantErr)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("aud %v: %v", tt.aud, err)
+		}
+	}
+}
+
+func TestWithIssuerAudiences(t *testing.T) {
+	const (
+		issuerA    = "https://issuer-a.example"
+		issuerB    = "https://issuer-b.example"
+		issuerC    = "https://issuer-c.example"
+		partnerAPI = "api://partner"
+	)
+	v, keySet := newTestValidator(t,
+		WithIssuers(issuerA, issuerB, issuerC),
+		WithAudiences(partnerAPI),
+		WithIssuerAudiences(map[string][]string{
+			issuerA: {testAudience},
+			issuerB: {partnerAPI},
+		}),
+	)
+
+	tests := []struct {
+		name     string
+		issuer   string
+		audience string
+		wantErr  error
+	}{
+		{name: "issuer A with its audience", issuer: issuerA, audience: testAudience},
+		{name: "issuer A with issuer B audience", issuer: issuerA, audience: partnerAPI, wantErr: ErrInvalidAudience},
+		{name: "issuer B with its audience", issuer: issuerB, audience: partnerAPI},
+		{name: "issuer B with issuer A audience", issuer: issuerB, audience: testAudience, wantErr: ErrInvalidAudience},
+		// Los emisores fuera del mapa usan la lista global.
+		{name: "unmapped issuer", issuer: issuerC, audience: partnerAPI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := testToken(keySet, withClaim("iss", tt.issuer), withClaim("aud", tt.audience))
+			if _, err := v.Validate(context.Background(), token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithStrictAudience(t *testing.T) {
+	v, keySet := newTestValidator(t, WithStrictAudience())
+
+	tests := []struct {
+		name    string
+		aud     any
+		wantErr error
+	}{
+		{name: "exact match", aud: testAudience},
+		{name: "exact match in array", aud: []string{testAudience}},
+		{name: "superset", aud: []string{testAudience, "api://other"}, wantErr: ErrInvalidAudience},
+		{name: "subset", aud: []string{}, wantErr: ErrInvalidAudience},
+		{name: "other audience", aud: "api://other", wantErr: ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("aud", tt.aud))); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Con varias audiencias configuradas no hay un único valor exacto que exigir.
+	if _, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience, "api://other"),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+		WithStrictAudience(),
+	); err == nil {
+		t.Fatal("NewValidator with two audiences and WithStrictAudience: expected an error")
+	}
+}
+
+func TestAudienceMisconfiguration(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	for _, audience := range []string{
+		"https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys",
+		"https://login.microsoftonline.com/" + testTenantID + "/v2.0",
+		testTenantID,
+	} {
+		if _, err := NewValidator(context.Background(), testTenantID,
+			WithAudiences(audience),
+			WithHTTPClient(keySet.HTTPClient()),
+			WithNoOpLogger(),
+		); err == nil || !strings.Contains(err.Error(), audience) {
+			t.Errorf("audience %q: got %v, want an error naming it", audience, err)
+		}
+	}
+
+	// Los espacios sobrantes no impiden arrancar, pero se avisa en el log.
+	core, logs := observer.New(zapcore.WarnLevel)
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience+" "),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithLogger(zap.New(core)),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	warnings := logs.FilterMessage("Audience has leading or trailing whitespace and will never match").All()
+	if len(warnings) != 1 || warnings[0].ContextMap()["audience"] != testAudience+" " {
+		t.Fatalf("warnings = %v, want one naming the audience", warnings)
+	}
+}
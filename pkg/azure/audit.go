@@ -0,0 +1,54 @@
+package azure
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// Auditoría de Denegaciones
+// =============================================================================
+
+// auditMessage es el mensaje común de todas las entradas de auditoría, para poder filtrarlas.
+const auditMessage = "Authorization denied"
+
+// WithAuditLogger registra las denegaciones de acceso (tokens rechazados por Middleware y
+// peticiones rechazadas por los middlewares Require* y Protect) en un logger propio, p. ej. uno
+// dirigido al sistema de auditoría. Por defecto se usa el logger general (WithLogger).
+func WithAuditLogger(logger *zap.Logger) Option {
+	return func(v *Validator) {
+		v.auditLogger = logger
+	}
+}
+
+// auditDenial registra a nivel Warn una denegación de acceso con el mismo mensaje y campos
+// comunes: resultado (código HTTP), motivo, método, ruta, origen y, si el token era válido,
+// su sujeto y oid. fields añade los detalles de la comprobación fallida.
+func (v *Validator) auditDenial(r *http.Request, status int, reason error, claims *UserClaims, fields ...zap.Field) {
+	entry := make([]zap.Field, 0, 8+len(fields))
+	entry = append(entry,
+		zap.Int("status", status),
+		zap.Error(reason),
+		zap.String("method", r.Method),
+		zap.String("path", requestPath(r)),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+	if claims != nil {
+		entry = append(entry,
+			zap.String("subject", claims.Subject),
+			zap.String("oid", claims.ObjectID),
+			zap.String("tenant_id", claims.TenantID),
+		)
+	}
+
+	v.auditLogger.Warn(auditMessage, append(entry, fields...)...)
+}
+
+// requestPath devuelve la ruta de la petición, sin la query para no registrar tokens u otros datos.
+func requestPath(r *http.Request) string {
+	if r.URL == nil {
+		return ""
+	}
+	return r.URL.Path
+}
@@ -0,0 +1,85 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// auditedRequest sirve una petición a /orders?page=2 con el token indicado.
+func auditedRequest(handler http.Handler, token string) int {
+	r := httptest.NewRequest(http.MethodPost, "/orders?page=2", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec.Code
+}
+
+func TestWithAuditLogger(t *testing.T) {
+	core, audit := observer.New(zapcore.DebugLevel)
+	v, keySet := newTestValidator(t, WithAuditLogger(zap.New(core)))
+
+	token := testToken(keySet, withClaim("scp", "orders.read"), withClaim("oid", "00000000-0000-0000-0000-0000000000a1"))
+	if got := auditedRequest(chain(v, v.RequireScopes("orders.write")), token); got != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", got, http.StatusForbidden)
+	}
+
+	entries := audit.All()
+	if len(entries) != 1 {
+		t.Fatalf("audit entries = %v, want one", entries)
+	}
+	if entries[0].Message != auditMessage || entries[0].Level != zapcore.WarnLevel {
+		t.Fatalf("audit entry = %q at %s, want %q at warn", entries[0].Message, entries[0].Level, auditMessage)
+	}
+
+	fields := entries[0].ContextMap()
+	want := map[string]any{
+		"status":    int64(http.StatusForbidden),
+		"error":     ErrInsufficientScopes.Error(),
+		"method":    http.MethodPost,
+		"path":      "/orders",
+		"subject":   "jwtazuretest-subject",
+		"oid":       "00000000-0000-0000-0000-0000000000a1",
+		"tenant_id": testTenantID,
+		"scopes":    "orders.read",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v, want %v", key, fields[key], value)
+		}
+	}
+	if required, _ := fields["required_scopes"].([]any); len(required) != 1 || required[0] != "orders.write" {
+		t.Errorf("required_scopes = %v, want [orders.write]", fields["required_scopes"])
+	}
+}
+
+func TestWithAuditLoggerMiddlewareRejection(t *testing.T) {
+	core, audit := observer.New(zapcore.DebugLevel)
+	v, keySet := newTestValidator(t, WithAuditLogger(zap.New(core)))
+
+	if got := auditedRequest(v.Middleware(okHandler), testToken(keySet, withClaim("aud", "api://other"))); got != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := auditedRequest(v.Middleware(okHandler), testToken(keySet)); got != http.StatusOK {
+		t.Fatalf("valid token: status = %d, want %d", got, http.StatusOK)
+	}
+
+	// Solo se audita la denegación, sin datos del sujeto de un token no válido.
+	entries := audit.FilterMessage(auditMessage).All()
+	if len(entries) != 1 {
+		t.Fatalf("audit entries = %v, want one", entries)
+	}
+	fields := entries[0].ContextMap()
+	if fields["status"] != int64(http.StatusUnauthorized) || fields["path"] != "/orders" {
+		t.Fatalf("fields = %v, want status 401 and path /orders", fields)
+	}
+	if _, ok := fields["subject"]; ok {
+		t.Fatalf("fields = %v, want no subject for a rejected token", fields)
+	}
+}
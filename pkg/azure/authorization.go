@@ -0,0 +1,261 @@
+package azure
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/norlis/httpgate/pkg/kit/problem"
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// Middlewares de Autorización
+// =============================================================================
+
+// ProtectOptions describe los requisitos que Protect comprueba, además de validar el token.
+// Los campos vacíos no se comprueban.
+type ProtectOptions struct {
+	// Scopes son los scopes del claim `scp` exigidos (todos).
+	Scopes []string
+	// AllRoles son los roles del claim `roles` exigidos (todos).
+	AllRoles []string
+	// AnyRoles son los roles del claim `roles` de los que basta con uno.
+	AnyRoles []string
+	// Audiences reemplaza, para esta ruta, las audiencias configuradas en el validador.
+	Audiences []string
+	// SkipAudience desactiva, para esta ruta, la comprobación de audiencia (ignora Audiences).
+	SkipAudience bool
+}
+
+// Protect devuelve un middleware que valida el token y, en la misma pasada, comprueba los
+// scopes, roles y audiencias de opts. Equivale a encadenar Middleware con RequireScopes,
+// RequireAllRoles y RequireAnyRole, respondiendo 401 si el token no es válido y 403 si no
+// cumple los requisitos.
+func (v *Validator) Protect(opts ProtectOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, claims, ok := v.authenticate(w, r, opts.audienceCheck(v))
+			if !ok {
+				return
+			}
+
+			if len(opts.Scopes) > 0 && !v.checkScopes(w, r, claims, opts.Scopes) {
+				return
+			}
+			if len(opts.AllRoles) > 0 && !v.checkRoles(w, r, claims, opts.AllRoles, true) {
+				return
+			}
+			if len(opts.AnyRoles) > 0 && !v.checkRoles(w, r, claims, opts.AnyRoles, false) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// audienceCheck devuelve la comprobación de audiencia de Protect. Se calcula en cada petición
+// para respetar los cambios de SetAudiences cuando la ruta no fija sus propias audiencias.
+func (opts ProtectOptions) audienceCheck(v *Validator) audienceCheck {
+	switch {
+	case opts.SkipAudience:
+		return audienceCheck{}
+	case len(opts.Audiences) > 0:
+		return audienceCheck{enabled: true, audiences: opts.Audiences}
+	}
+	return v.defaultAudienceCheck()
+}
+
+// RequireAllRoles devuelve un middleware que exige que el token contenga todos los roles indicados.
+// Debe encadenarse después de Middleware, ya que lee los claims del contexto de la petición.
+func (v *Validator) RequireAllRoles(roles ...string) func(http.Handler) http.Handler {
+	return v.requireRoles(roles, true)
+}
+
+// RequireAnyRole devuelve un middleware que exige que el token contenga al menos uno de los roles indicados.
+// Debe encadenarse después de Middleware, ya que lee los claims del contexto de la petición.
+func (v *Validator) RequireAnyRole(roles ...string) func(http.Handler) http.Handler {
+	return v.requireRoles(roles, false)
+}
+
+// requireRoles implementa la comprobación de roles con semántica "todos" (all) o "alguno".
+func (v *Validator) requireRoles(required []string, all bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := v.claimsOrRespond(w, r)
+			if !ok {
+				return
+			}
+
+			if !v.checkRoles(w, r, claims, required, all) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScopes devuelve un middleware que exige que el claim `scp` del token contenga todos
+// los scopes indicados. Los tokens sin scopes (p. ej. tokens de aplicación) son rechazados.
+// Debe encadenarse después de Middleware, ya que lee los claims del contexto de la petición.
+func (v *Validator) RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := v.claimsOrRespond(w, r)
+			if !ok {
+				return
+			}
+
+			if !v.checkScopes(w, r, claims, scopes) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireMFA devuelve un middleware que exige que el usuario se haya autenticado con MFA,
+// según los claims `amr` y `acr` (ver UserClaims.HasMFA). Los valores de `acr` aceptados
+// pueden indicarse; por defecto se acepta "1".
+// Debe encadenarse después de Middleware, ya que lee los claims del contexto de la petición.
+func (v *Validator) RequireMFA(acrValues ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := v.claimsOrRespond(w, r)
+			if !ok {
+				return
+			}
+
+			if !claims.HasMFA(acrValues...) {
+				v.logger.Warn("Multi-factor authentication required",
+					zap.String("subject", claims.Subject),
+					zap.String("acr", claims.Acr),
+					zap.Strings("amr", claims.Amr),
+				)
+				v.auditDenial(r, http.StatusForbidden, ErrMFARequired, claims,
+					zap.String("acr", claims.Acr),
+					zap.Strings("amr", claims.Amr),
+				)
+				problem.RespondError(w,
+					problem.FromError(
+						ErrMFARequired,
+						http.StatusForbidden,
+						problem.WithInstance(r),
+						problem.WithType(v.problemType(ErrMFARequired)),
+					),
+				)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// claimsOrRespond lee los claims del contexto de la petición. Si no están (el middleware no se
+// encadenó después de Middleware), responde 401 y devuelve false.
+func (v *Validator) claimsOrRespond(w http.ResponseWriter, r *http.Request) (*UserClaims, bool) {
+	claims, ok := GetClaimsFromContext(r.Context())
+	if !ok {
+		problem.RespondError(w,
+			problem.FromError(
+				ErrClaimsNotFound,
+				http.StatusUnauthorized,
+				problem.WithInstance(r),
+				problem.WithType(v.problemType(ErrClaimsNotFound)),
+			),
+		)
+	}
+	return claims, ok
+}
+
+// checkRoles comprueba los roles del token con semántica "todos" (all) o "alguno". Si no se
+// cumplen, responde 403 y devuelve false.
+func (v *Validator) checkRoles(w http.ResponseWriter, r *http.Request, claims *UserClaims, required []string, all bool) bool {
+	if containsValues(claims.Roles, required, all) {
+		return true
+	}
+
+	v.logger.Warn("Insufficient roles",
+		zap.String("subject", claims.Subject),
+		zap.Strings("required_roles", required),
+		zap.Strings("roles", claims.Roles),
+	)
+	v.auditDenial(r, http.StatusForbidden, ErrInsufficientRoles, claims,
+		zap.Strings("required_roles", required),
+		zap.Strings("roles", claims.Roles),
+	)
+	// Con semántica "alguno" cualquiera de los roles requeridos bastaría, así que se indican todos.
+	missing := required
+	if all {
+		missing = missingValues(claims.Roles, required)
+	}
+	v.setChallenge(w, bearerErrorInsufficientScope, ErrInsufficientRoles, missing)
+	problem.RespondError(w,
+		problem.FromError(
+			ErrInsufficientRoles,
+			http.StatusForbidden,
+			problem.WithInstance(r),
+			problem.WithType(v.problemType(ErrInsufficientRoles)),
+		),
+	)
+	return false
+}
+
+// checkScopes comprueba que el token contenga todos los scopes indicados. Si no, responde 403
+// y devuelve false.
+func (v *Validator) checkScopes(w http.ResponseWriter, r *http.Request, claims *UserClaims, required []string) bool {
+	// Un token sin scopes (p. ej. de aplicación) nunca satisface la comprobación.
+	tokenScopes := claims.ScopeList()
+	if len(tokenScopes) > 0 && containsValues(tokenScopes, required, true) {
+		return true
+	}
+
+	v.logger.Warn("Insufficient scopes",
+		zap.String("subject", claims.Subject),
+		zap.Strings("required_scopes", required),
+		zap.String("scopes", claims.Scopes),
+	)
+	v.auditDenial(r, http.StatusForbidden, ErrInsufficientScopes, claims,
+		zap.Strings("required_scopes", required),
+		zap.String("scopes", claims.Scopes),
+	)
+	v.setChallenge(w, bearerErrorInsufficientScope, ErrInsufficientScopes, missingValues(tokenScopes, required))
+	problem.RespondError(w,
+		problem.FromError(
+			ErrInsufficientScopes,
+			http.StatusForbidden,
+			problem.WithInstance(r),
+			problem.WithType(v.problemType(ErrInsufficientScopes)),
+		),
+	)
+	return false
+}
+
+// missingValues devuelve los valores requeridos que no están entre los del token.
+func missingValues(tokenValues, required []string) []string {
+	var missing []string
+	for _, value := range required {
+		if !slices.Contains(tokenValues, value) {
+			missing = append(missing, value)
+		}
+	}
+	return missing
+}
+
+// containsValues verifica si los valores del token (roles o scopes) satisfacen los requeridos.
+// Con all=true deben estar todos; con all=false basta con uno.
+func containsValues(tokenValues, required []string, all bool) bool {
+	for _, value := range required {
+		found := slices.Contains(tokenValues, value)
+		if all && !found {
+			return false
+		}
+		if !all && found {
+			return true
+		}
+	}
+	return all
+}
@@ -0,0 +1,228 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// chain encadena Middleware con los middlewares de autorización indicados y okHandler.
+func chain(v *Validator, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	var handler http.Handler = okHandler
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return v.Middleware(handler)
+}
+
+func TestRequireRoles(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	token := testToken(keySet, withClaim("roles", []string{"reader"}))
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		want       int
+	}{
+		{name: "all roles missing one", middleware: v.RequireAllRoles("reader", "writer"), want: http.StatusForbidden},
+		{name: "all roles present", middleware: v.RequireAllRoles("reader"), want: http.StatusOK},
+		{name: "any role present", middleware: v.RequireAnyRole("reader", "writer"), want: http.StatusOK},
+		{name: "any role missing", middleware: v.RequireAnyRole("admin", "writer"), want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(chain(v, tt.middleware), token).Code; got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireRolesWithoutMiddleware(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	// Sin Middleware delante no hay claims en el contexto.
+	if got := serve(v.RequireAnyRole("reader")(okHandler), testToken(keySet)).Code; got != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	userToken := testToken(keySet, withClaim("scp", "read write"))
+	// Tokens de aplicación: sin `scp`.
+	appToken := testToken(keySet, withClaim("roles", []string{"reader"}))
+
+	tests := []struct {
+		name   string
+		token  string
+		scopes []string
+		want   int
+	}{
+		{name: "single scope", token: userToken, scopes: []string{"read"}, want: http.StatusOK},
+		{name: "multiple scopes", token: userToken, scopes: []string{"read", "write"}, want: http.StatusOK},
+		{name: "missing scope", token: userToken, scopes: []string{"read", "admin"}, want: http.StatusForbidden},
+		{name: "token without scopes", token: appToken, scopes: []string{"read"}, want: http.StatusForbidden},
+		{name: "token without scopes and no requirement", token: appToken, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(chain(v, v.RequireScopes(tt.scopes...)), tt.token).Code; got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireMFA(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	tests := []struct {
+		name      string
+		mutate    []func(jwt.MapClaims)
+		acrValues []string
+		want      int
+	}{
+		{name: "amr pwd", mutate: []func(jwt.MapClaims){withClaim("amr", []string{"pwd"})}, want: http.StatusForbidden},
+		{name: "amr mfa", mutate: []func(jwt.MapClaims){withClaim("amr", []string{"pwd", "mfa"})}, want: http.StatusOK},
+		{name: "no amr or acr", want: http.StatusForbidden},
+		{name: "default acr", mutate: []func(jwt.MapClaims){withClaim("acr", "1")}, want: http.StatusOK},
+		{name: "acr not accepted", mutate: []func(jwt.MapClaims){withClaim("acr", "1")}, acrValues: []string{"c2"}, want: http.StatusForbidden},
+		{name: "configured acr", mutate: []func(jwt.MapClaims){withClaim("acr", "c2")}, acrValues: []string{"c2"}, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(chain(v, v.RequireMFA(tt.acrValues...)), testToken(keySet, tt.mutate...)).Code; got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	claims, err := v.Validate(context.Background(), testToken(keySet, withClaim("acr", "1"), withClaim("amr", []string{"pwd", "mfa"})))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if claims.Acr != "1" || !slices.Equal(claims.Amr, []string{"pwd", "mfa"}) {
+		t.Fatalf("Acr = %q, Amr = %q; want the token claims", claims.Acr, claims.Amr)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	userToken := testToken(keySet, withClaim("scp", "orders.read"), withClaim("roles", []string{"reader"}))
+
+	tests := []struct {
+		name  string
+		opts  ProtectOptions
+		token string
+		want  int
+	}{
+		{name: "correct scope", opts: ProtectOptions{Scopes: []string{"orders.read"}}, token: userToken, want: http.StatusOK},
+		{name: "missing scope", opts: ProtectOptions{Scopes: []string{"orders.write"}}, token: userToken, want: http.StatusForbidden},
+		{name: "all roles", opts: ProtectOptions{AllRoles: []string{"reader"}}, token: userToken, want: http.StatusOK},
+		{name: "missing role", opts: ProtectOptions{AllRoles: []string{"reader", "writer"}}, token: userToken, want: http.StatusForbidden},
+		{name: "any role", opts: ProtectOptions{AnyRoles: []string{"writer", "reader"}}, token: userToken, want: http.StatusOK},
+		{name: "route audience", opts: ProtectOptions{Audiences: []string{"api://other"}}, token: userToken, want: http.StatusUnauthorized},
+		{name: "skip audience", opts: ProtectOptions{SkipAudience: true}, token: testToken(keySet, withClaim("aud", "api://other")), want: http.StatusOK},
+		{name: "invalid token", opts: ProtectOptions{Scopes: []string{"orders.read"}}, token: "not-a-jwt", want: http.StatusUnauthorized},
+		{name: "no token", opts: ProtectOptions{Scopes: []string{"orders.read"}}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(v.Protect(tt.opts)(okHandler), tt.token).Code; got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewContextWithClaims(t *testing.T) {
+	v, _ := newTestValidator(t)
+	claims := &UserClaims{Subject: "ada", Roles: []string{"reader"}, Scopes: "orders.read"}
+
+	ctx := NewContextWithClaims(context.Background(), claims)
+	if got, ok := GetClaimsFromContext(ctx); !ok || got != claims {
+		t.Fatalf("GetClaimsFromContext = %v, %t; want the injected claims", got, ok)
+	}
+
+	// Los middlewares Require* funcionan con claims inyectados, sin JWKS ni token firmado.
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		want       int
+	}{
+		{name: "role present", middleware: v.RequireAnyRole("reader"), want: http.StatusOK},
+		{name: "role missing", middleware: v.RequireAllRoles("writer"), want: http.StatusForbidden},
+		{name: "scope present", middleware: v.RequireScopes("orders.read"), want: http.StatusOK},
+		{name: "scope missing", middleware: v.RequireScopes("orders.write"), want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			tt.middleware(okHandler).ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithAuthorizer(t *testing.T) {
+	errAdminOnly := errors.New("admin routes require the admin role")
+	v, keySet := newTestValidator(t, WithAuthorizer(func(r *http.Request, claims *UserClaims) error {
+		if strings.HasPrefix(r.URL.Path, "/admin/") && !claims.HasRole("admin") {
+			return errAdminOnly
+		}
+		return nil
+	}))
+	admin := testToken(keySet, withClaim("roles", []string{"admin"}))
+	reader := testToken(keySet, withClaim("roles", []string{"reader"}))
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{name: "public route", path: "/orders", token: reader, want: http.StatusOK},
+		{name: "admin route as admin", path: "/admin/users", token: admin, want: http.StatusOK},
+		{name: "admin route as reader", path: "/admin/users", token: reader, want: http.StatusForbidden},
+		{name: "invalid token", path: "/orders", token: "not-a-jwt", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, handler := range map[string]http.Handler{
+				"Middleware":         v.Middleware(okHandler),
+				"OptionalMiddleware": v.OptionalMiddleware(okHandler),
+				"Protect":            v.Protect(ProtectOptions{})(okHandler),
+			} {
+				r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, r)
+				if rec.Code != tt.want {
+					t.Fatalf("%s: status = %d, want %d", name, rec.Code, tt.want)
+				}
+				if tt.want == http.StatusForbidden {
+					p := decodeProblem(t, rec.Body.Bytes())
+					if p.Type != "urn:jwtazure:access-denied" || !strings.Contains(p.Detail, errAdminOnly.Error()) {
+						t.Fatalf("%s: problem = %+v, want access-denied with the policy error", name, p)
+					}
+				}
+			}
+		})
+	}
+}
@@ -5,13 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/norlis/httpgate/pkg/kit/problem"
 
-	"github.com/MicahParks/keyfunc/v3"
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -20,8 +26,30 @@ var (
 	ErrInvalidAuthHeaderFormat = errors.New("authorization header format must be 'Bearer {token}'")
 	ErrTokenParsingFailed      = errors.New("failed to parse token")
 	ErrTokenInvalid            = errors.New("token is invalid (possibly expired or not yet active)")
+	ErrTokenExpired            = errors.New("token is expired")
+	ErrTokenNotYetValid        = errors.New("token is not valid yet")
 	ErrInvalidIssuer           = errors.New("invalid token issuer")
 	ErrInvalidAudience         = errors.New("invalid token audience")
+	ErrTenantNotAllowed        = errors.New("token tenant is not allowed")
+	ErrTenantMismatch          = errors.New("token issuer tenant does not match tid claim")
+	ErrMissingRequiredClaim    = errors.New("token is missing a required claim")
+	ErrInvalidClientApp        = errors.New("token client application is not allowed")
+	ErrUnsupportedTokenVersion = errors.New("unsupported token version")
+	ErrClaimsNotFound          = errors.New("user claims not found in request context")
+	ErrInsufficientRoles       = errors.New("token does not have the required roles")
+	ErrInsufficientScopes      = errors.New("token does not have the required scopes")
+	ErrMFARequired             = errors.New("multi-factor authentication is required")
+	ErrValidatorClosed         = errors.New("validator is closed")
+	ErrGroupResolutionFailed   = errors.New("failed to resolve group overage")
+	ErrKeySourceUnavailable    = errors.New("signing keys are unavailable")
+	ErrMissingKID              = errors.New("token header is missing the kid")
+	ErrInvalidNonce            = errors.New("invalid token nonce")
+	ErrTokenTooLarge           = errors.New("token exceeds the maximum allowed size")
+	ErrAccessDenied            = errors.New("access denied by authorization policy")
+	ErrClaimsRejected          = errors.New("token claims rejected by a claims validator")
+	ErrTokenNotInContext       = errors.New("token not found in context")
+	ErrOnBehalfOfUnsupported   = errors.New("on-behalf-of flow is not supported by this validator")
+	ErrOnBehalfOfFailed        = errors.New("on-behalf-of token exchange failed")
 )
 
 // =============================================================================
@@ -32,36 +60,242 @@ var (
 // sin exportar previene colisiones con otras claves de contexto en la aplicación.
 type userClaimsKey struct{}
 
+// rawTokenKey es la clave de contexto del token original, con el mismo criterio que userClaimsKey.
+type rawTokenKey struct{}
+
 // UserClaims contiene las notificaciones validadas del token para un uso seguro.
+// ObjectID (`oid`) es el identificador estable del usuario dentro del inquilino; Subject (`sub`)
+// es distinto para cada aplicación cliente, por lo que no sirve para correlacionar usuarios.
+// GroupsOverflowed indica que el usuario tiene más grupos de los que caben en el token
+// ("group overage"): Azure omite `groups` y remite a Microsoft Graph. Acr y Amr describen
+// cómo se autenticó el usuario y permiten exigir MFA con RequireMFA; AppIDACR (`appidacr` o
+// `azpacr`) indica cómo se autenticó la aplicación cliente ("0" pública, "1" secreto,
+// "2" certificado; ver WithMinAppAuthLevel). ExpiresAt e IssuedAt
+// proceden de `exp` e `iat` y quedan a cero si el token no los incluye. ClientCapabilities
+// procede de `xms_cc`, y CAEEnabled indica si el cliente admite los desafíos de claims de
+// Continuous Access Evaluation (capacidad "cp1"; ver RespondClaimsChallenge). Expired y ExpiredBy
+// indican que el token se aceptó caducado dentro del periodo de WithExpiryGrace, y por cuánto.
 type UserClaims struct {
-	Subject       string
-	Name          string
-	PreferredUser string
-	TenantID      string
-	Audience      jwt.ClaimStrings
-	Issuer        string
-	Scopes        string
-	Roles         []string
-	RawClaims     jwt.MapClaims
+	Subject            string
+	ObjectID           string
+	Name               string
+	PreferredUser      string
+	TenantID           string
+	Audience           jwt.ClaimStrings
+	Issuer             string
+	Scopes             string
+	Roles              []string
+	Groups             []string
+	GroupsOverflowed   bool
+	ClientAppID        string
+	AppIDACR           string
+	TokenType          TokenType
+	Acr                string
+	Amr                []string
+	ClientCapabilities []string
+	CAEEnabled         bool
+	Expired            bool
+	ExpiredBy          time.Duration
+	ExpiresAt          time.Time
+	IssuedAt           time.Time
+	RawClaims          jwt.MapClaims
+
+	// certThumbprint es el claim `cnf.x5t#S256`, leído de los claims del token para que la
+	// vinculación a certificado no dependa de WithClaimsBuilder ni de WithRawClaimsAllowlist.
+	certThumbprint string
 }
 
 // Validator encapsula la configuración y la lógica para validar tokens de Azure AD.
 type Validator struct {
-	jwksV1                 keyfunc.Keyfunc
-	jwksV2                 keyfunc.Keyfunc
-	validIssuers           []string
-	validAudiences         []string
-	isAudienceCheckEnabled bool
-	logger                 *zap.Logger
+	jwksV1                    *refreshableJWKS
+	jwksV2                    *refreshableJWKS
+	configMu                  sync.RWMutex
+	configGeneration          uint64
+	validIssuers              []string
+	defaultIssuers            []string
+	validAudiences            []string
+	allowedTenants            []string
+	verifyTenantID            bool
+	requiredClaims            []string
+	claimsValidators          []func(jwt.MapClaims) error
+	allowedClientApps         []string
+	minAppAuthLevel           int
+	certificateBinding        bool
+	requiredVersion           string
+	isAudienceCheckEnabled    bool
+	audienceValidationFunc    func(aud jwt.ClaimStrings) bool
+	issuerAudiences           map[string][]string
+	strictAudience            bool
+	clockSkew                 time.Duration
+	nbfLeeway                 time.Duration
+	expiryGrace               time.Duration
+	validMethods              []string
+	requireKID                bool
+	symmetricAlg              string
+	symmetricKey              []byte
+	httpClient                *http.Client
+	tokenURL                  string
+	authorizationURL          string
+	realm                     string
+	maxRetryAfter             time.Duration
+	lazyJWKS                  bool
+	refreshInterval           time.Duration
+	staticJWKS                []byte
+	jwksURLs                  *endpoints
+	discovery                 *discoverySource
+	unknownKIDRefreshInterval time.Duration
+	refreshErrorHandler       func(error)
+	disableV1                 bool
+	disableV2                 bool
+	cloud                     Cloud
+	tokenSources              []TokenSource
+	querySources              []TokenSource
+	maxTokenBytes             int
+	authScheme                authScheme
+	identityHeaders           IdentityHeaders
+	logClaims                 bool
+	detailedErrors            bool
+	problemTypeBase           string
+	metrics                   MetricsRecorder
+	groupResolver             GroupResolver
+	revocationChecker         RevocationChecker
+	claimsBuilder             func(jwt.MapClaims) *UserClaims
+	rawClaimsAllowlist        []string
+	permissionPolicy          PermissionPolicy
+	contextInjector           func(ctx context.Context, claims *UserClaims) context.Context
+	authorizer                func(r *http.Request, claims *UserClaims) error
+	resultCache               *lruCache[*UserClaims]
+	negativeCache             *lruCache[error]
+	negativeCacheTTL          time.Duration
+	tracer                    trace.Tracer
+	baggage                   bool
+	refreshStatus             *refreshStatus
+	cancel                    context.CancelFunc
+	closed                    atomic.Bool
+	logger                    *zap.Logger
+	auditLogger               *zap.Logger
+	name                      string
+}
+
+// defaultValidMethods son los algoritmos de firma aceptados por defecto: los RSA que usa Azure.
+var defaultValidMethods = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodPS256.Alg(),
 }
 
 // Option es una función que configura un Validator.
 type Option func(*Validator)
 
-// WithAudiences establece las audiencias válidas para el token.
+// GroupResolver obtiene los grupos de un usuario cuando el token señala "group overage",
+// normalmente consultando Microsoft Graph.
+type GroupResolver func(ctx context.Context, claims *UserClaims) ([]string, error)
+
+// WithAudiences añade audiencias válidas para el token. Es acumulativa: si se usa varias veces
+// (p. ej. al combinar opciones de distintas capas de configuración), se aceptan todas.
 func WithAudiences(audiences ...string) Option {
 	return func(v *Validator) {
-		v.validAudiences = audiences
+		v.validAudiences = append(v.validAudiences, audiences...)
+	}
+}
+
+// WithAudienceValidationFunc reemplaza la comparación con la lista de audiencias por una función
+// propia, para reglas que no pueden expresarse como una lista fija. Si se define, WithAudiences
+// deja de ser obligatorio. ValidateForAudience y Protect con audiencias explícitas siguen
+// comparando con la lista recibida.
+func WithAudienceValidationFunc(fn func(aud jwt.ClaimStrings) bool) Option {
+	return func(v *Validator) {
+		v.audienceValidationFunc = fn
+	}
+}
+
+// WithStrictAudience exige que el token tenga exactamente una audiencia y que sea idéntica a la
+// única audiencia configurada, sin alternativas ni la equivalencia entre App ID y `api://`.
+// Requiere que WithAudiences reciba un único valor (y cada entrada de WithIssuerAudiences también).
+func WithStrictAudience() Option {
+	return func(v *Validator) {
+		v.strictAudience = true
+	}
+}
+
+// WithIssuerAudiences limita las audiencias válidas según el emisor del token, para escenarios
+// federados con varios emisores: así un token del emisor A no se acepta con la audiencia del
+// emisor B. Los emisores que no están en el mapa usan la lista de WithAudiences.
+func WithIssuerAudiences(audiences map[string][]string) Option {
+	return func(v *Validator) {
+		v.issuerAudiences = audiences
+	}
+}
+
+// WithIssuers reemplaza la lista de emisores válidos que se genera a partir del tenantID.
+// Necesario para Azure AD B2C o nubes soberanas, donde el emisor sigue otro formato.
+// Igual que WithAudiences, es acumulativa: varias llamadas suman sus emisores.
+func WithIssuers(issuers ...string) Option {
+	return func(v *Validator) {
+		if v.validIssuers == nil {
+			v.validIssuers = []string{}
+		}
+		v.validIssuers = append(v.validIssuers, issuers...)
+	}
+}
+
+// WithAllowedTenants habilita el modo multi-inquilino: se aceptan tokens cuyo claim `tid` esté
+// en la lista y cuyo emisor corresponda a ese mismo inquilino, en lugar de la lista fija de emisores.
+// Suele combinarse con NewValidator usando "organizations" o "common" como tenantID.
+func WithAllowedTenants(tenantIDs ...string) Option {
+	return func(v *Validator) {
+		v.allowedTenants = tenantIDs
+	}
+}
+
+// WithTenantIDVerification exige que el GUID del inquilino incluido en el emisor coincida con
+// el claim `tid`, mitigando la reutilización de tokens emitidos para otro inquilino.
+func WithTenantIDVerification() Option {
+	return func(v *Validator) {
+		v.verifyTenantID = true
+	}
+}
+
+// WithRequiredClaims exige que los claims indicados (p. ej. `tid`, `oid`) estén presentes y no
+// vacíos en el token. Si falta alguno, la validación falla con ErrMissingRequiredClaim.
+func WithRequiredClaims(keys ...string) Option {
+	return func(v *Validator) {
+		v.requiredClaims = keys
+	}
+}
+
+// WithClaimsValidator registra una regla propia que se ejecuta tras las comprobaciones estándar
+// (emisor, audiencia, claims obligatorios). Si devuelve un error, la validación falla con
+// ErrClaimsRejected envolviendo ese error, de modo que errors.Is funciona con ambos.
+// Puede usarse varias veces; las reglas se ejecutan en orden.
+func WithClaimsValidator(fn func(claims jwt.MapClaims) error) Option {
+	return func(v *Validator) {
+		v.claimsValidators = append(v.claimsValidators, fn)
+	}
+}
+
+// WithAllowedClientApps restringe las aplicaciones cliente que pueden llamar a la API, comparando
+// el claim `azp` (v2.0) o `appid` (v1.0) con la lista. Si no coincide, la validación falla con
+// ErrInvalidClientApp.
+func WithAllowedClientApps(appIDs ...string) Option {
+	return func(v *Validator) {
+		v.allowedClientApps = appIDs
+	}
+}
+
+// WithRequiredTokenVersion exige que el claim `ver` del token coincida con la versión indicada
+// ("1.0" o "2.0"), rechazando el resto con ErrUnsupportedTokenVersion. Con "2.0" además no se
+// descarga el JWKS v1.0.
+func WithRequiredTokenVersion(ver string) Option {
+	return func(v *Validator) {
+		v.requiredVersion = ver
+	}
+}
+
+// WithCloud establece la nube de Azure (pública, US Gov, China) usada para construir las URLs
+// de los JWKS y los emisores. Por defecto es AzurePublic. No aplica a NewB2CValidator.
+func WithCloud(cloud Cloud) Option {
+	return func(v *Validator) {
+		v.cloud = cloud
 	}
 }
 
@@ -73,6 +307,239 @@ func WithoutAudienceValidation() Option {
 	}
 }
 
+// WithClockSkew establece la tolerancia aplicada al validar los claims `exp`, `nbf` e `iat`,
+// para absorber pequeñas diferencias de reloj con Azure. Por defecto es cero.
+func WithClockSkew(d time.Duration) Option {
+	return func(v *Validator) {
+		v.clockSkew = d
+	}
+}
+
+// WithLeewayForNbf establece una tolerancia para `nbf` distinta de la de `exp`, p. ej. para
+// aceptar tokens emitidos ligeramente en el futuro sin relajar la caducidad, que sigue usando
+// WithClockSkew. Si no se configura, ambos claims usan WithClockSkew.
+func WithLeewayForNbf(d time.Duration) Option {
+	return func(v *Validator) {
+		v.nbfLeeway = d
+	}
+}
+
+// WithExpiryGrace acepta los tokens que caducaron hace menos de d (además de WithClockSkew), pero
+// los marca con UserClaims.Expired y ExpiredBy para que los handlers decidan qué hacer. A diferencia
+// de la tolerancia de reloj, es una indulgencia deliberada y visible para el llamador, pensada para
+// migraciones en las que se quiere registrar y retirar gradualmente los tokens caducados.
+func WithExpiryGrace(d time.Duration) Option {
+	return func(v *Validator) {
+		v.expiryGrace = d
+	}
+}
+
+// WithAllowedAlgorithms reemplaza la lista de algoritmos de firma aceptados (por defecto, RS256
+// y PS256). Los algoritmos de curva elíptica como ES256 deben habilitarse explícitamente, p. ej.
+// WithAllowedAlgorithms("RS256", "PS256", "ES256"). El tipo de clave lo determina el JWKS, por lo
+// que un token solo se verifica si su algoritmo corresponde a la clave indicada en su `kid`.
+func WithAllowedAlgorithms(algs ...string) Option {
+	return func(v *Validator) {
+		v.validMethods = algs
+	}
+}
+
+// WithRequireKID rechaza con ErrMissingKID los tokens sin `kid` (cadena no vacía) en la cabecera,
+// antes de buscar la clave, para evitar una selección de clave ambigua.
+func WithRequireKID() Option {
+	return func(v *Validator) {
+		v.requireKID = true
+	}
+}
+
+// WithHTTPClient establece el cliente HTTP usado para descargar los JWKS de Azure.
+// Permite, por ejemplo, salir por un proxy corporativo o usar raíces TLS propias.
+// Si no se proporciona, se usa http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(v *Validator) {
+		v.httpClient = client
+	}
+}
+
+// WithJWKSURLs reemplaza las URLs de los JWKS v1.0 y v2.0 que se generan a partir de la nube y el
+// tenantID, para STS compatibles con Azure con hosts propios (nubes nacionales o de socios que no
+// están entre las Cloud predefinidas). Una URL vacía deshabilita ese endpoint. Suele combinarse
+// con WithIssuers, que reemplaza por completo los emisores.
+func WithJWKSURLs(v1, v2 string) Option {
+	return func(v *Validator) {
+		v.jwksURLs = &endpoints{jwksV1URL: v1, jwksV2URL: v2}
+	}
+}
+
+// WithStaticJWKS verifica las firmas con el JWK Set indicado (JSON) en lugar de descargarlo de
+// Azure, para entornos sin salida a Internet que sincronizan las claves por otra vía. Las claves
+// no se refrescan: ante una rotación hay que crear un nuevo validador. Combinado con WithIssuers,
+// permite validar sin ningún acceso a la red.
+func WithStaticJWKS(jwksJSON []byte) Option {
+	return func(v *Validator) {
+		v.staticJWKS = jwksJSON
+	}
+}
+
+// WithRefreshInterval establece cada cuánto se refrescan los JWKS en segundo plano.
+// Por defecto es una hora; conviene reducirlo en inquilinos con rotación de claves frecuente.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(v *Validator) {
+		v.refreshInterval = d
+	}
+}
+
+// WithUnknownKIDRefresh establece el intervalo mínimo entre los refrescos del JWKS provocados
+// por un token firmado con un `kid` desconocido, p. ej. justo después de una rotación de claves
+// de Azure (por defecto, 5 minutos). El token se verifica de nuevo tras el refresco; si el límite
+// no lo permite, se rechaza sin esperar. Un valor no positivo deshabilita estos refrescos.
+func WithUnknownKIDRefresh(minInterval time.Duration) Option {
+	return func(v *Validator) {
+		v.unknownKIDRefreshInterval = minInterval
+	}
+}
+
+// WithRefreshErrorHandler registra una función que se invoca cada vez que falla la descarga
+// de un JWKS, para enviar esos fallos al sistema de monitorización propio.
+func WithRefreshErrorHandler(fn func(err error)) Option {
+	return func(v *Validator) {
+		v.refreshErrorHandler = fn
+	}
+}
+
+// WithLazyJWKS hace que NewValidator no descargue los JWKS durante la construcción: la descarga
+// inicial se realiza en segundo plano y la primera validación espera a que termine (o a que
+// expire su contexto). Útil en CI sin red o cuando la red aún no está lista al arrancar; los
+// fallos de descarga aparecen entonces al validar en lugar de al construir.
+func WithLazyJWKS() Option {
+	return func(v *Validator) {
+		v.lazyJWKS = true
+	}
+}
+
+// WithoutV1Endpoint evita descargar el JWKS v1.0 (discovery/keys), útil cuando la aplicación
+// solo recibe tokens v2.0. Ahorra la gorutina de refresco y las peticiones asociadas.
+func WithoutV1Endpoint() Option {
+	return func(v *Validator) {
+		v.disableV1 = true
+	}
+}
+
+// WithoutV2Endpoint evita descargar el JWKS v2.0 (discovery/v2.0/keys), útil cuando la
+// aplicación solo recibe tokens v1.0.
+func WithoutV2Endpoint() Option {
+	return func(v *Validator) {
+		v.disableV2 = true
+	}
+}
+
+// WithTokenFromCookie habilita la lectura del token desde la cookie indicada cuando la
+// petición no incluye la cabecera Authorization. La cabecera siempre tiene prioridad.
+func WithTokenFromCookie(name string) Option {
+	return func(v *Validator) {
+		v.tokenSources = append(v.tokenSources, CookieSource(name))
+	}
+}
+
+// WithTokenFromQuery habilita la lectura del token desde el parámetro de consulta indicado
+// (p. ej. "access_token") cuando la petición no incluye la cabecera ni la cookie, para
+// handshakes de WebSocket en los que el navegador no puede enviar cabeceras. Se consulta siempre
+// después de la cabecera y de la cookie, sea cual sea el orden de las opciones. Tras validar,
+// el parámetro se elimina de la URL que reciben los handlers posteriores.
+// Solo debe habilitarse en las rutas que lo necesiten: las URLs suelen quedar registradas.
+func WithTokenFromQuery(param string) Option {
+	return func(v *Validator) {
+		v.querySources = append(v.querySources, QuerySource(param))
+	}
+}
+
+// WithMaxTokenBytes limita el tamaño del token en bytes (por defecto 8 KiB). Los tokens mayores se
+// rechazan con ErrTokenTooLarge al extraerlos, antes de decodificarlos, para acotar el coste de
+// cada petición. Conviene ampliarlo si los tokens incluyen muchos grupos o claims opcionales.
+func WithMaxTokenBytes(n int) Option {
+	return func(v *Validator) {
+		v.maxTokenBytes = n
+	}
+}
+
+// WithAuthScheme cambia el esquema esperado en la cabecera Authorization (y en los metadatos
+// gRPC), p. ej. "token" para proxies que no usan "Bearer". La comparación no distingue mayúsculas.
+// Es también el esquema que se anuncia en la cabecera WWW-Authenticate de las respuestas 401 y 403.
+func WithAuthScheme(scheme string) Option {
+	return func(v *Validator) {
+		v.authScheme.name = scheme
+	}
+}
+
+// WithSchemelessToken acepta además el token en bruto en la cabecera Authorization, sin esquema,
+// como lo envían algunos proxies. Los valores con el esquema configurado se siguen aceptando, y
+// WWW-Authenticate sigue anunciando ese esquema.
+func WithSchemelessToken() Option {
+	return func(v *Validator) {
+		v.authScheme.schemeless = true
+	}
+}
+
+// WithTokenSources reemplaza las fuentes del token, que se prueban en el orden indicado
+// (p. ej. WithTokenSources(CookieSource("session"), HeaderSource()) da prioridad a la cookie).
+// Por defecto solo se usa HeaderSource. Descarta las fuentes añadidas antes con WithTokenFromCookie
+// o WithTokenFromQuery.
+func WithTokenSources(sources ...TokenSource) Option {
+	return func(v *Validator) {
+		v.tokenSources = sources
+		v.querySources = nil
+	}
+}
+
+// WithGroupOverageResolver registra un GroupResolver que se invoca durante la validación cuando
+// el token no incluye `groups` por "group overage", para rellenar UserClaims.Groups.
+// Si el resolver falla, la validación falla con ErrGroupResolutionFailed y los middlewares
+// responden 503 para que el cliente reintente.
+func WithGroupOverageResolver(resolver GroupResolver) Option {
+	return func(v *Validator) {
+		v.groupResolver = resolver
+	}
+}
+
+// WithClaimsBuilder reemplaza la construcción por defecto de UserClaims a partir de los claims
+// crudos, p. ej. para tokens que usan `upn` en lugar de `preferred_username`. Las validaciones de
+// emisor, audiencia, etc. se siguen aplicando antes de invocarla.
+func WithClaimsBuilder(builder func(jwt.MapClaims) *UserClaims) Option {
+	return func(v *Validator) {
+		v.claimsBuilder = builder
+	}
+}
+
+// WithAuthorizer centraliza las reglas de autorización en una función de política que se ejecuta
+// tras validar el token en Middleware, OptionalMiddleware y Protect, con la petición que recibirán
+// los handlers (claims ya en el contexto). Si devuelve un error, se responde 403 con
+// ErrAccessDenied envolviendo ese error, cuyo mensaje llega al cliente. Permite decisiones de tipo
+// ABAC a partir de la ruta, el método y los claims sin repartir Require* por las rutas.
+func WithAuthorizer(fn func(r *http.Request, claims *UserClaims) error) Option {
+	return func(v *Validator) {
+		v.authorizer = fn
+	}
+}
+
+// WithContextInjector reemplaza la forma en que Middleware (y el interceptor gRPC) guardan los
+// claims validados en el contexto, p. ej. para escribirlos bajo una clave propia de la aplicación
+// o transformarlos antes. Con un inyector propio, GetClaimsFromContext y los middlewares Require*
+// dejan de ver los claims; Protect no se ve afectado, ya que no los lee del contexto.
+func WithContextInjector(fn func(ctx context.Context, claims *UserClaims) context.Context) Option {
+	return func(v *Validator) {
+		v.contextInjector = fn
+	}
+}
+
+// WithName etiqueta el validador con un nombre, p. ej. al combinar varios validadores (por nube o
+// por inquilino) en un mismo proceso: se añade como campo "validator" a todas sus entradas de log y
+// se informa a los MetricsRecorder que implementen NamedMetricsRecorder.
+func WithName(name string) Option {
+	return func(v *Validator) {
+		v.name = name
+	}
+}
+
 // WithLogger inyecta un logger zap para el registro estructurado.
 func WithLogger(logger *zap.Logger) Option {
 	return func(v *Validator) {
@@ -80,63 +547,315 @@ func WithLogger(logger *zap.Logger) Option {
 	}
 }
 
+// WithNoOpLogger descarta todos los logs del validador, incluidos los de auditoría salvo que se
+// configure WithAuditLogger. Útil en pruebas o cuando el registro se hace fuera del paquete.
+func WithNoOpLogger() Option {
+	return func(v *Validator) {
+		v.logger = zap.NewNop()
+	}
+}
+
+// defaultLogger devuelve el logger de producción que usan los validadores sin WithLogger. Se crea
+// una sola vez y se comparte entre todos ellos; si su creación falla, se usa en silencio un logger
+// nop en lugar de impedir la construcción del validador o escribir en el logger global.
+var defaultLogger = sync.OnceValue(func() *zap.Logger {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return zap.NewNop()
+	}
+	return logger
+})
+
+// WithRawClaimsAllowlist limita RawClaims a los claims indicados en los UserClaims que Middleware
+// (y el interceptor gRPC) guardan en el contexto, para que el código posterior no registre por
+// accidente claims personalizados sensibles. Los campos tipados de UserClaims se rellenan igualmente
+// a partir del token completo, y Validate sigue devolviendo todos los claims.
+func WithRawClaimsAllowlist(keys ...string) Option {
+	return func(v *Validator) {
+		v.rawClaimsAllowlist = append([]string{}, keys...)
+	}
+}
+
+// WithClaimsLogging controla si el log de depuración de un token válido incluye todos los claims.
+// Deshabilitado por defecto, ya que los claims contienen datos personales (name, preferred_username).
+func WithClaimsLogging(enabled bool) Option {
+	return func(v *Validator) {
+		v.logClaims = enabled
+	}
+}
+
+// WithDetailedErrors expone al cliente el motivo concreto del rechazo (token expirado, emisor
+// o audiencia inválidos, etc.) en el `type` y `detail` del problema, en lugar del error genérico.
+func WithDetailedErrors() Option {
+	return func(v *Validator) {
+		v.detailedErrors = true
+	}
+}
+
 // NewValidator crea un nuevo validador de tokens configurado con las opciones proporcionadas.
 // Inicia la obtención y el cacheo en segundo plano de los JWKS de Azure.
+// tenantID puede ser el GUID del inquilino o uno de sus dominios verificados; como Azure emite
+// los tokens con el GUID en `iss`, con un dominio hay que indicar los emisores con WithIssuers
+// (o usar NewDiscoveryValidator, que los obtiene del documento de descubrimiento).
 func NewValidator(ctx context.Context, tenantID string, opts ...Option) (*Validator, error) {
-	if tenantID == "" {
-		return nil, fmt.Errorf("el ID de inquilino (tenantID) no puede estar vacío")
+	tenantID, err := normalizeTenantID(tenantID)
+	if err != nil {
+		return nil, err
 	}
 
-	jwksV1URL := fmt.Sprintf("https://login.microsoftonline.com/%s/discovery/keys", tenantID)
-	jwksV2URL := fmt.Sprintf("https://login.microsoftonline.com/%s/discovery/v2.0/keys", tenantID)
+	return newValidator(ctx, opts, func(_ context.Context, v *Validator) (endpoints, error) {
+		return v.cloud.endpoints(tenantID), nil
+	})
+}
 
-	// La librería `keyfunc` maneja internamente el almacenamiento (storage) y la
-	// actualización de las claves públicas de forma automática. Al llamar a
-	// NewDefaultCtx, se inicia una gorutina en segundo plano que refresca
-	// periódicamente el JWKS desde la URL de Azure. El `context` (ctx) que
-	// se pasa a la función controla el ciclo de vida de esta gorutina,
-	// permitiendo un apagado elegante.
-	jwksV1, err := keyfunc.NewDefaultCtx(ctx, []string{jwksV1URL})
-	if err != nil {
-		return nil, fmt.Errorf("fallo al crear el JWKS para v1: %w", err)
+// NewB2CValidator crea un validador para una política (user flow) de Azure AD B2C.
+// Las claves se obtienen del endpoint de descubrimiento de la política en {tenant}.b2clogin.com.
+// El emisor por defecto usa el dominio del inquilino; si la política emite el GUID del inquilino
+// (comportamiento por defecto de B2C), use WithIssuers con el `issuer` de sus metadatos.
+func NewB2CValidator(ctx context.Context, tenant, policy string, opts ...Option) (*Validator, error) {
+	if tenant == "" {
+		return nil, fmt.Errorf("el inquilino B2C (tenant) no puede estar vacío")
 	}
-
-	jwksV2, err := keyfunc.NewDefaultCtx(ctx, []string{jwksV2URL})
-	if err != nil {
-		return nil, fmt.Errorf("fallo al crear el JWKS para v2: %w", err)
+	if policy == "" {
+		return nil, fmt.Errorf("la política B2C (policy) no puede estar vacía")
 	}
 
+	return newValidator(ctx, opts, func(_ context.Context, v *Validator) (endpoints, error) {
+		return endpoints{
+			jwksV2URL: fmt.Sprintf("https://%s.b2clogin.com/%s.onmicrosoft.com/%s/discovery/v2.0/keys", tenant, tenant, policy),
+			issuers: []string{
+				fmt.Sprintf("https://%s.b2clogin.com/%s.onmicrosoft.com/v2.0/", tenant, tenant),
+			},
+			authorizationURL: fmt.Sprintf("https://%s.b2clogin.com/%s.onmicrosoft.com/%s/oauth2/v2.0/authorize", tenant, tenant, policy),
+		}, nil
+	})
+}
+
+// applyOptions crea un Validator con los valores por defecto y le aplica las opciones.
+// No valida la configuración ni inicia los JWKS.
+func applyOptions(opts []Option) *Validator {
 	validator := &Validator{
-		jwksV1:                 jwksV1,
-		jwksV2:                 jwksV2,
-		isAudienceCheckEnabled: true, // Habilitado por defecto
-		validIssuers: []string{
-			fmt.Sprintf("https://sts.windows.net/%s/", tenantID),
-			fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", tenantID),
-		},
+		isAudienceCheckEnabled:    true, // Habilitado por defecto
+		tokenSources:              []TokenSource{HeaderSource()},
+		authScheme:                defaultAuthScheme,
+		maxTokenBytes:             defaultMaxTokenBytes,
+		problemTypeBase:           defaultProblemTypeBase,
+		validMethods:              slices.Clone(defaultValidMethods),
+		cloud:                     AzurePublic,
+		tracer:                    defaultTracer(),
+		refreshStatus:             &refreshStatus{},
+		refreshInterval:           defaultRefreshInterval,
+		unknownKIDRefreshInterval: defaultRefreshUnknownKID,
+		maxRetryAfter:             defaultMaxRetryAfter,
 	}
 
 	// Aplicar todas las opciones de configuración proporcionadas.
 	for _, opt := range opts {
 		opt(validator)
 	}
+	// Las fuentes de WithTokenFromQuery van las últimas, tras la cabecera y las cookies.
+	validator.tokenSources = append(validator.tokenSources, validator.querySources...)
+
+	return validator
+}
 
-	// Si no se proporciona un logger, crear uno de producción por defecto.
+// endpoints agrupa las URLs de los JWKS, los emisores por defecto y los endpoints de tokens y de
+// autorización de un validador.
+// Una URL vacía indica que ese endpoint no se utiliza.
+type endpoints struct {
+	jwksV1URL        string
+	jwksV2URL        string
+	issuers          []string
+	tokenURL         string
+	authorizationURL string
+}
+
+// newValidator aplica las opciones, valida la configuración resultante e inicia los JWKS.
+// resolve calcula los endpoints una vez aplicadas las opciones, ya que pueden depender de ellas.
+func newValidator(ctx context.Context, opts []Option, resolve func(ctx context.Context, v *Validator) (endpoints, error)) (*Validator, error) {
+	validator := applyOptions(opts)
+
+	// Si no se proporciona un logger, usar el de producción compartido por defecto.
 	if validator.logger == nil {
-		prodLogger, err := zap.NewProduction()
+		validator.logger = defaultLogger()
+	}
+	if validator.auditLogger == nil {
+		validator.auditLogger = validator.logger
+	}
+	if validator.name != "" {
+		validator.logger = validator.logger.With(zap.String("validator", validator.name))
+		validator.auditLogger = validator.auditLogger.With(zap.String("validator", validator.name))
+	}
+
+	if validator.cloud == "" {
+		return nil, fmt.Errorf("la nube de Azure (cloud) no puede estar vacía")
+	}
+
+	allowedTenants := make([]string, 0, len(validator.allowedTenants))
+	for _, tenantID := range validator.allowedTenants {
+		tenantID, err := normalizeTenantID(tenantID)
 		if err != nil {
-			return nil, fmt.Errorf("fallo al crear el logger por defecto: %w", err)
+			return nil, fmt.Errorf("WithAllowedTenants: %w", err)
+		}
+		allowedTenants = append(allowedTenants, tenantID)
+	}
+	if len(allowedTenants) > 0 {
+		validator.allowedTenants = allowedTenants
+	}
+
+	if validator.requiredVersion != "" && validator.requiredVersion != "1.0" && validator.requiredVersion != "2.0" {
+		return nil, fmt.Errorf("versión de token no soportada: %q", validator.requiredVersion)
+	}
+
+	ep, err := resolve(ctx, validator)
+	if err != nil {
+		return nil, err
+	}
+	if validator.jwksURLs != nil {
+		for _, jwksURL := range []string{validator.jwksURLs.jwksV1URL, validator.jwksURLs.jwksV2URL} {
+			if u, err := url.Parse(jwksURL); jwksURL != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+				return nil, fmt.Errorf("la URL de JWKS %q no es una URL absoluta válida", jwksURL)
+			}
 		}
-		validator.logger = prodLogger
+		ep.jwksV1URL, ep.jwksV2URL = validator.jwksURLs.jwksV1URL, validator.jwksURLs.jwksV2URL
+	}
+	if validator.disableV1 || validator.requiredVersion == "2.0" {
+		ep.jwksV1URL = ""
+	}
+	if validator.disableV2 {
+		ep.jwksV2URL = ""
+	}
+	if validator.staticJWKS != nil {
+		ep.jwksV1URL, ep.jwksV2URL = "", ""
+	} else if ep.jwksV1URL == "" && ep.jwksV2URL == "" {
+		return nil, fmt.Errorf("no hay ningún endpoint JWKS habilitado")
+	}
+	validator.tokenURL = ep.tokenURL
+	validator.authorizationURL = ep.authorizationURL
+	if validator.discovery != nil {
+		validator.discovery.customIssuers = validator.validIssuers != nil
 	}
 
-	if validator.isAudienceCheckEnabled && len(validator.validAudiences) == 0 {
+	// WithIssuers deja un slice no nulo (aunque esté vacío), por lo que nil indica
+	// que se deben usar los emisores por defecto.
+	if validator.validIssuers == nil {
+		validator.validIssuers = ep.issuers
+	}
+
+	validator.defaultIssuers = ep.issuers
+	if err := validator.configureSymmetricKey(); err != nil {
+		return nil, err
+	}
+
+	if validator.clockSkew < 0 || validator.nbfLeeway < 0 {
+		return nil, fmt.Errorf("la tolerancia de reloj no puede ser negativa")
+	}
+
+	if validator.expiryGrace < 0 {
+		return nil, fmt.Errorf("el periodo de gracia de caducidad no puede ser negativo")
+	}
+
+	if validator.refreshInterval <= 0 {
+		return nil, fmt.Errorf("el intervalo de refresco de los JWKS debe ser positivo")
+	}
+
+	if validator.maxRetryAfter < 0 {
+		return nil, fmt.Errorf("la espera máxima ante Retry-After no puede ser negativa")
+	}
+	validator.httpClient = withRetryAfter(validator.httpClient, validator.maxRetryAfter)
+
+	if validator.authScheme.name == "" {
+		return nil, fmt.Errorf("el esquema de autorización no puede estar vacío; use WithSchemelessToken para aceptar tokens sin esquema")
+	}
+
+	if validator.problemTypeBase == "" {
+		return nil, fmt.Errorf("la base de los URIs de tipo de problema no puede estar vacía")
+	}
+
+	if validator.maxTokenBytes <= 0 {
+		return nil, fmt.Errorf("el tamaño máximo del token debe ser positivo")
+	}
+
+	if len(validator.tokenSources) == 0 {
+		return nil, fmt.Errorf("no se proporcionaron fuentes del token")
+	}
+
+	if len(validator.validMethods) == 0 {
+		return nil, fmt.Errorf("no se proporcionaron algoritmos de firma permitidos")
+	}
+
+	if len(validator.validIssuers) == 0 {
+		return nil, fmt.Errorf("no se proporcionaron emisores válidos")
+	}
+
+	if validator.isAudienceCheckEnabled && len(validator.validAudiences) == 0 &&
+		len(validator.issuerAudiences) == 0 && validator.audienceValidationFunc == nil {
 		return nil, fmt.Errorf("la validación de audiencia está habilitada pero no se proporcionaron audiencias válidas")
 	}
 
+	if err := validator.checkAudienceConfig(validator.validAudiences, ep); err != nil {
+		return nil, err
+	}
+
+	if validator.strictAudience && len(validator.validAudiences) > 1 {
+		return nil, fmt.Errorf("WithStrictAudience requiere una única audiencia, se proporcionaron %d", len(validator.validAudiences))
+	}
+	for issuer, audiences := range validator.issuerAudiences {
+		if validator.strictAudience && len(audiences) != 1 {
+			return nil, fmt.Errorf("WithStrictAudience requiere una única audiencia para el emisor %q", issuer)
+		}
+	}
+
+	// Contexto propio para las gorutinas de refresco, de modo que Close pueda detenerlas
+	// sin cancelar el contexto del llamador.
+	ctx, validator.cancel = context.WithCancel(ctx)
+
+	// La librería `keyfunc` maneja internamente el almacenamiento (storage) y la
+	// actualización de las claves públicas de forma automática. Al construirla,
+	// se inicia una gorutina en segundo plano que refresca periódicamente el JWKS
+	// desde la URL de Azure. El `context` (ctx) que se pasa a la función controla
+	// el ciclo de vida de esta gorutina, permitiendo un apagado elegante.
+	if validator.staticJWKS != nil {
+		validator.jwksV2, err = validator.newStaticJWKS(ctx, validator.staticJWKS)
+		if err != nil {
+			validator.cancel()
+			return nil, fmt.Errorf("JWKS estático no válido: %w", err)
+		}
+	}
+
+	if ep.jwksV1URL != "" {
+		validator.jwksV1, err = validator.loadJWKS(ctx, endpointV1, ep.jwksV1URL)
+		if err != nil {
+			validator.cancel()
+			return nil, fmt.Errorf("fallo al crear el JWKS para v1: %w", err)
+		}
+	}
+
+	if ep.jwksV2URL != "" {
+		validator.jwksV2, err = validator.loadJWKS(ctx, endpointV2, ep.jwksV2URL)
+		if err != nil {
+			validator.cancel()
+			return nil, fmt.Errorf("fallo al crear el JWKS para v2: %w", err)
+		}
+	}
+
+	if validator.discovery != nil {
+		go validator.watchDiscovery(ctx)
+	}
+
 	return validator, nil
 }
 
+// Close detiene las gorutinas de refresco de los JWKS. Tras llamarlo, Validate y Middleware
+// rechazan cualquier token con ErrValidatorClosed. Es seguro llamarlo más de una vez.
+func (v *Validator) Close() error {
+	if v.closed.Swap(true) {
+		return nil
+	}
+	v.cancel()
+	return nil
+}
+
 // =============================================================================
 // Middleware HTTP
 // =============================================================================
@@ -144,115 +863,603 @@ func NewValidator(ctx context.Context, tenantID string, opts ...Option) (*Valida
 // Middleware devuelve un manejador de middleware HTTP que valida el token de portador.
 func (v *Validator) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString, err := extractBearerToken(r)
-		if err != nil {
-			problem.RespondError(w,
-				problem.FromError(
-					err,
-					http.StatusUnauthorized,
-					problem.WithInstance(r),
-				),
-			)
+		r, _, ok := v.authenticate(w, r, v.defaultAudienceCheck())
+		if !ok {
 			return
 		}
 
-		claims, err := v.validateToken(tokenString)
-		if err != nil {
-			v.logger.Warn("Token validation failed", zap.Error(err), zap.String("remote_addr", r.RemoteAddr))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MiddlewareWithoutAudience es como Middleware, pero no comprueba la audiencia del token, para
+// montar rutas internas con el mismo Validator que las rutas públicas sin recurrir a
+// WithoutAudienceValidation, que la desactiva en todas. El resto de comprobaciones se mantiene.
+func (v *Validator) MiddlewareWithoutAudience(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, _, ok := v.authenticate(w, r, audienceCheck{})
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// OptionalMiddleware es como Middleware, pero deja pasar sin claims las peticiones que no
+// incluyen token, para endpoints que admiten acceso anónimo. Un token presente pero mal formado
+// o inválido se sigue rechazando con 401. GetClaimsFromContext indica si hay usuario autenticado.
+func (v *Validator) OptionalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := v.extractToken(r); errors.Is(err, ErrMissingAuthHeader) {
+			next.ServeHTTP(w, v.forwardIdentity(r, nil))
+			return
+		}
+
+		r, _, ok := v.authenticate(w, r, v.defaultAudienceCheck())
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler devuelve Middleware como valor func(http.Handler) http.Handler, el formato que
+// esperan los routers como chi o gorilla/mux (p. ej. router.Use(validator.Handler())).
+func (v *Validator) Handler() func(http.Handler) http.Handler {
+	return v.Middleware
+}
+
+// MiddlewareFunc es como Middleware, pero recibe directamente una función manejadora.
+func (v *Validator) MiddlewareFunc(next http.HandlerFunc) http.Handler {
+	return v.Middleware(next)
+}
+
+// authenticate extrae y valida el token de la petición y devuelve la petición que deben recibir
+// los handlers posteriores, con los claims y el token en el contexto. Si no es válido, responde
+// al cliente con el error correspondiente y devuelve false.
+func (v *Validator) authenticate(w http.ResponseWriter, r *http.Request, audiences audienceCheck) (*http.Request, *UserClaims, bool) {
+	tokenString, err := v.extractToken(r)
+	if err != nil {
+		v.auditDenial(r, http.StatusUnauthorized, err, nil)
+		v.setChallenge(w, extractionErrorCode(err), nil, nil)
+		problem.RespondError(w,
+			problem.FromError(
+				err,
+				http.StatusUnauthorized,
+				problem.WithInstance(r),
+				problem.WithType(v.problemType(err)),
+			),
+		)
+		return nil, nil, false
+	}
+
+	claims, err := v.validateTokenFor(r.Context(), tokenString, audiences)
+	if err == nil && v.certificateBinding {
+		err = checkCertificateBinding(claims, peerCertificateThumbprint(r))
+	}
+	if unavailableErr := unavailableError(err); unavailableErr != nil {
+		// El token no se ha podido verificar, no es inválido: se indica al cliente que
+		// reintente en lugar de hacerle descartar unas credenciales posiblemente válidas.
+		v.logger.Error("Token verification unavailable", zap.Error(err), zap.String("remote_addr", r.RemoteAddr))
+		v.auditDenial(r, http.StatusServiceUnavailable, err, nil)
+		w.Header().Set("Retry-After", strconv.Itoa(int(unavailableRetryAfter.Seconds())))
+		problem.RespondError(w,
+			problem.FromError(
+				unavailableErr,
+				http.StatusServiceUnavailable,
+				problem.WithInstance(r),
+				problem.WithType(v.problemType(unavailableErr)),
+			),
+		)
+		return nil, nil, false
+	}
+	if err != nil {
+		v.logger.Warn("Token validation failed", zap.Error(err), zap.String("remote_addr", r.RemoteAddr))
+		v.auditDenial(r, http.StatusUnauthorized, err, nil)
+
+		// Salvo que se habilite WithDetailedErrors, el cliente solo recibe un error genérico.
+		publicErr := ErrTokenInvalid
+		if v.detailedErrors {
+			publicErr = publicError(err)
+		}
+		v.setChallenge(w, bearerErrorInvalidToken, publicErr, nil)
+
+		problem.RespondError(w,
+			problem.FromError(
+				publicErr,
+				http.StatusUnauthorized,
+				problem.WithInstance(r),
+				problem.WithType(v.problemType(publicErr)),
+			),
+		)
+
+		return nil, nil, false
+	}
+
+	v.logValidated(claims)
+	r = r.WithContext(v.injectClaims(r.Context(), claims, tokenString))
+	if v.baggage {
+		r = r.WithContext(contextWithClaimsBaggage(r.Context(), claims))
+	}
+	r = v.forwardIdentity(stripQueryToken(r, tokenString), claims)
+
+	if v.authorizer != nil {
+		if err := v.authorizer(r, claims); err != nil {
+			v.auditDenial(r, http.StatusForbidden, err, claims)
 			problem.RespondError(w,
 				problem.FromError(
-					ErrTokenInvalid,
-					http.StatusUnauthorized,
+					fmt.Errorf("%w: %w", ErrAccessDenied, err),
+					http.StatusForbidden,
 					problem.WithInstance(r),
+					problem.WithType(v.problemType(ErrAccessDenied)),
 				),
 			)
-
-			return
+			return nil, nil, false
 		}
+	}
 
-		// TODO cambiar a debug
-		v.logger.Info("Token validated", zap.Any("claims", claims))
-		ctxWithClaims := context.WithValue(r.Context(), userClaimsKey{}, claims)
-		next.ServeHTTP(w, r.WithContext(ctxWithClaims))
-	})
+	return r, claims, true
+}
+
+// logValidated registra a nivel Debug la validación correcta de un token. Salvo que se
+// habilite WithClaimsLogging, solo se registran el sujeto y el inquilino para no exponer datos personales.
+func (v *Validator) logValidated(claims *UserClaims) {
+	if v.logClaims {
+		v.logger.Debug("Token validated", zap.Any("claims", claims))
+		return
+	}
+	v.logger.Debug("Token validated",
+		zap.String("subject", claims.Subject),
+		zap.String("tenant_id", claims.TenantID),
+	)
+}
+
+// Validate valida el token y devuelve sus claims, sin depender de una petición HTTP.
+// Pensado para servicios gRPC, consumidores de colas u otros llamadores fuera de Middleware.
+// Devuelve los errores tipados del paquete (ErrTokenParsingFailed, ErrInvalidIssuer, etc.),
+// y el error del contexto si este ya fue cancelado.
+func (v *Validator) Validate(ctx context.Context, tokenString string) (*UserClaims, error) {
+	return v.validateToken(ctx, tokenString)
+}
+
+// ValidateInto valida el token igual que Validate y, si es válido, decodifica su payload en dest,
+// un struct de claims propio de la aplicación (p. ej. con jwt.RegisteredClaims embebido y campos
+// adicionales). La firma solo se verifica una vez; dest se rellena tras superar todas las comprobaciones.
+func ValidateInto[T jwt.Claims](ctx context.Context, v *Validator, tokenString string, dest *T) error {
+	if _, err := v.validateToken(ctx, tokenString); err != nil {
+		return err
+	}
+
+	// *T siempre implementa jwt.Claims cuando T lo hace, pero el compilador no puede deducirlo.
+	claims, ok := any(dest).(jwt.Claims)
+	if !ok {
+		return fmt.Errorf("%w: el destino no implementa jwt.Claims", ErrTokenParsingFailed)
+	}
+
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+	}
+
+	return nil
+}
+
+// ValidateForAudience valida el token igual que Validate, pero comprobando la audiencia contra
+// las audiencias indicadas en lugar de las configuradas, sin modificar el Validator. Pensado para
+// gateways que exponen varias APIs, cada una con su propia audiencia.
+func (v *Validator) ValidateForAudience(ctx context.Context, tokenString string, audiences ...string) (*UserClaims, error) {
+	return v.validateTokenFor(ctx, tokenString, audienceCheck{enabled: true, audiences: audiences})
+}
+
+// audienceCheck describe la comprobación de audiencia aplicada en una validación concreta.
+type audienceCheck struct {
+	enabled   bool
+	audiences []string
+	// byIssuer, si incluye el emisor del token, reemplaza audiences para ese emisor.
+	byIssuer map[string][]string
+	// strict exige que el token tenga exactamente una audiencia, idéntica a la única esperada.
+	strict bool
+	// fn, si no es nil, reemplaza la comparación con audiences y byIssuer.
+	fn func(aud jwt.ClaimStrings) bool
+}
+
+// expected devuelve las audiencias válidas para los tokens del emisor indicado.
+func (c audienceCheck) expected(issuer string) []string {
+	if audiences, ok := c.byIssuer[issuer]; ok {
+		return audiences
+	}
+	return c.audiences
 }
 
-// extractBearerToken extracts the JWT from the Authorization header,
-// handling the "Bearer" scheme in a case-insensitive manner as per RFC 6750.
-// TODO valorar usar
-// tokenString, found := strings.CutPrefix(authHeader, "Bearer ")
-func extractBearerToken(r *http.Request) (string, error) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return "", ErrMissingAuthHeader
+// matches indica si las audiencias del token del emisor indicado superan la comprobación.
+func (c audienceCheck) matches(issuer string, aud jwt.ClaimStrings) bool {
+	if c.fn != nil {
+		return c.fn(aud)
 	}
+	if c.strict {
+		expected := c.expected(issuer)
+		return len(expected) == 1 && len(aud) == 1 && aud[0] == expected[0]
+	}
+	return audiencesIntersect(c.expected(issuer), aud)
+}
 
-	// The "Bearer" scheme is case-insensitive. Check for "Bearer " prefix.
-	if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
-		return authHeader[7:], nil
+// defaultAudienceCheck devuelve la comprobación de audiencia configurada en el validador.
+func (v *Validator) defaultAudienceCheck() audienceCheck {
+	return audienceCheck{
+		enabled:   v.isAudienceCheckEnabled,
+		audiences: v.audiences(),
+		byIssuer:  v.issuerAudiences,
+		strict:    v.strictAudience,
+		fn:        v.audienceValidationFunc,
 	}
+}
 
-	return "", ErrInvalidAuthHeaderFormat
+// validateToken realiza el proceso completo de validación del token con la audiencia configurada.
+func (v *Validator) validateToken(ctx context.Context, tokenString string) (*UserClaims, error) {
+	return v.validateTokenFor(ctx, tokenString, v.defaultAudienceCheck())
 }
 
-// validateToken realiza el proceso completo de validación del token.
-func (v *Validator) validateToken(tokenString string) (*UserClaims, error) {
+// validateTokenFor realiza el proceso completo de validación del token con la comprobación de
+// audiencia indicada.
+func (v *Validator) validateTokenFor(ctx context.Context, tokenString string, audCheck audienceCheck) (claims *UserClaims, err error) {
+	if v.metrics != nil {
+		start := time.Now()
+		defer func() {
+			v.observeValidation(validationResult(err), time.Since(start))
+		}()
+	}
+
+	ctx, span := v.tracer.Start(ctx, validateSpanName)
+	defer func() {
+		endValidationSpan(span, err)
+	}()
+
+	if v.closed.Load() {
+		return nil, ErrValidatorClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := v.checkTokenSize(tokenString); err != nil {
+		return nil, err
+	}
+
+	// Un JWS compacto tiene exactamente tres segmentos: se descarta la basura sin invocar al parser.
+	if strings.Count(tokenString, ".") != 2 {
+		return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, jwt.ErrTokenMalformed)
+	}
+
+	// Un token ya validado y aún vigente no necesita verificarse de nuevo (si está habilitado).
+	var cacheKey tokenKey
+	if v.resultCache != nil {
+		cacheKey = newTokenKey(tokenString, v.generation())
+		if cached, ok := v.resultCache.get(cacheKey, time.Now()); ok {
+			// La entrada pudo cachearse al validar contra otras audiencias.
+			if audCheck.enabled && !audCheck.matches(cached.Issuer, cached.Audience) {
+				return nil, newValidationError(ErrInvalidAudience, "aud", audCheck.expected(cached.Issuer), cached.Audience)
+			}
+			claims := cached.clone()
+			if err := v.checkRevocation(ctx, claims); err != nil {
+				return nil, err
+			}
+			return claims, nil
+		}
+	}
+
+	// Un token rechazado hace poco se rechaza de nuevo sin verificarlo (si está habilitado).
+	if v.negativeCache != nil {
+		negativeKey := newNegativeKey(tokenString, v.generation(), audCheck.enabled)
+		if cachedErr, ok := v.negativeCache.get(negativeKey, time.Now()); ok {
+			return nil, cachedErr
+		}
+		defer func() {
+			if err != nil && isCacheableFailure(err) {
+				v.negativeCache.add(negativeKey, err, time.Now().Add(v.negativeCacheTTL))
+			}
+		}()
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.validMethods),
+		jwt.WithLeeway(v.clockSkew),
+	}
+	// jwt/v5 aplica una única tolerancia a `exp` y `nbf`; con tolerancias distintas (o con
+	// periodo de gracia), los claims temporales se comprueban aparte en validateTimes.
+	customTimes := v.nbfLeeway > 0 || v.expiryGrace > 0
+	if customTimes {
+		parserOpts = append(parserOpts, jwt.WithoutClaimsValidation())
+	}
+
 	var mapClaims jwt.MapClaims
-	token, err := jwt.ParseWithClaims(tokenString, &mapClaims, v.keyFunc, jwt.WithValidMethods([]string{"RS256"}))
+	token, err := jwt.ParseWithClaims(tokenString, &mapClaims, v.keyFunc(ctx), parserOpts...)
 	if err != nil {
 		// Envolvemos el error original para mantener el contexto completo.
-		return nil, fmt.Errorf("%w: %v", ErrTokenParsingFailed, err)
+		return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+	}
+
+	if customTimes {
+		if err := v.validateTimes(mapClaims, time.Now()); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+		}
 	}
 
 	if !token.Valid {
 		return nil, ErrTokenInvalid
 	}
+	// Un payload `null` decodifica a un mapa nil: no es un conjunto de claims válido.
+	if mapClaims == nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, jwt.ErrTokenMalformed)
+	}
+
+	// Validar versión del token (si está habilitado)
+	if err := v.checkVersion(mapClaims); err != nil {
+		return nil, err
+	}
 
 	// Validar emisor
 	issuer, _ := mapClaims.GetIssuer()
-	if !slices.Contains(v.validIssuers, issuer) {
-		return nil, fmt.Errorf("%w. Received: %s", ErrInvalidIssuer, issuer)
+	span.SetAttributes(attribute.String("jwt.issuer", issuer))
+	if err := v.validateIssuer(issuer, mapClaims); err != nil {
+		return nil, err
+	}
+
+	// Validar que el inquilino del emisor coincide con `tid` (si está habilitado)
+	if err := v.checkTenantMatch(issuer, mapClaims); err != nil {
+		return nil, err
+	}
+
+	// Validar audiencia (si está habilitado). Un `aud` con un tipo no válido no puede coincidir.
+	if audCheck.enabled {
+		audience, err := tokenAudience(mapClaims)
+		if err != nil {
+			return nil, err
+		}
+		audienceMatch := audCheck.matches(issuer, audience)
+		span.SetAttributes(attribute.Bool("jwt.audience_match", audienceMatch))
+		if !audienceMatch {
+			return nil, newValidationError(ErrInvalidAudience, "aud", audCheck.expected(issuer), audience)
+		}
+	}
+
+	// Validar aplicación cliente (si está habilitado)
+	if err := v.checkClientApp(mapClaims); err != nil {
+		return nil, err
+	}
+
+	// Validar claims obligatorios
+	if err := v.checkRequiredClaims(mapClaims); err != nil {
+		return nil, err
+	}
+
+	// Reglas de negocio propias (si están configuradas)
+	if err := v.runClaimsValidators(mapClaims); err != nil {
+		return nil, err
+	}
+
+	claims, err = v.buildClaims(mapClaims)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.applyPermissionPolicy(claims); err != nil {
+		return nil, err
+	}
+	if err := v.checkAppAuthLevel(claims); err != nil {
+		return nil, err
+	}
+
+	// Un token aceptado dentro del periodo de gracia se marca para que el llamador decida.
+	if v.expiryGrace > 0 {
+		if exp, _ := mapClaims.GetExpirationTime(); exp != nil {
+			if expiredBy := time.Since(exp.Time); expiredBy > v.clockSkew {
+				claims.Expired, claims.ExpiredBy = true, expiredBy
+				v.logger.Warn("Expired token accepted within grace period",
+					zap.String("subject", claims.Subject),
+					zap.Duration("expired_by", expiredBy),
+				)
+			}
+		}
+	}
+
+	// Consultar si el token está revocado (si está configurado)
+	if err := v.checkRevocation(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	// Resolver los grupos si el token señala "group overage" (si está configurado)
+	if claims.GroupsOverflowed && v.groupResolver != nil {
+		groups, err := v.groupResolver(ctx, claims)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrGroupResolutionFailed, err)
+		}
+		claims.Groups = groups
+	}
+
+	if v.resultCache != nil && !claims.Expired {
+		if exp, _ := mapClaims.GetExpirationTime(); exp != nil {
+			v.resultCache.add(cacheKey, claims.clone(), exp.Time)
+		}
+	}
+
+	return claims, nil
+}
+
+// validateIssuer comprueba el emisor del token. En modo multi-inquilino (WithAllowedTenants),
+// el `tid` debe estar permitido y el emisor debe pertenecer a ese mismo inquilino.
+func (v *Validator) validateIssuer(issuer string, mapClaims jwt.MapClaims) error {
+	if len(v.allowedTenants) == 0 {
+		if validIssuers := v.issuers(); !slices.Contains(validIssuers, issuer) {
+			return newValidationError(ErrInvalidIssuer, "iss", validIssuers, issuer)
+		}
+		return nil
+	}
+
+	tenantID, _ := mapClaims["tid"].(string)
+	if !slices.Contains(v.allowedTenants, tenantID) {
+		return newValidationError(ErrTenantNotAllowed, "tid", v.allowedTenants, tenantID)
+	}
+
+	if !slices.Contains(v.cloud.issuers(tenantID), issuer) {
+		return newValidationError(ErrInvalidIssuer, "iss", v.cloud.issuers(tenantID), issuer)
+	}
+
+	return nil
+}
+
+// checkVersion comprueba la versión del token (`ver`) si se configuró WithRequiredVersion.
+func (v *Validator) checkVersion(mapClaims jwt.MapClaims) error {
+	if v.requiredVersion == "" {
+		return nil
+	}
+	if ver, _ := mapClaims["ver"].(string); ver != v.requiredVersion {
+		return newValidationError(ErrUnsupportedTokenVersion, "ver", v.requiredVersion, ver)
+	}
+	return nil
+}
+
+// checkTenantMatch comprueba que el inquilino del emisor coincide con `tid`, si está habilitado.
+func (v *Validator) checkTenantMatch(issuer string, mapClaims jwt.MapClaims) error {
+	if !v.verifyTenantID {
+		return nil
+	}
+	tenantID, _ := mapClaims["tid"].(string)
+	if issuerTenant := issuerTenantID(issuer); issuerTenant == "" || !strings.EqualFold(issuerTenant, tenantID) {
+		return newValidationError(ErrTenantMismatch, "tid", issuerTenant, tenantID)
+	}
+	return nil
+}
+
+// checkClientApp comprueba la aplicación cliente si se configuró una lista de permitidas.
+func (v *Validator) checkClientApp(mapClaims jwt.MapClaims) error {
+	if len(v.allowedClientApps) == 0 {
+		return nil
+	}
+	if appID := clientAppID(mapClaims); !slices.Contains(v.allowedClientApps, appID) {
+		return newValidationError(ErrInvalidClientApp, "azp", v.allowedClientApps, appID)
 	}
+	return nil
+}
 
-	// Validar audiencia (si está habilitado)
-	if v.isAudienceCheckEnabled {
-		audience, _ := mapClaims.GetAudience()
-		if !audiencesIntersect(v.validAudiences, audience) {
-			return nil, fmt.Errorf("%w. Received: %v", ErrInvalidAudience, audience)
+// checkRequiredClaims comprueba que los claims obligatorios estén presentes y no vacíos.
+func (v *Validator) checkRequiredClaims(mapClaims jwt.MapClaims) error {
+	for _, key := range v.requiredClaims {
+		if isEmptyClaim(mapClaims[key]) {
+			return newValidationError(ErrMissingRequiredClaim, key, "non-empty value", mapClaims[key])
 		}
 	}
+	return nil
+}
 
-	return v.buildUserClaims(mapClaims), nil
+// runClaimsValidators ejecuta las reglas de WithClaimsValidator en orden.
+func (v *Validator) runClaimsValidators(mapClaims jwt.MapClaims) error {
+	for _, validate := range v.claimsValidators {
+		if err := validate(mapClaims); err != nil {
+			return fmt.Errorf("%w: %w", ErrClaimsRejected, err)
+		}
+	}
+	return nil
 }
 
-// keyFunc es la función que provee la clave de verificación a la librería JWT.
-func (v *Validator) keyFunc(token *jwt.Token) (interface{}, error) {
-	key, err := v.jwksV2.Keyfunc(token)
-	if err == nil {
-		return key, nil
+// buildClaims construye los UserClaims con WithClaimsBuilder o, si no se configuró, buildUserClaims.
+func (v *Validator) buildClaims(mapClaims jwt.MapClaims) (*UserClaims, error) {
+	buildClaims := buildUserClaims
+	if v.claimsBuilder != nil {
+		buildClaims = v.claimsBuilder
+	}
+	claims := buildClaims(mapClaims)
+	if claims == nil {
+		return nil, fmt.Errorf("%w: el constructor de claims no devolvió resultado", ErrTokenInvalid)
+	}
+	claims.certThumbprint = boundCertificateThumbprint(mapClaims)
+	return claims, nil
+}
+
+// validateTimes comprueba `exp` con la tolerancia de WithClockSkew más el periodo de WithExpiryGrace
+// y `nbf` con la de WithLeewayForNbf. Devuelve los mismos errores de jwt/v5 que su validación por defecto.
+func (v *Validator) validateTimes(mapClaims jwt.MapClaims, now time.Time) error {
+	exp, err := mapClaims.GetExpirationTime()
+	if err != nil {
+		return err
+	}
+	if exp != nil && now.After(exp.Add(v.clockSkew+v.expiryGrace)) {
+		return jwt.ErrTokenExpired
+	}
+
+	nbf, err := mapClaims.GetNotBefore()
+	if err != nil {
+		return err
+	}
+	if nbf != nil && now.Before(nbf.Add(-max(v.nbfLeeway, v.clockSkew))) {
+		return jwt.ErrTokenNotValidYet
+	}
+
+	return nil
+}
+
+// issuerTenantID extrae el inquilino del emisor, que Azure incluye como primer segmento de la ruta
+// tanto en v1.0 (https://sts.windows.net/{tid}/) como en v2.0 (https://login.microsoftonline.com/{tid}/v2.0).
+func issuerTenantID(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return ""
+	}
+
+	tenantID, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	return tenantID
+}
+
+// keyFunc devuelve la función que provee la clave de verificación a la librería JWT.
+// Busca primero en el JWKS v2 y después en el v1, omitiendo los que no estén configurados.
+// El contexto se propaga a la lectura del JWKS para respetar cancelaciones.
+func (v *Validator) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if v.requireKID {
+			if kid, _ := token.Header["kid"].(string); kid == "" {
+				return nil, ErrMissingKID
+			}
+		}
+
+		// Tokens de desarrollo firmados con la clave simétrica (si está configurada).
+		if v.symmetricKey != nil && token.Method.Alg() == v.symmetricAlg {
+			return v.symmetricKey, nil
+		}
+
+		var err error
+		for _, jwks := range v.keySets() {
+			var key interface{}
+			key, err = jwks.KeyfuncCtx(ctx)(token)
+			if err == nil {
+				return key, nil
+			}
+		}
+		// Sin ninguna clave cargada el fallo no es del token, sino de la fuente de claves.
+		if !v.hasKeys(ctx) {
+			return nil, fmt.Errorf("%w: %w", ErrKeySourceUnavailable, errors.Join(err, v.refreshStatus.join()))
+		}
+		// Con claves cargadas, el `kid` es desconocido: puede que el JWKS se haya movido.
+		if v.discovery != nil {
+			v.discovery.requestRefresh()
+		}
+		return nil, err
 	}
-	return v.jwksV1.Keyfunc(token)
 }
 
 // buildUserClaims construye la struct UserClaims a partir del mapa de notificaciones crudas.
 // Esta función está diseñada para manejar de forma segura las diferencias entre los tokens
 // de usuario (delegados) y los tokens de aplicación (client credentials).
-func (v *Validator) buildUserClaims(mapClaims jwt.MapClaims) *UserClaims {
+func buildUserClaims(mapClaims jwt.MapClaims) *UserClaims {
 	aud, _ := mapClaims.GetAudience()
 	iss, _ := mapClaims.GetIssuer()
 	sub, _ := mapClaims.GetSubject()
+	exp, _ := mapClaims.GetExpirationTime()
+	iat, _ := mapClaims.GetIssuedAt()
 
 	// Extracción segura de roles (típicamente para tokens de aplicación).
-	var roles []string
-	if rolesClaim, ok := mapClaims["roles"]; ok {
-		if rolesInterfaces, ok := rolesClaim.([]interface{}); ok {
-			for _, roleInterface := range rolesInterfaces {
-				if role, ok := roleInterface.(string); ok {
-					roles = append(roles, role)
-				}
-			}
-		}
-	}
+	roles, _ := toStringSlice(mapClaims["roles"])
+	groups, _ := toStringSlice(mapClaims["groups"])
+	amr, _ := toStringSlice(mapClaims["amr"])
 
 	// Extracción segura de otros campos. Se utilizan aserciones de tipo seguras
 	// porque estos claims pueden no estar presentes en todos los tipos de token.
@@ -262,33 +1469,116 @@ func (v *Validator) buildUserClaims(mapClaims jwt.MapClaims) *UserClaims {
 	name, _ := mapClaims["name"].(string)
 	preferredUser, _ := mapClaims["preferred_username"].(string)
 	tenantID, _ := mapClaims["tid"].(string)
+	objectID, _ := mapClaims["oid"].(string)
 	scopes, _ := mapClaims["scp"].(string)
+	acr, _ := mapClaims["acr"].(string)
+	capabilities := clientCapabilities(mapClaims)
 
 	return &UserClaims{
-		Subject:       sub,
-		Name:          name,
-		PreferredUser: preferredUser,
-		TenantID:      tenantID,
-		Audience:      aud,
-		Issuer:        iss,
-		Scopes:        scopes,
-		Roles:         roles,
-		RawClaims:     mapClaims,
+		Subject:            sub,
+		ObjectID:           objectID,
+		Name:               name,
+		PreferredUser:      preferredUser,
+		TenantID:           tenantID,
+		Audience:           aud,
+		Issuer:             iss,
+		Scopes:             scopes,
+		Roles:              roles,
+		Groups:             groups,
+		GroupsOverflowed:   hasGroupsOverage(mapClaims),
+		ClientAppID:        clientAppID(mapClaims),
+		AppIDACR:           appAuthLevel(mapClaims),
+		TokenType:          tokenType(mapClaims),
+		Acr:                acr,
+		Amr:                amr,
+		ClientCapabilities: capabilities,
+		CAEEnabled:         supportsCAE(capabilities),
+		ExpiresAt:          numericDateTime(exp),
+		IssuedAt:           numericDateTime(iat),
+		RawClaims:          mapClaims,
 	}
 }
 
 // audiencesIntersect verifica si alguna de las audiencias del token es válida.
+// El App ID (GUID) y el App ID URI `api://{guid}` se consideran la misma audiencia, ya que
+// Azure puede emitir cualquiera de las dos formas según cómo se solicitó el token. Una audiencia
+// vacía nunca coincide, aunque se haya configurado una por error (p. ej. una variable sin definir).
 func audiencesIntersect(validAudiences []string, tokenAudiences jwt.ClaimStrings) bool {
 	for _, tokenAud := range tokenAudiences {
-		if slices.Contains(validAudiences, tokenAud) {
-			return true
+		if tokenAud == "" {
+			continue
+		}
+		for _, validAud := range validAudiences {
+			if audienceMatches(validAud, tokenAud) {
+				return true
+			}
 		}
 	}
 	return false
 }
 
+// appIDURIPrefix es el prefijo del App ID URI por defecto de una aplicación de Azure AD.
+const appIDURIPrefix = "api://"
+
+// audienceMatches compara dos audiencias tratando `{guid}` y `api://{guid}` como equivalentes.
+func audienceMatches(a, b string) bool {
+	return a == b || isAppIDURIOf(a, b) || isAppIDURIOf(b, a)
+}
+
+// isAppIDURIOf indica si uri es el App ID URI `api://{guid}` del App ID indicado.
+func isAppIDURIOf(uri, appID string) bool {
+	id, ok := strings.CutPrefix(uri, appIDURIPrefix)
+	return ok && isGUID(appID) && strings.EqualFold(id, appID)
+}
+
+// isGUID indica si s tiene el formato de un GUID (8-4-4-4-12 dígitos hexadecimales).
+func isGUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // GetClaimsFromContext recupera las notificaciones del usuario del contexto de una manera segura.
 func GetClaimsFromContext(ctx context.Context) (*UserClaims, bool) {
 	claims, ok := ctx.Value(userClaimsKey{}).(*UserClaims)
 	return claims, ok
 }
+
+// NewContextWithClaims devuelve un contexto con los claims indicados, accesibles con
+// GetClaimsFromContext y los middlewares Require*. Es el inverso de GetClaimsFromContext y permite
+// probar la lógica de autorización con UserClaims construidos a mano, sin JWKS ni tokens firmados.
+func NewContextWithClaims(ctx context.Context, claims *UserClaims) context.Context {
+	return context.WithValue(ctx, userClaimsKey{}, claims)
+}
+
+// GetTokenFromContext recupera el token original (JWT sin procesar) validado por Middleware,
+// p. ej. para reenviarlo a otra API mediante el flujo on-behalf-of.
+func GetTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(rawTokenKey{}).(string)
+	return token, ok
+}
+
+// injectClaims devuelve un contexto con los claims validados, usando el inyector de
+// WithContextInjector si está configurado, y el token del que proceden.
+func (v *Validator) injectClaims(ctx context.Context, claims *UserClaims, token string) context.Context {
+	claims = v.restrictRawClaims(claims)
+	if v.contextInjector != nil {
+		ctx = v.contextInjector(ctx, claims)
+	} else {
+		ctx = NewContextWithClaims(ctx, claims)
+	}
+	return context.WithValue(ctx, rawTokenKey{}, token)
+}
@@ -0,0 +1,990 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const (
+	// testTenantID es el inquilino de los tokens de prueba.
+	testTenantID = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+	// testAudience es la audiencia de los tokens de prueba.
+	testAudience = "api://jwtazure-test"
+)
+
+// newTestValidator crea un Validator que obtiene las claves de un jwtazuretest.KeySet, con la
+// audiencia de pruebas y sin logs. Las opciones indicadas se aplican tras las de por defecto.
+func newTestValidator(t testing.TB, opts ...Option) (*Validator, *jwtazuretest.KeySet) {
+	t.Helper()
+
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	v, err := NewValidator(context.Background(), testTenantID, append([]Option{
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	return v, keySet
+}
+
+// testToken firma un token válido del inquilino y la audiencia de pruebas, tras aplicar mutate
+// a sus claims.
+func testToken(keySet *jwtazuretest.KeySet, mutate ...func(jwt.MapClaims)) string {
+	claims := jwtazuretest.Claims(testTenantID, testAudience)
+	for _, fn := range mutate {
+		fn(claims)
+	}
+	return keySet.Sign(claims)
+}
+
+// withClaim devuelve un mutador de testToken que fija el claim indicado.
+func withClaim(key string, value any) func(jwt.MapClaims) {
+	return func(claims jwt.MapClaims) {
+		claims[key] = value
+	}
+}
+
+// serve envía a handler una petición GET con el token como Bearer (sin cabecera si está vacío).
+func serve(handler http.Handler, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// okHandler responde 200 a cualquier petición.
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// BenchmarkValidateMalformed mide el rechazo de tokens mal formados: los que no tienen tres
+// segmentos se descartan antes de invocar al parser, a diferencia de los que sí los tienen.
+func BenchmarkValidateMalformed(b *testing.B) {
+	v, _ := newTestValidator(b)
+	ctx := context.Background()
+
+	for _, bm := range []struct {
+		name  string
+		token string
+	}{
+		{name: "fast path/no dots", token: strings.Repeat("x", 1200)},
+		{name: "fast path/four parts", token: "eyJhbGciOiJSUzI1NiJ9.e30.c2ln.extra"},
+		{name: "parser/three segments", token: "eyJhbGciOiJSUzI1NiJ9." + strings.Repeat("x", 1200) + ".c2ln"},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := v.Validate(ctx, bm.token); err == nil {
+					b.Fatal("malformed token accepted")
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultLoggerShared(t *testing.T) {
+	_, keySet := newTestValidator(t)
+	newValidator := func() *Validator {
+		v, err := NewValidator(context.Background(), testTenantID,
+			WithAudiences(testAudience),
+			WithHTTPClient(keySet.HTTPClient()),
+		)
+		if err != nil {
+			t.Fatalf("NewValidator: %v", err)
+		}
+		t.Cleanup(func() { _ = v.Close() })
+		return v
+	}
+
+	first, second := newValidator(), newValidator()
+	if first.logger == nil || first.logger != second.logger || first.logger != defaultLogger() {
+		t.Fatal("validators without WithLogger must share the default logger")
+	}
+	if first.auditLogger != first.logger {
+		t.Fatal("the audit logger must default to the validator logger")
+	}
+}
+
+func TestWithNoOpLogger(t *testing.T) {
+	v, _ := newTestValidator(t)
+	if v.logger.Core().Enabled(zapcore.ErrorLevel) {
+		t.Fatal("WithNoOpLogger: logger is enabled")
+	}
+}
+
+func TestWithIssuers(t *testing.T) {
+	const customIssuer = "https://issuer.example.test/" + testTenantID + "/"
+	v, keySet := newTestValidator(t, WithIssuers(customIssuer))
+
+	if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("iss", customIssuer))); err != nil {
+		t.Fatalf("token from the custom issuer: %v", err)
+	}
+
+	// WithIssuers reemplaza los emisores por defecto del inquilino.
+	if _, err := v.Validate(context.Background(), testToken(keySet)); !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("token from the default issuer: got %v, want ErrInvalidIssuer", err)
+	}
+}
+
+func TestOptionsAreAdditive(t *testing.T) {
+	const issuerA, issuerB = "https://issuer-a.example", "https://issuer-b.example"
+	// newTestValidator ya configura testAudience; las opciones se suman a ella.
+	v, keySet := newTestValidator(t,
+		WithAudiences("api://second"),
+		WithIssuers(issuerA),
+		WithIssuers(issuerB),
+	)
+
+	tests := []struct {
+		name    string
+		mutate  []func(jwt.MapClaims)
+		wantErr error
+	}{
+		{name: "first audience", mutate: []func(jwt.MapClaims){withClaim("iss", issuerA)}},
+		{name: "second audience", mutate: []func(jwt.MapClaims){withClaim("iss", issuerA), withClaim("aud", "api://second")}},
+		{name: "second issuer", mutate: []func(jwt.MapClaims){withClaim("iss", issuerB)}},
+		{name: "unknown audience", mutate: []func(jwt.MapClaims){withClaim("iss", issuerA), withClaim("aud", "api://third")}, wantErr: ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithClockSkew(t *testing.T) {
+	expired := func(claims jwt.MapClaims) {
+		now := time.Now()
+		claims["iat"] = now.Add(-time.Hour).Unix()
+		claims["nbf"] = now.Add(-time.Hour).Unix()
+		claims["exp"] = now.Add(-3 * time.Second).Unix()
+	}
+
+	tests := []struct {
+		name    string
+		skew    time.Duration
+		wantErr bool
+	}{
+		{name: "5s skew", skew: 5 * time.Second},
+		{name: "no skew", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, WithClockSkew(tt.skew))
+			_, err := v.Validate(context.Background(), testToken(keySet, expired))
+			if tt.wantErr != errors.Is(err, jwt.ErrTokenExpired) {
+				t.Fatalf("token expired 3s ago: got %v, want expired: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("token expired 3s ago: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithLeewayForNbf(t *testing.T) {
+	v, keySet := newTestValidator(t, WithLeewayForNbf(time.Minute))
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		nbf     time.Time
+		exp     time.Time
+		wantErr error
+	}{
+		{name: "nbf within leeway", nbf: now.Add(30 * time.Second), exp: now.Add(time.Hour)},
+		{name: "nbf beyond leeway", nbf: now.Add(5 * time.Minute), exp: now.Add(time.Hour), wantErr: jwt.ErrTokenNotValidYet},
+		// La tolerancia de `nbf` no se aplica a `exp`.
+		{name: "expired", nbf: now.Add(-time.Hour), exp: now.Add(-3 * time.Second), wantErr: jwt.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := testToken(keySet, withClaim("nbf", tt.nbf.Unix()), withClaim("exp", tt.exp.Unix()))
+			if _, err := v.Validate(context.Background(), token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	other := jwtazuretest.NewKeySet()
+	t.Cleanup(other.Close)
+
+	claims, err := v.Validate(context.Background(), testToken(keySet))
+	if err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	if claims.TenantID != testTenantID || claims.Subject != "jwtazuretest-subject" {
+		t.Fatalf("claims = %+v, want the test tenant and subject", claims)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		token   string
+		wantErr error
+	}{
+		{name: "malformed", ctx: context.Background(), token: "not-a-jwt", wantErr: ErrTokenParsingFailed},
+		{name: "signed by another key", ctx: context.Background(), token: testToken(other), wantErr: ErrTokenParsingFailed},
+		{name: "wrong audience", ctx: context.Background(), token: testToken(keySet, withClaim("aud", "api://other")), wantErr: ErrInvalidAudience},
+		{name: "canceled context", ctx: canceled, token: testToken(keySet), wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(tt.ctx, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if claims != nil {
+				t.Fatal("claims returned for an invalid token")
+			}
+		})
+	}
+}
+
+func TestWithClaimsLogging(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantFields []string
+	}{
+		{name: "disabled", wantFields: []string{"subject", "tenant_id"}},
+		{name: "enabled", enabled: true, wantFields: []string{"claims"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			v, keySet := newTestValidator(t, WithLogger(zap.New(core)), WithClaimsLogging(tt.enabled))
+
+			if rec := serve(v.Middleware(okHandler), testToken(keySet)); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			loud := logs.Filter(func(e observer.LoggedEntry) bool { return e.Level >= zapcore.InfoLevel })
+			if loud.Len() != 0 {
+				t.Fatalf("entries logged at Info or above on success: %v", loud.All())
+			}
+			validated := logs.FilterMessage("Token validated").All()
+			if len(validated) != 1 || validated[0].Level != zapcore.DebugLevel {
+				t.Fatalf("Token validated entries = %v, want one at Debug", validated)
+			}
+			fields := validated[0].ContextMap()
+			if len(fields) != len(tt.wantFields) {
+				t.Fatalf("fields = %v, want only %v", fields, tt.wantFields)
+			}
+			for _, key := range tt.wantFields {
+				if _, ok := fields[key]; !ok {
+					t.Fatalf("fields = %v, missing %q", fields, key)
+				}
+			}
+		})
+	}
+}
+
+func TestWithAllowedAlgorithms(t *testing.T) {
+	key := newSigningKey(t, "ps256-key", jwt.SigningMethodPS256)
+	client := serveJWKS(t, key)
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "PS256 allowed", opts: []Option{WithAllowedAlgorithms("RS256", "PS256")}},
+		{name: "only RS256", opts: []Option{WithAllowedAlgorithms("RS256")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(context.Background(), testTenantID, append([]Option{
+				WithAudiences(testAudience),
+				WithHTTPClient(client),
+				WithNoOpLogger(),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			_, err = v.Validate(context.Background(), key.sign(t))
+			if tt.wantErr != errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+				t.Fatalf("PS256 token: got %v, want signature rejected: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("PS256 token: %v", err)
+			}
+		})
+	}
+
+	if _, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(client),
+		WithNoOpLogger(),
+		WithAllowedAlgorithms(),
+	); err == nil {
+		t.Fatal("NewValidator with no allowed algorithms: expected an error")
+	}
+}
+
+func TestNewB2CValidator(t *testing.T) {
+	const b2cIssuer = "https://contoso.b2clogin.com/contoso.onmicrosoft.com/v2.0/"
+
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	var requests requestLog
+
+	v, err := NewB2CValidator(context.Background(), "contoso", "B2C_1_signupsignin",
+		WithAudiences(testAudience),
+		WithHTTPClient(requests.client(keySet.HTTPClient())),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewB2CValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	got := requests.sorted()
+	wantURL := "https://contoso.b2clogin.com/contoso.onmicrosoft.com/B2C_1_signupsignin/discovery/v2.0/keys"
+	if !slices.Equal(got, []string{wantURL}) {
+		t.Fatalf("requested %v, want only %s", got, wantURL)
+	}
+	if got, want := v.authorizationEndpoint(), "https://contoso.b2clogin.com/contoso.onmicrosoft.com/B2C_1_signupsignin/oauth2/v2.0/authorize"; got != want {
+		t.Fatalf("authorization endpoint = %q, want %q", got, want)
+	}
+
+	claims, err := v.Validate(context.Background(), testToken(keySet,
+		withClaim("iss", b2cIssuer),
+		withClaim("scp", "tasks.read tasks.write"),
+		withClaim("name", "Contoso User"),
+	))
+	if err != nil {
+		t.Fatalf("B2C token: %v", err)
+	}
+	if claims.Issuer != b2cIssuer || claims.Scopes != "tasks.read tasks.write" || claims.Name != "Contoso User" {
+		t.Fatalf("claims = %+v, want the B2C issuer, scopes and name", claims)
+	}
+
+	if _, err := v.Validate(context.Background(), testToken(keySet)); !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("Azure AD token: got %v, want ErrInvalidIssuer", err)
+	}
+
+	for _, tt := range []struct{ tenant, policy string }{{"", "B2C_1_signin"}, {"contoso", ""}} {
+		if _, err := NewB2CValidator(context.Background(), tt.tenant, tt.policy); err == nil {
+			t.Fatalf("NewB2CValidator(%q, %q): expected an error", tt.tenant, tt.policy)
+		}
+	}
+}
+
+// otherTenantID es un segundo inquilino para las pruebas multi-inquilino.
+const otherTenantID = "f8cdef31-a31e-4b4a-93e4-5f571e91255a"
+
+// withTenant devuelve un mutador de testToken que emite el token desde el inquilino indicado.
+func withTenant(tenantID string) func(jwt.MapClaims) {
+	return func(claims jwt.MapClaims) {
+		claims["tid"] = tenantID
+		claims["iss"] = jwtazuretest.Claims(tenantID, testAudience)["iss"]
+	}
+}
+
+func TestWithAllowedTenants(t *testing.T) {
+	_, keySet := newTestValidator(t)
+	v, err := NewValidator(context.Background(), "organizations",
+		WithAllowedTenants(testTenantID, otherTenantID),
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	tests := []struct {
+		name    string
+		mutate  []func(jwt.MapClaims)
+		wantErr error
+	}{
+		{name: "allowed tenant"},
+		{name: "second allowed tenant", mutate: []func(jwt.MapClaims){withTenant(otherTenantID)}},
+		{
+			name:    "disallowed tenant",
+			mutate:  []func(jwt.MapClaims){withTenant("0b6a4b8e-5c4d-4f7a-9d1e-2a3b4c5d6e7f")},
+			wantErr: ErrTenantNotAllowed,
+		},
+		{
+			name:    "issuer of another tenant",
+			mutate:  []func(jwt.MapClaims){withTenant(otherTenantID), withClaim("tid", testTenantID)},
+			wantErr: ErrInvalidIssuer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims == nil {
+				t.Fatal("no claims returned for a valid token")
+			}
+		})
+	}
+}
+
+func TestWithTenantIDVerification(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  []func(jwt.MapClaims)
+		wantErr error
+	}{
+		{name: "matching tid"},
+		{name: "mismatching tid", mutate: []func(jwt.MapClaims){withClaim("tid", otherTenantID)}, wantErr: ErrTenantMismatch},
+		{name: "missing tid", mutate: []func(jwt.MapClaims){func(c jwt.MapClaims) { delete(c, "tid") }}, wantErr: ErrTenantMismatch},
+	}
+
+	v, keySet := newTestValidator(t, WithTenantIDVerification())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Sin la opción, un `tid` distinto del inquilino del emisor no se comprueba.
+	plain, keySet := newTestValidator(t)
+	if _, err := plain.Validate(context.Background(), testToken(keySet, withClaim("tid", otherTenantID))); err != nil {
+		t.Fatalf("mismatching tid without verification: %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	var requests atomic.Int32
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(countingClient(keySet.HTTPClient(), &requests)),
+		WithRefreshInterval(20*time.Millisecond),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	waitFor(t, "a background refresh", func() bool { return requests.Load() > 2 })
+
+	if err := v.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := v.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	// Una descarga en curso al cerrar puede terminar; después no debe haber más.
+	time.Sleep(50 * time.Millisecond)
+	after := requests.Load()
+	time.Sleep(200 * time.Millisecond)
+	if got := requests.Load(); got != after {
+		t.Fatalf("JWKS fetched %d more times after Close", got-after)
+	}
+
+	if _, err := v.Validate(context.Background(), testToken(keySet)); !errors.Is(err, ErrValidatorClosed) {
+		t.Fatalf("Validate after Close: got %v, want ErrValidatorClosed", err)
+	}
+	if rec := serve(v.Middleware(okHandler), testToken(keySet)); rec.Code == http.StatusOK {
+		t.Fatal("Middleware after Close: the request was accepted")
+	}
+}
+
+// appClaims es un struct de claims propio de una aplicación, para ValidateInto.
+type appClaims struct {
+	jwt.RegisteredClaims
+	Groups     []string `json:"groups"`
+	Department string   `json:"extension_department"`
+}
+
+func TestValidateInto(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	token := testToken(keySet,
+		withClaim("groups", []string{"admins", "readers"}),
+		withClaim("extension_department", "Finance"),
+	)
+
+	var dest appClaims
+	if err := ValidateInto(context.Background(), v, token, &dest); err != nil {
+		t.Fatalf("ValidateInto: %v", err)
+	}
+	if dest.Subject != "jwtazuretest-subject" || !slices.Equal(dest.Groups, []string{"admins", "readers"}) || dest.Department != "Finance" {
+		t.Fatalf("claims = %+v, want the token subject, groups and department", dest)
+	}
+
+	// Un token rechazado no rellena el destino.
+	var rejected appClaims
+	err := ValidateInto(context.Background(), v, testToken(keySet, withClaim("aud", "api://other")), &rejected)
+	if !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("ValidateInto with a wrong audience: got %v, want ErrInvalidAudience", err)
+	}
+	if rejected.Subject != "" || rejected.Groups != nil {
+		t.Fatalf("claims = %+v, want them untouched", rejected)
+	}
+}
+
+func TestWithRequiredClaims(t *testing.T) {
+	v, keySet := newTestValidator(t, WithRequiredClaims("oid", "app_role"))
+
+	tests := []struct {
+		name      string
+		mutate    []func(jwt.MapClaims)
+		wantClaim string
+	}{
+		{name: "present", mutate: []func(jwt.MapClaims){withClaim("app_role", "reader")}},
+		{name: "missing", wantClaim: "app_role"},
+		{name: "empty string", mutate: []func(jwt.MapClaims){withClaim("app_role", "")}, wantClaim: "app_role"},
+		{name: "empty array", mutate: []func(jwt.MapClaims){withClaim("app_role", []string{})}, wantClaim: "app_role"},
+		{
+			name:      "second claim missing",
+			mutate:    []func(jwt.MapClaims){withClaim("app_role", "reader"), withClaim("oid", "")},
+			wantClaim: "oid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if tt.wantClaim == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.Is(err, ErrMissingRequiredClaim) || !errors.As(err, &validationErr) || validationErr.Claim != tt.wantClaim {
+				t.Fatalf("got %v, want ErrMissingRequiredClaim naming %q", err, tt.wantClaim)
+			}
+		})
+	}
+}
+
+func TestWithClaimsBuilder(t *testing.T) {
+	builder := func(c jwt.MapClaims) *UserClaims {
+		sub, _ := c.GetSubject()
+		upn, _ := c["upn"].(string)
+		return &UserClaims{Subject: sub, PreferredUser: upn}
+	}
+	v, keySet := newTestValidator(t, WithClaimsBuilder(builder))
+
+	claims, err := v.Validate(context.Background(), testToken(keySet, withClaim("upn", "ada@contoso.com")))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if claims.PreferredUser != "ada@contoso.com" || claims.Subject != "jwtazuretest-subject" {
+		t.Fatalf("claims = %+v, want the upn as PreferredUser", claims)
+	}
+
+	// El constructor propio no evita las validaciones de emisor y audiencia.
+	if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("aud", "api://other"))); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("wrong audience: got %v, want ErrInvalidAudience", err)
+	}
+
+	// Sin la opción se usa el constructor por defecto, que no lee `upn`.
+	plain, keySet := newTestValidator(t)
+	claims, err = plain.Validate(context.Background(), testToken(keySet, withClaim("upn", "ada@contoso.com")))
+	if err != nil {
+		t.Fatalf("Validate with the default builder: %v", err)
+	}
+	if claims.PreferredUser == "ada@contoso.com" || claims.TenantID != testTenantID {
+		t.Fatalf("claims = %+v, want the default mapping", claims)
+	}
+}
+
+// v1Token es un mutador de testToken que convierte el token en uno v1.0 (emisor sts.windows.net).
+func v1Token(claims jwt.MapClaims) {
+	claims["iss"] = "https://sts.windows.net/" + testTenantID + "/"
+	claims["ver"] = "1.0"
+}
+
+func TestWithAllowedClientApps(t *testing.T) {
+	const allowedApp, otherApp = "11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222"
+	v, keySet := newTestValidator(t, WithAllowedClientApps(allowedApp))
+
+	tests := []struct {
+		name    string
+		mutate  []func(jwt.MapClaims)
+		wantErr bool
+	}{
+		{name: "v2 azp allowed", mutate: []func(jwt.MapClaims){withClaim("azp", allowedApp)}},
+		{name: "v1 appid allowed", mutate: []func(jwt.MapClaims){v1Token, withClaim("appid", allowedApp)}},
+		{name: "v2 azp not allowed", mutate: []func(jwt.MapClaims){withClaim("azp", otherApp)}, wantErr: true},
+		{name: "v1 appid not allowed", mutate: []func(jwt.MapClaims){v1Token, withClaim("appid", otherApp)}, wantErr: true},
+		{name: "no client app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidClientApp) {
+					t.Fatalf("got %v, want ErrInvalidClientApp", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if claims.ClientAppID != allowedApp {
+				t.Fatalf("ClientAppID = %q, want %q", claims.ClientAppID, allowedApp)
+			}
+		})
+	}
+}
+
+func TestWithRequiredTokenVersion(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	tests := []struct {
+		version   string
+		wantJWKS  []string
+		acceptsV1 bool
+		acceptsV2 bool
+	}{
+		{
+			version:   "2.0",
+			wantJWKS:  []string{"https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys"},
+			acceptsV2: true,
+		},
+		{
+			version: "1.0",
+			wantJWKS: []string{
+				"https://login.microsoftonline.com/" + testTenantID + "/discovery/keys",
+				"https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys",
+			},
+			acceptsV1: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			var requests requestLog
+			v, err := NewValidator(context.Background(), testTenantID,
+				WithAudiences(testAudience),
+				WithHTTPClient(requests.client(keySet.HTTPClient())),
+				WithNoOpLogger(),
+				WithRequiredTokenVersion(tt.version),
+			)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			if got := requests.sorted(); !slices.Equal(got, tt.wantJWKS) {
+				t.Fatalf("requested %v, want %v", got, tt.wantJWKS)
+			}
+
+			for _, token := range []struct {
+				ver    string
+				token  string
+				accept bool
+			}{
+				{ver: "1.0", token: testToken(keySet, v1Token), accept: tt.acceptsV1},
+				{ver: "2.0", token: testToken(keySet), accept: tt.acceptsV2},
+			} {
+				_, err := v.Validate(context.Background(), token.token)
+				if token.accept && err != nil {
+					t.Fatalf("ver=%s token: %v", token.ver, err)
+				}
+				if !token.accept && !errors.Is(err, ErrUnsupportedTokenVersion) {
+					t.Fatalf("ver=%s token: got %v, want ErrUnsupportedTokenVersion", token.ver, err)
+				}
+			}
+		})
+	}
+
+	if _, err := NewValidator(context.Background(), testTenantID, WithRequiredTokenVersion("3.0")); err == nil {
+		t.Fatal("NewValidator with an unknown version: expected an error")
+	}
+}
+
+// useChain aplica middlewares en el orden de registro, como router.Use en chi o gorilla/mux.
+func useChain(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+func TestHandler(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	var subject string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orders", func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := GetClaimsFromContext(r.Context())
+		subject = claims.Subject
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for name, handler := range map[string]http.Handler{
+		"Handler":        useChain(mux, v.Handler()),
+		"MiddlewareFunc": v.MiddlewareFunc(mux.ServeHTTP),
+	} {
+		t.Run(name, func(t *testing.T) {
+			subject = ""
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.Header.Set("Authorization", "Bearer "+testToken(keySet))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || subject != "jwtazuretest-subject" {
+				t.Fatalf("status = %d, subject = %q; want 200 with the token claims", rec.Code, subject)
+			}
+
+			if rec := serve(handler, ""); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("no token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestGetTokenFromContext(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	token := testToken(keySet)
+
+	var got string
+	var found bool
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, found = GetTokenFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	if rec := serve(handler, token); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !found || got != token {
+		t.Fatalf("GetTokenFromContext = %q, %t; want the request token", got, found)
+	}
+
+	if got, ok := GetTokenFromContext(context.Background()); ok || got != "" {
+		t.Fatalf("GetTokenFromContext without a token = %q, %t; want \"\", false", got, ok)
+	}
+}
+
+// appPrincipalKey es la clave de contexto propia de la aplicación en TestWithContextInjector.
+type appPrincipalKey struct{}
+
+func TestWithContextInjector(t *testing.T) {
+	v, keySet := newTestValidator(t, WithContextInjector(func(ctx context.Context, claims *UserClaims) context.Context {
+		return context.WithValue(ctx, appPrincipalKey{}, claims.Subject)
+	}))
+
+	var principal string
+	var defaultFound bool
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = r.Context().Value(appPrincipalKey{}).(string)
+		_, defaultFound = GetClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	if rec := serve(handler, testToken(keySet)); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if principal != "jwtazuretest-subject" {
+		t.Fatalf("principal under the custom key = %q, want the token subject", principal)
+	}
+	// El inyector reemplaza al almacenamiento por defecto.
+	if defaultFound {
+		t.Fatal("GetClaimsFromContext found claims with a custom injector")
+	}
+}
+
+func TestOptionalMiddleware(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantClaims bool
+	}{
+		{name: "no token", wantStatus: http.StatusOK},
+		{name: "valid token", token: testToken(keySet), wantStatus: http.StatusOK, wantClaims: true},
+		{name: "invalid token", token: testToken(keySet, expiredClaims), wantStatus: http.StatusUnauthorized},
+		{name: "malformed token", token: "not-a-jwt", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotClaims bool
+			handler := v.OptionalMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, gotClaims = GetClaimsFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			if rec := serve(handler, tt.token); rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if gotClaims != tt.wantClaims {
+				t.Fatalf("claims in context = %t, want %t", gotClaims, tt.wantClaims)
+			}
+		})
+	}
+}
+
+func TestWithClaimsValidator(t *testing.T) {
+	errV1Rejected := errors.New("v1.0 tokens are not accepted")
+	var calls atomic.Int32
+	v, keySet := newTestValidator(t, WithClaimsValidator(func(claims jwt.MapClaims) error {
+		calls.Add(1)
+		if claims["ver"] == "1.0" {
+			return errV1Rejected
+		}
+		return nil
+	}))
+
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("v2.0 token: %v", err)
+	}
+
+	_, err := v.Validate(context.Background(), testToken(keySet, v1Token))
+	if !errors.Is(err, ErrClaimsRejected) || !errors.Is(err, errV1Rejected) {
+		t.Fatalf("v1.0 token: got %v, want ErrClaimsRejected wrapping the hook error", err)
+	}
+
+	// La regla se ejecuta después de las comprobaciones estándar.
+	calls.Store(0)
+	if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("iss", "https://evil.example"))); !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("foreign issuer: got %v, want ErrInvalidIssuer", err)
+	}
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("the hook ran %d times for a token with an invalid issuer", got)
+	}
+}
+
+func TestWithNameLogField(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	v, keySet := newTestValidator(t, WithName("orders-api"), WithLogger(zap.New(core)))
+
+	serve(v.Middleware(okHandler), testToken(keySet))
+	serve(v.Middleware(okHandler), testToken(keySet, withClaim("aud", "api://other")))
+
+	if logs.Len() == 0 {
+		t.Fatal("no entries logged")
+	}
+	for _, entry := range logs.All() {
+		if got := entry.ContextMap()["validator"]; got != "orders-api" {
+			t.Errorf("%q: validator = %v, want orders-api", entry.Message, got)
+		}
+	}
+}
+
+func TestWithExpiryGrace(t *testing.T) {
+	v, keySet := newTestValidator(t, WithExpiryGrace(10*time.Minute))
+	expiredAgo := func(d time.Duration) func(jwt.MapClaims) {
+		return func(claims jwt.MapClaims) {
+			now := time.Now()
+			claims["iat"] = now.Add(-time.Hour).Unix()
+			claims["nbf"] = now.Add(-time.Hour).Unix()
+			claims["exp"] = now.Add(-d).Unix()
+		}
+	}
+
+	tests := []struct {
+		name        string
+		mutate      []func(jwt.MapClaims)
+		wantExpired bool
+		wantErr     error
+	}{
+		{name: "not expired"},
+		{name: "within grace", mutate: []func(jwt.MapClaims){expiredAgo(5 * time.Minute)}, wantExpired: true},
+		{name: "beyond grace", mutate: []func(jwt.MapClaims){expiredAgo(20 * time.Minute)}, wantErr: jwt.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if claims.Expired != tt.wantExpired {
+				t.Fatalf("Expired = %t, want %t", claims.Expired, tt.wantExpired)
+			}
+			// ExpiredBy se mide desde `exp` (que tiene resolución de segundos).
+			if tt.wantExpired && (claims.ExpiredBy < 5*time.Minute || claims.ExpiredBy > 6*time.Minute) {
+				t.Fatalf("ExpiredBy = %v, want about 5m", claims.ExpiredBy)
+			}
+			if !tt.wantExpired && claims.ExpiredBy != 0 {
+				t.Fatalf("ExpiredBy = %v, want 0", claims.ExpiredBy)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithoutAudience(t *testing.T) {
+	v, keySet := newTestValidator(t, WithResultCache(16))
+	strict := v.Middleware(okHandler)
+	lenient := v.MiddlewareWithoutAudience(okHandler)
+	foreign := testToken(keySet, withClaim("aud", "api://other"))
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		token   string
+		want    int
+	}{
+		{name: "lenient/foreign audience", handler: lenient, token: foreign, want: http.StatusOK},
+		// El resultado cacheado por la ruta permisiva no amplía la estricta.
+		{name: "strict/foreign audience", handler: strict, token: foreign, want: http.StatusUnauthorized},
+		{name: "strict/own audience", handler: strict, token: testToken(keySet), want: http.StatusOK},
+		{name: "lenient/expired", handler: lenient, token: testToken(keySet, expiredClaims), want: http.StatusUnauthorized},
+		{name: "lenient/no token", handler: lenient, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(tt.handler, tt.token).Code; got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
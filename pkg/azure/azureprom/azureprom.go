@@ -0,0 +1,55 @@
+// Package azureprom implementa azure.MetricsRecorder sobre Prometheus. Vive en un
+// subpaquete para que quien no use Prometheus no tenga que importarlo.
+package azureprom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder registra los resultados de validación como métricas de Prometheus:
+//   - jwt_validation_total{validator="...",result="..."}: contador de validaciones por resultado.
+//   - jwt_validation_duration_seconds{validator="...",result="..."}: histograma de la latencia de validación.
+//
+// La etiqueta validator es el nombre configurado con azure.WithName, vacía si no se indicó.
+type Recorder struct {
+	validations *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+}
+
+// NewRecorder crea un Recorder y registra sus métricas en el registerer indicado.
+func NewRecorder(registerer prometheus.Registerer) (*Recorder, error) {
+	recorder := &Recorder{
+		validations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jwt_validation_total",
+			Help: "Total de validaciones de tokens JWT por resultado.",
+		}, []string{"validator", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jwt_validation_duration_seconds",
+			Help:    "Latencia de la validación de tokens JWT en segundos.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"validator", "result"}),
+	}
+
+	if err := registerer.Register(recorder.validations); err != nil {
+		return nil, fmt.Errorf("fallo al registrar jwt_validation_total: %w", err)
+	}
+	if err := registerer.Register(recorder.duration); err != nil {
+		return nil, fmt.Errorf("fallo al registrar jwt_validation_duration_seconds: %w", err)
+	}
+
+	return recorder, nil
+}
+
+// ObserveValidation implementa azure.MetricsRecorder.
+func (r *Recorder) ObserveValidation(result string, duration time.Duration) {
+	r.ObserveNamedValidation("", result, duration)
+}
+
+// ObserveNamedValidation implementa azure.NamedMetricsRecorder.
+func (r *Recorder) ObserveNamedValidation(validator, result string, duration time.Duration) {
+	r.validations.WithLabelValues(validator, result).Inc()
+	r.duration.WithLabelValues(validator, result).Observe(duration.Seconds())
+}
@@ -0,0 +1,79 @@
+package azureprom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/norlis/jwtazure/pkg/azure"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sample devuelve el valor del contador y el número de observaciones del histograma con las
+// etiquetas indicadas, o ceros si la serie no existe.
+func sample(t *testing.T, registry *prometheus.Registry, validator, result string) (count float64, observations uint64) {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["validator"] != validator || labels["result"] != result {
+				continue
+			}
+			switch family.GetName() {
+			case "jwt_validation_total":
+				count = metric.GetCounter().GetValue()
+			case "jwt_validation_duration_seconds":
+				observations = metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return count, observations
+}
+
+func TestRecorder(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	recorder, err := NewRecorder(registry)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+
+	recorder.ObserveValidation(azure.ResultSuccess, 2*time.Millisecond)
+	recorder.ObserveValidation(azure.ResultSuccess, 3*time.Millisecond)
+	recorder.ObserveValidation(azure.ResultExpired, time.Millisecond)
+	recorder.ObserveNamedValidation("orders-api", azure.ResultBadAudience, time.Millisecond)
+
+	tests := []struct {
+		validator string
+		result    string
+		want      uint64
+	}{
+		{result: azure.ResultSuccess, want: 2},
+		{result: azure.ResultExpired, want: 1},
+		{result: azure.ResultBadAudience},
+		{validator: "orders-api", result: azure.ResultBadAudience, want: 1},
+	}
+	for _, tt := range tests {
+		count, observations := sample(t, registry, tt.validator, tt.result)
+		if count != float64(tt.want) || observations != tt.want {
+			t.Errorf("validator=%q result=%q: total = %v, duration observations = %d; want %d",
+				tt.validator, tt.result, count, observations, tt.want)
+		}
+	}
+}
+
+func TestNewRecorderAlreadyRegistered(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := NewRecorder(registry); err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	if _, err := NewRecorder(registry); err == nil {
+		t.Fatal("NewRecorder on the same registry: expected an error")
+	}
+}
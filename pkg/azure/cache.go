@@ -0,0 +1,212 @@
+package azure
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// =============================================================================
+// Caché de Resultados
+// =============================================================================
+
+// tokenKey es la clave de caché de un token: su hash SHA-256, para no retener el token en memoria.
+type tokenKey [sha256.Size]byte
+
+// newTokenKey calcula la clave de caché de un token para una generación de la configuración
+// (ver SetIssuers), de modo que los resultados obtenidos con una configuración anterior no se
+// reutilicen aunque se guarden después de reemplazarla.
+func newTokenKey(tokenString string, generation uint64) tokenKey {
+	return hashToken(tokenString, generation)
+}
+
+// newNegativeKey calcula la clave de la caché negativa, que además distingue si la validación
+// comprobó la audiencia: con la comprobación activa un `aud` de tipo no válido rechaza el token,
+// y sin ella no, así que ese rechazo no debe reutilizarse en las rutas que la omiten.
+func newNegativeKey(tokenString string, generation uint64, audienceChecked bool) tokenKey {
+	return hashToken(tokenString, generation, audienceChecked)
+}
+
+// hashToken calcula el SHA-256 del token precedido de los valores indicados en binario.
+func hashToken(tokenString string, prefix ...any) tokenKey {
+	h := sha256.New()
+	for _, value := range prefix {
+		_ = binary.Write(h, binary.BigEndian, value)
+	}
+	h.Write([]byte(tokenString))
+
+	var key tokenKey
+	h.Sum(key[:0])
+	return key
+}
+
+// lruEntry es un elemento de lruCache con su instante de expiración.
+type lruEntry[V any] struct {
+	key       tokenKey
+	value     V
+	expiresAt time.Time
+}
+
+// lruCache es una caché LRU acotada y segura para uso concurrente, cuyas entradas expiran
+// en un instante determinado. Las entradas expiradas se eliminan al consultarlas y se
+// desalojan primero cuando la caché está llena.
+type lruCache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[tokenKey]*list.Element
+}
+
+// newLRUCache crea una caché con capacidad para size entradas.
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[tokenKey]*list.Element, size),
+	}
+}
+
+// get devuelve el valor asociado a la clave si existe y no ha expirado en now.
+func (c *lruCache[V]) get(key tokenKey, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := elem.Value.(*lruEntry[V])
+	if !now.Before(entry.expiresAt) {
+		c.remove(elem)
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// add guarda el valor hasta expiresAt, desalojando la entrada menos usada si la caché está llena.
+func (c *lruCache[V]) add(key tokenKey, value V, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*lruEntry[V])
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		c.evict(time.Now())
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, expiresAt: expiresAt})
+}
+
+// evict elimina las entradas expiradas y, si no había ninguna, la menos usada recientemente.
+func (c *lruCache[V]) evict(now time.Time) {
+	evicted := false
+	for elem := c.order.Back(); elem != nil; {
+		prev := elem.Prev()
+		if !now.Before(elem.Value.(*lruEntry[V]).expiresAt) {
+			c.remove(elem)
+			evicted = true
+		}
+		elem = prev
+	}
+
+	if !evicted {
+		if oldest := c.order.Back(); oldest != nil {
+			c.remove(oldest)
+		}
+	}
+}
+
+// purge elimina todas las entradas de la caché.
+func (c *lruCache[V]) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
+
+// remove elimina una entrada de la caché. Debe llamarse con el mutex adquirido.
+func (c *lruCache[V]) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry[V]).key)
+}
+
+// WithResultCache habilita una caché LRU en memoria de hasta size tokens ya validados, indexada
+// por el hash del token. Mientras el token no expire (`exp`), una nueva validación del mismo token
+// devuelve los claims cacheados sin volver a verificar la firma. Los tokens sin `exp` no se cachean.
+func WithResultCache(size int) Option {
+	return func(v *Validator) {
+		if size > 0 {
+			v.resultCache = newLRUCache[*UserClaims](size)
+		}
+	}
+}
+
+// WithNegativeCache habilita una caché LRU de hasta size tokens rechazados recientemente, indexada
+// por el hash del token: durante ttl, un token que ya falló se rechaza con el mismo error sin
+// volver a verificarlo, lo que abarata la repetición de tokens inválidos. No se cachean los fallos
+// transitorios o que dependen de la llamada (claves no disponibles, `kid` desconocido, audiencia,
+// nbf, contexto), y los rechazos con y sin comprobación de audiencia se guardan por separado.
+func WithNegativeCache(size int, ttl time.Duration) Option {
+	return func(v *Validator) {
+		if size > 0 && ttl > 0 {
+			v.negativeCache = newLRUCache[error](size)
+			v.negativeCacheTTL = ttl
+		}
+	}
+}
+
+// purgeCaches vacía las cachés de resultados y de rechazos, cuyas entradas dependen de la
+// configuración con la que se validaron.
+func (v *Validator) purgeCaches() {
+	if v.resultCache != nil {
+		v.resultCache.purge()
+	}
+	if v.negativeCache != nil {
+		v.negativeCache.purge()
+	}
+}
+
+// isCacheableFailure indica si un error de validación puede guardarse en la caché negativa:
+// solo los que se repetirían con el mismo token en cualquier llamada durante el TTL. Los fallos
+// al buscar la clave (`kid` desconocido) no se cachean: un refresco del JWKS tras una rotación
+// puede hacer válido el mismo token.
+func isCacheableFailure(err error) bool {
+	for _, transient := range []error{
+		ErrKeySourceUnavailable,
+		jwt.ErrTokenUnverifiable,
+		jwkset.ErrKeyNotFound,
+		keyfunc.ErrKeyfunc,
+		ErrValidatorClosed,
+		ErrGroupResolutionFailed,
+		ErrTokenRevoked,
+		ErrRevocationCheckFailed,
+		ErrInvalidAudience,
+		jwt.ErrTokenNotValidYet,
+		context.Canceled,
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, transient) {
+			return false
+		}
+	}
+	return true
+}
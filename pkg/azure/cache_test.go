@@ -0,0 +1,377 @@
+package azure
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// rotatingKeys es un JWKS con un `kid` propio que las pruebas pueden rotar.
+type rotatingKeys struct {
+	server *httptest.Server
+	keys   map[string]*rsa.PrivateKey
+	kid    atomic.Pointer[string]
+}
+
+// newRotatingKeys publica la primera de las claves kids y genera las demás para rotar a ellas.
+func newRotatingKeys(t *testing.T, kids ...string) *rotatingKeys {
+	t.Helper()
+
+	r := &rotatingKeys{keys: make(map[string]*rsa.PrivateKey, len(kids))}
+	for _, kid := range kids {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("rsa.GenerateKey: %v", err)
+		}
+		r.keys[kid] = key
+	}
+	r.rotate(kids[0])
+
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		kid := *r.kid.Load()
+		publicKey := r.keys[kid].PublicKey
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": jwt.SigningMethodRS256.Alg(),
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+// rotate publica la clave kid en lugar de la actual.
+func (r *rotatingKeys) rotate(kid string) {
+	r.kid.Store(&kid)
+}
+
+// sign firma claims de prueba válidos con la clave kid.
+func (r *rotatingKeys) sign(t *testing.T, kid string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtazuretest.Claims(testTenantID, testAudience))
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(r.keys[kid])
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+// httpClient devuelve un cliente que redirige cualquier petición al servidor del JWKS.
+func (r *rotatingKeys) httpClient() *http.Client {
+	return redirectClient(r.server.URL)
+}
+
+func TestNegativeCacheParsesOnce(t *testing.T) {
+	var calls atomic.Int32
+	errRejected := errors.New("rejected by policy")
+	v, keySet := newTestValidator(t,
+		WithNegativeCache(16, time.Hour),
+		WithClaimsValidator(func(jwt.MapClaims) error {
+			calls.Add(1)
+			return errRejected
+		}),
+	)
+	token := testToken(keySet)
+
+	for i := range 3 {
+		if _, err := v.Validate(context.Background(), token); !errors.Is(err, errRejected) {
+			t.Fatalf("Validate #%d: got %v, want the claims validator error", i+1, err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("the token was verified %d times, want 1", got)
+	}
+}
+
+func TestNegativeCacheSeparatesAudienceModes(t *testing.T) {
+	v, keySet := newTestValidator(t, WithNegativeCache(16, time.Hour))
+	// Un `aud` numérico solo es un error cuando se comprueba la audiencia.
+	token := testToken(keySet, withClaim("aud", 42))
+
+	if w := serve(v.Middleware(okHandler), token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Middleware: status %d, want 401", w.Code)
+	}
+	if w := serve(v.MiddlewareWithoutAudience(okHandler), token); w.Code != http.StatusOK {
+		t.Fatalf("MiddlewareWithoutAudience after Middleware: status %d, want 200", w.Code)
+	}
+
+	// En el orden inverso, el rechazo tampoco se pierde.
+	other := testToken(keySet, withClaim("aud", 42), withClaim("sub", "other"))
+	if w := serve(v.MiddlewareWithoutAudience(okHandler), other); w.Code != http.StatusOK {
+		t.Fatalf("MiddlewareWithoutAudience: status %d, want 200", w.Code)
+	}
+	if _, err := v.ValidateForAudience(context.Background(), other, testAudience); !errors.Is(err, ErrTokenParsingFailed) {
+		t.Fatalf("ValidateForAudience: got %v, want ErrTokenParsingFailed", err)
+	}
+	if w := serve(v.MiddlewareWithoutAudience(okHandler), other); w.Code != http.StatusOK {
+		t.Fatalf("MiddlewareWithoutAudience after ValidateForAudience: status %d, want 200", w.Code)
+	}
+}
+
+func TestNegativeCacheExpires(t *testing.T) {
+	var calls atomic.Int32
+	v, keySet := newTestValidator(t,
+		WithNegativeCache(16, 20*time.Millisecond),
+		WithClaimsValidator(func(jwt.MapClaims) error {
+			calls.Add(1)
+			return errors.New("rejected by policy")
+		}),
+	)
+	token := testToken(keySet)
+
+	_, _ = v.Validate(context.Background(), token)
+	time.Sleep(40 * time.Millisecond)
+	_, _ = v.Validate(context.Background(), token)
+
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("the token was verified %d times, want 2 after the TTL", got)
+	}
+}
+
+func TestNegativeCacheSkipsUnknownKID(t *testing.T) {
+	keys := newRotatingKeys(t, "key-a", "key-b")
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(keys.httpClient()),
+		WithNegativeCache(16, time.Hour),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	token := keys.sign(t, "key-b")
+	if _, err := v.Validate(context.Background(), token); !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		t.Fatalf("before the rotation: got %v, want jwt.ErrTokenUnverifiable", err)
+	}
+
+	keys.rotate("key-b")
+	if err := v.RefreshKeys(context.Background()); err != nil {
+		t.Fatalf("RefreshKeys: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), token); err != nil {
+		t.Fatalf("after the rotation: %v", err)
+	}
+}
+
+func TestIsCacheableFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w: %w", ErrTokenParsingFailed, jwt.ErrTokenSignatureInvalid), true},
+		{fmt.Errorf("%w: %w", ErrTokenParsingFailed, jwt.ErrTokenExpired), true},
+		{ErrInvalidIssuer, true},
+		{fmt.Errorf("%w: %w", ErrTokenParsingFailed, jwt.ErrTokenUnverifiable), false},
+		{fmt.Errorf("could not read JWK from storage: %w", jwkset.ErrKeyNotFound), false},
+		{fmt.Errorf("%w: %w", ErrKeySourceUnavailable, jwkset.ErrKeyNotFound), false},
+		{fmt.Errorf("%w: %w", ErrTokenParsingFailed, jwt.ErrTokenNotValidYet), false},
+		{ErrInvalidAudience, false},
+		{ErrTokenRevoked, false},
+		{ErrRevocationCheckFailed, false},
+		{ErrValidatorClosed, false},
+		{context.DeadlineExceeded, false},
+	}
+
+	for _, tt := range tests {
+		if got := isCacheableFailure(tt.err); got != tt.want {
+			t.Errorf("isCacheableFailure(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+// countingKeyfunc cuenta las búsquedas de clave del JWKS al que envuelve.
+type countingKeyfunc struct {
+	next  keyfunc.Keyfunc
+	calls *atomic.Int32
+}
+
+func (c countingKeyfunc) Keyfunc(token *jwt.Token) (any, error) {
+	return c.KeyfuncCtx(context.Background())(token)
+}
+
+func (c countingKeyfunc) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	c.calls.Add(1)
+	return c.next.KeyfuncCtx(ctx)
+}
+
+func (c countingKeyfunc) Storage() jwkset.Storage {
+	return c.next.Storage()
+}
+
+// countKeyLookups envuelve el JWKS v2 del validador y devuelve el contador de búsquedas de clave.
+func countKeyLookups(v *Validator) *atomic.Int32 {
+	calls := new(atomic.Int32)
+	v.jwksV2.mu.Lock()
+	v.jwksV2.current = countingKeyfunc{next: v.jwksV2.current, calls: calls}
+	v.jwksV2.mu.Unlock()
+	return calls
+}
+
+func TestResultCacheSkipsKeyfunc(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want int32
+	}{
+		{name: "with result cache", opts: []Option{WithResultCache(16)}, want: 1},
+		{name: "without result cache", want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, append([]Option{WithoutV1Endpoint()}, tt.opts...)...)
+			calls := countKeyLookups(v)
+			token := testToken(keySet)
+
+			for i := range 2 {
+				claims, err := v.Validate(context.Background(), token)
+				if err != nil {
+					t.Fatalf("Validate #%d: %v", i+1, err)
+				}
+				if claims.Subject != "jwtazuretest-subject" {
+					t.Fatalf("Validate #%d: Subject = %q", i+1, claims.Subject)
+				}
+			}
+			if got := calls.Load(); got != tt.want {
+				t.Fatalf("key lookups = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultCacheExpiredToken(t *testing.T) {
+	v, keySet := newTestValidator(t, WithoutV1Endpoint(), WithResultCache(16), WithClockSkew(time.Minute))
+	calls := countKeyLookups(v)
+
+	// Un token caducado dentro de la tolerancia de reloj es válido, pero no se cachea más allá
+	// de su `exp`.
+	token := testToken(keySet, withClaim("exp", time.Now().Add(-time.Second).Unix()))
+	for range 2 {
+		if _, err := v.Validate(context.Background(), token); err != nil {
+			t.Fatalf("Validate: %v", err)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("key lookups = %d, want 2", got)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	now := time.Now()
+	cache := newLRUCache[int](2)
+	key := func(s string) tokenKey { return newTokenKey(s, 0) }
+
+	cache.add(key("a"), 1, now.Add(time.Hour))
+	cache.add(key("b"), 2, now.Add(time.Hour))
+	if _, ok := cache.get(key("a"), now); !ok {
+		t.Fatal("a: missing")
+	}
+
+	// Con la caché llena se desaloja la entrada menos usada (b, ya que a se acaba de leer).
+	cache.add(key("c"), 3, now.Add(time.Hour))
+	if _, ok := cache.get(key("b"), now); ok {
+		t.Fatal("b: still cached after exceeding the size")
+	}
+	if len(cache.entries) != 2 || cache.order.Len() != 2 {
+		t.Fatalf("cache holds %d entries, want 2", len(cache.entries))
+	}
+
+	// Las entradas expiradas no se devuelven y se eliminan al consultarlas.
+	if _, ok := cache.get(key("a"), now.Add(2*time.Hour)); ok {
+		t.Fatal("a: returned after its expiry")
+	}
+	if _, ok := cache.entries[key("a")]; ok {
+		t.Fatal("a: not purged after its expiry")
+	}
+
+	// Con la caché llena, se desalojan antes las expiradas que la menos usada.
+	cache.add(key("d"), 4, now.Add(-time.Second))
+	cache.add(key("e"), 5, now.Add(time.Hour))
+	if _, ok := cache.get(key("c"), now); !ok {
+		t.Fatal("c: evicted while an expired entry was cached")
+	}
+}
+
+func BenchmarkValidateResultCache(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "no cache"},
+		{name: "result cache", opts: []Option{WithResultCache(1024)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			v, keySet := newTestValidator(b, bm.opts...)
+			token := testToken(keySet)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := v.Validate(ctx, token); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWithUnknownKIDRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantValid bool
+	}{
+		{name: "default", wantValid: true},
+		{name: "refresh on unknown kid", opts: []Option{WithUnknownKIDRefresh(time.Millisecond)}, wantValid: true},
+		{name: "disabled", opts: []Option{WithUnknownKIDRefresh(0)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newRotatingKeys(t, "key-a", "key-b")
+			v, err := NewValidator(context.Background(), testTenantID, append([]Option{
+				WithAudiences(testAudience),
+				WithHTTPClient(keys.httpClient()),
+				WithoutV1Endpoint(),
+				WithNoOpLogger(),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			// El `kid` nuevo solo aparece en el JWKS después de arrancar el validador.
+			keys.rotate("key-b")
+			_, err = v.Validate(context.Background(), keys.sign(t, "key-b"))
+			if tt.wantValid && err != nil {
+				t.Fatalf("Validate with the rotated kid: %v", err)
+			}
+			if !tt.wantValid && !errors.Is(err, jwt.ErrTokenUnverifiable) {
+				t.Fatalf("got %v, want jwt.ErrTokenUnverifiable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package azure
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/httpgate/pkg/kit/problem"
+)
+
+// =============================================================================
+// Continuous Access Evaluation (CAE)
+// =============================================================================
+
+// ErrInsufficientClaims indica que el token no satisface los claims exigidos por un desafío CAE.
+var ErrInsufficientClaims = errors.New("token does not satisfy the required claims")
+
+// caeCapability es la capacidad de cliente (`xms_cc`) con la que un cliente anuncia que
+// admite desafíos de claims de CAE.
+const caeCapability = "cp1"
+
+// bearerErrorInsufficientClaims es el código de error de Azure para un desafío de claims.
+const bearerErrorInsufficientClaims = "insufficient_claims"
+
+// clientCapabilities devuelve las capacidades anunciadas por el cliente en el claim `xms_cc`.
+func clientCapabilities(mapClaims jwt.MapClaims) []string {
+	capabilities, _ := toStringSlice(mapClaims["xms_cc"])
+	return capabilities
+}
+
+// RespondClaimsChallenge responde 401 con un desafío de claims de CAE: la cabecera
+// WWW-Authenticate incluye error="insufficient_claims" y el JSON de claims indicado codificado
+// en base64, para que un cliente con CAEEnabled obtenga un token nuevo que los satisfaga.
+// El parámetro authorization_uri es el endpoint de autorización del inquilino (o de la política
+// de B2C, o el del documento de descubrimiento); se omite si el documento no lo publica.
+// Solo tiene sentido para clientes que anuncian la capacidad (UserClaims.CAEEnabled).
+func (v *Validator) RespondClaimsChallenge(w http.ResponseWriter, r *http.Request, claimsJSON string) {
+	params := make([]string, 0, 4)
+	if v.realm != "" {
+		params = append(params, authParam("realm", v.realm))
+	}
+	if authorizationURL := v.authorizationEndpoint(); authorizationURL != "" {
+		params = append(params, authParam("authorization_uri", authorizationURL))
+	}
+	params = append(params,
+		authParam("error", bearerErrorInsufficientClaims),
+		authParam("claims", base64.StdEncoding.EncodeToString([]byte(claimsJSON))),
+	)
+	w.Header().Set("WWW-Authenticate", v.authScheme.name+" "+strings.Join(params, ", "))
+
+	problem.RespondError(w,
+		problem.FromError(
+			ErrInsufficientClaims,
+			http.StatusUnauthorized,
+			problem.WithInstance(r),
+			problem.WithType(v.problemType(ErrInsufficientClaims)),
+		),
+	)
+}
+
+// supportsCAE indica si las capacidades del cliente incluyen la de CAE.
+func supportsCAE(capabilities []string) bool {
+	return slices.Contains(capabilities, caeCapability)
+}
@@ -0,0 +1,79 @@
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClientCapabilities(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	tests := []struct {
+		name    string
+		xmsCC   any
+		want    []string
+		wantCAE bool
+	}{
+		{name: "cp1", xmsCC: []string{"cp1"}, want: []string{"cp1"}, wantCAE: true},
+		{name: "other capabilities", xmsCC: []string{"cp2"}, want: []string{"cp2"}},
+		{name: "absent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := testToken(keySet)
+			if tt.xmsCC != nil {
+				token = testToken(keySet, withClaim("xms_cc", tt.xmsCC))
+			}
+
+			claims, err := v.Validate(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !slices.Equal(claims.ClientCapabilities, tt.want) || claims.CAEEnabled != tt.wantCAE {
+				t.Fatalf("ClientCapabilities = %v, CAEEnabled = %t; want %v, %t", claims.ClientCapabilities, claims.CAEEnabled, tt.want, tt.wantCAE)
+			}
+		})
+	}
+}
+
+func TestRespondClaimsChallenge(t *testing.T) {
+	v, _ := newTestValidator(t)
+	const claimsJSON = `{"access_token":{"nbf":{"essential":true,"value":"1700000000"}}}`
+
+	rec := httptest.NewRecorder()
+	v.RespondClaimsChallenge(rec, httptest.NewRequest(http.MethodGet, "/", nil), claimsJSON)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	challenge := rec.Header().Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		t.Fatalf("WWW-Authenticate = %q, want the Bearer scheme", challenge)
+	}
+	for _, want := range []string{
+		`authorization_uri="https://login.microsoftonline.com/` + testTenantID + `/oauth2/v2.0/authorize"`,
+		`error="insufficient_claims"`,
+		`claims="` + base64.StdEncoding.EncodeToString([]byte(claimsJSON)) + `"`,
+	} {
+		if !strings.Contains(challenge, want) {
+			t.Fatalf("WWW-Authenticate = %q, missing %s", challenge, want)
+		}
+	}
+}
+
+func TestRespondClaimsChallengeAuthScheme(t *testing.T) {
+	v, _ := newTestValidator(t, WithAuthScheme("token"))
+
+	rec := httptest.NewRecorder()
+	v.RespondClaimsChallenge(rec, httptest.NewRequest(http.MethodGet, "/", nil), `{}`)
+
+	if got := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "token ") {
+		t.Fatalf("WWW-Authenticate = %q, want the configured scheme", got)
+	}
+}
@@ -0,0 +1,72 @@
+package azure
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// =============================================================================
+// Cabecera WWW-Authenticate (RFC 6750)
+// =============================================================================
+
+// Códigos de error de la cabecera WWW-Authenticate definidos en RFC 6750, sección 3.1.
+const (
+	bearerErrorInvalidRequest    = "invalid_request"
+	bearerErrorInvalidToken      = "invalid_token"
+	bearerErrorInsufficientScope = "insufficient_scope"
+)
+
+// WithRealm establece el parámetro `realm` de la cabecera WWW-Authenticate que acompaña a las
+// respuestas 401 y 403. Por defecto se omite.
+func WithRealm(realm string) Option {
+	return func(v *Validator) {
+		v.realm = realm
+	}
+}
+
+// setChallenge añade la cabecera WWW-Authenticate con el código de error indicado, anunciando el
+// esquema configurado (ver WithAuthScheme). Un código vacío corresponde a una petición sin
+// credenciales, que según la RFC no lleva error.
+func (v *Validator) setChallenge(w http.ResponseWriter, errCode string, err error, scopes []string) {
+	params := make([]string, 0, 4)
+	if v.realm != "" {
+		params = append(params, authParam("realm", v.realm))
+	}
+	if errCode != "" {
+		params = append(params, authParam("error", errCode))
+	}
+	if err != nil {
+		params = append(params, authParam("error_description", err.Error()))
+	}
+	if len(scopes) > 0 {
+		params = append(params, authParam("scope", strings.Join(scopes, " ")))
+	}
+
+	challenge := v.authScheme.name
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+}
+
+// extractionErrorCode devuelve el código de error RFC 6750 de un fallo al extraer el token:
+// ninguno si no se envió, invalid_request si el formato no es válido.
+func extractionErrorCode(err error) string {
+	if errors.Is(err, ErrMissingAuthHeader) {
+		return ""
+	}
+	return bearerErrorInvalidRequest
+}
+
+// authParam formatea un parámetro `name="value"`, descartando los caracteres que la RFC no
+// permite dentro de la cadena entrecomillada.
+func authParam(name, value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < 0x20 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, value)
+	return name + `="` + value + `"`
+}
@@ -0,0 +1,129 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWWWAuthenticate(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		header string
+		expire bool
+		want   string
+	}{
+		{
+			name: "missing token",
+			want: `Bearer`,
+		},
+		{
+			name: "missing token with realm",
+			opts: []Option{WithRealm("orders-api")},
+			want: `Bearer realm="orders-api"`,
+		},
+		{
+			name:   "malformed header",
+			header: "Basic dXNlcjpwYXNz",
+			want:   `Bearer error="invalid_request"`,
+		},
+		{
+			name:   "expired token",
+			opts:   []Option{WithRealm("orders-api")},
+			expire: true,
+			want:   `Bearer realm="orders-api", error="invalid_token", error_description="token is invalid (possibly expired or not yet active)"`,
+		},
+		{
+			name:   "expired token with detailed errors",
+			opts:   []Option{WithDetailedErrors()},
+			expire: true,
+			want:   `Bearer error="invalid_token", error_description="token is expired"`,
+		},
+		{
+			name: "custom scheme",
+			opts: []Option{WithAuthScheme("token"), WithRealm("orders-api")},
+			want: `token realm="orders-api"`,
+		},
+		{
+			name:   "schemeless token",
+			opts:   []Option{WithSchemelessToken()},
+			header: "Basic dXNlcjpwYXNz",
+			want:   `Bearer error="invalid_request"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, tt.opts...)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.expire {
+				req.Header.Set("Authorization", "Bearer "+testToken(keySet, expiredClaims))
+			}
+			rec := httptest.NewRecorder()
+			v.Middleware(okHandler).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.want {
+				t.Fatalf("WWW-Authenticate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthParam(t *testing.T) {
+	if got, want := authParam("error_description", "bad \"quote\" \\ and\nnewline ñ"), `error_description="bad quote  andnewline "`; got != want {
+		t.Fatalf("authParam = %s, want %s", got, want)
+	}
+}
+
+func TestInsufficientScopeChallenge(t *testing.T) {
+	v, keySet := newTestValidator(t, WithRealm("orders-api"))
+	token := testToken(keySet, withClaim("scp", "orders.read"), withClaim("roles", []string{"reader"}))
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		want       string
+	}{
+		{
+			name:       "missing scopes",
+			middleware: v.RequireScopes("orders.read", "orders.write", "orders.delete"),
+			want:       `Bearer realm="orders-api", error="insufficient_scope", error_description="token does not have the required scopes", scope="orders.write orders.delete"`,
+		},
+		{
+			name:       "missing all roles",
+			middleware: v.RequireAllRoles("reader", "writer"),
+			want:       `Bearer realm="orders-api", error="insufficient_scope", error_description="token does not have the required roles", scope="writer"`,
+		},
+		{
+			name:       "missing any role",
+			middleware: v.RequireAnyRole("writer", "admin"),
+			want:       `Bearer realm="orders-api", error="insufficient_scope", error_description="token does not have the required roles", scope="writer admin"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(chain(v, tt.middleware), token)
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.want {
+				t.Fatalf("WWW-Authenticate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Una petición autorizada no lleva la cabecera.
+	rec := serve(chain(v, v.RequireScopes("orders.read")), token)
+	if rec.Code != http.StatusOK || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Fatalf("authorized request: status = %d, WWW-Authenticate = %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
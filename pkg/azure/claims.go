@@ -0,0 +1,243 @@
+package azure
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// =============================================================================
+// Acceso Tipado a Claims
+// =============================================================================
+
+// clone devuelve una copia de los claims, para que los llamadores no compartan la instancia
+// guardada en la caché de resultados. Los slices y RawClaims se comparten, ya que no se modifican.
+func (c *UserClaims) clone() *UserClaims {
+	cp := *c
+	return &cp
+}
+
+// restrictRawClaims devuelve una copia de los claims con RawClaims limitado a los claims de
+// WithRawClaimsAllowlist, o los mismos claims si no se configuró.
+func (v *Validator) restrictRawClaims(claims *UserClaims) *UserClaims {
+	if v.rawClaimsAllowlist == nil {
+		return claims
+	}
+
+	restricted := claims.clone()
+	restricted.RawClaims = make(jwt.MapClaims, len(v.rawClaimsAllowlist))
+	for _, key := range v.rawClaimsAllowlist {
+		if value, ok := claims.RawClaims[key]; ok {
+			restricted.RawClaims[key] = value
+		}
+	}
+	return restricted
+}
+
+// ScopeList devuelve los scopes del claim `scp` como lista, descartando espacios sobrantes.
+// Devuelve un slice vacío para tokens sin scopes (p. ej. tokens de aplicación).
+func (c *UserClaims) ScopeList() []string {
+	if c == nil {
+		return nil
+	}
+
+	return strings.Fields(c.Scopes)
+}
+
+// HasRole indica si el token contiene el rol indicado. La comparación distingue mayúsculas,
+// igual que Azure con los roles de aplicación.
+func (c *UserClaims) HasRole(role string) bool {
+	if c == nil {
+		return false
+	}
+
+	return slices.Contains(c.Roles, role)
+}
+
+// HasScope indica si el claim `scp` del token contiene el scope indicado.
+func (c *UserClaims) HasScope(scope string) bool {
+	return slices.Contains(c.ScopeList(), scope)
+}
+
+// mfaAuthMethod es el valor de `amr` con el que Azure indica autenticación multifactor.
+const mfaAuthMethod = "mfa"
+
+// defaultMFAAcrValues son los valores de `acr` aceptados como MFA cuando no se indican otros.
+var defaultMFAAcrValues = []string{"1"}
+
+// HasMFA indica si el usuario se autenticó con MFA: el claim `amr` contiene "mfa" o el claim
+// `acr` es uno de los valores indicados (por defecto, "1").
+func (c *UserClaims) HasMFA(acrValues ...string) bool {
+	if c == nil {
+		return false
+	}
+	if slices.Contains(c.Amr, mfaAuthMethod) {
+		return true
+	}
+
+	if len(acrValues) == 0 {
+		acrValues = defaultMFAAcrValues
+	}
+	return c.Acr != "" && slices.Contains(acrValues, c.Acr)
+}
+
+// GetString devuelve el claim indicado de RawClaims si existe y es una cadena.
+func (c *UserClaims) GetString(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	value, ok := c.RawClaims[key].(string)
+	return value, ok
+}
+
+// GetStringSlice devuelve el claim indicado de RawClaims si existe y es un array.
+// Los elementos que no son cadenas se descartan, igual que al extraer los roles.
+func (c *UserClaims) GetStringSlice(key string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	return toStringSlice(c.RawClaims[key])
+}
+
+// GetTime devuelve el claim indicado de RawClaims interpretado como una fecha numérica
+// (segundos desde la época Unix), como `exp`, `iat` o `nbf`.
+func (c *UserClaims) GetTime(key string) (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+
+	return toTime(c.RawClaims[key])
+}
+
+// hasGroupsOverage detecta el "group overage" de Azure: cuando el usuario tiene demasiados grupos,
+// el token no incluye `groups` y en su lugar `_claim_names` apunta a una fuente en `_claim_sources`
+// (o, en el flujo implícito, aparece `hasgroups: true`).
+func hasGroupsOverage(mapClaims jwt.MapClaims) bool {
+	if claimNames, ok := mapClaims["_claim_names"].(map[string]interface{}); ok {
+		if _, ok := claimNames["groups"]; ok {
+			return true
+		}
+	}
+
+	hasGroups, _ := mapClaims["hasgroups"].(bool)
+	return hasGroups
+}
+
+// TokenType distingue los tokens de aplicación (client credentials) de los delegados (de usuario).
+type TokenType string
+
+const (
+	// TokenTypeApplication identifica un token de aplicación, sin usuario (client credentials).
+	TokenTypeApplication TokenType = "app"
+	// TokenTypeDelegated identifica un token emitido en nombre de un usuario.
+	TokenTypeDelegated TokenType = "user"
+)
+
+// tokenType determina el tipo de token a partir del claim opcional `idtyp` y, si no está
+// presente, por heurística: los tokens delegados llevan `scp` o datos del usuario
+// (`name`, `preferred_username`), mientras que los de aplicación no.
+func tokenType(mapClaims jwt.MapClaims) TokenType {
+	switch idtyp, _ := mapClaims["idtyp"].(string); idtyp {
+	case "app":
+		return TokenTypeApplication
+	case "user":
+		return TokenTypeDelegated
+	}
+
+	for _, key := range []string{"scp", "name", "preferred_username"} {
+		if !isEmptyClaim(mapClaims[key]) {
+			return TokenTypeDelegated
+		}
+	}
+
+	return TokenTypeApplication
+}
+
+// clientAppID devuelve el ID de la aplicación cliente que solicitó el token: `azp` en tokens
+// v2.0 y `appid` en tokens v1.0.
+func clientAppID(mapClaims jwt.MapClaims) string {
+	if azp, ok := mapClaims["azp"].(string); ok && azp != "" {
+		return azp
+	}
+
+	appID, _ := mapClaims["appid"].(string)
+	return appID
+}
+
+// isEmptyClaim indica si un claim está ausente o vacío (cadena, array u objeto sin elementos).
+func isEmptyClaim(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// toStringSlice convierte un claim de tipo array en un []string. El decodificador JSON entrega
+// los arrays como []interface{}, por lo que se usan aserciones de tipo seguras por elemento.
+func toStringSlice(value any) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values, true
+	default:
+		return nil, false
+	}
+}
+
+// numericDateTime convierte un claim de fecha de jwt/v5 en time.Time; nil se convierte en el valor cero.
+func numericDateTime(date *jwt.NumericDate) time.Time {
+	if date == nil {
+		return time.Time{}
+	}
+	return date.Time
+}
+
+// toTime convierte un claim numérico en time.Time. Por defecto el decodificador JSON entrega
+// los números como float64, pero también se aceptan json.Number y enteros.
+func toTime(value any) (time.Time, bool) {
+	var seconds float64
+	switch v := value.(type) {
+	case float64:
+		seconds = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = f
+	case int64:
+		seconds = float64(v)
+	case int:
+		seconds = float64(v)
+	default:
+		return time.Time{}, false
+	}
+
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, false
+	}
+
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)), true
+}
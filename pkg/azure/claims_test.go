@@ -0,0 +1,392 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rawClaims son los claims de las pruebas de los accesores, con los tipos que entrega el
+// decodificador JSON (los números llegan como float64 y los arrays como []interface{}).
+var rawClaims = jwt.MapClaims{
+	"name":   "Ada Lovelace",
+	"groups": []interface{}{"admins", 42, "readers"},
+	"exp":    float64(1700000000.5),
+	"iat":    json.Number("1700000000"),
+	"bad":    json.Number("soon"),
+	"count":  float64(3),
+	"flag":   true,
+}
+
+func TestGetString(t *testing.T) {
+	claims := &UserClaims{RawClaims: rawClaims}
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{key: "name", want: "Ada Lovelace", wantOK: true},
+		{key: "missing"},
+		{key: "count"},
+		{key: "groups"},
+	}
+
+	for _, tt := range tests {
+		got, ok := claims.GetString(tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("GetString(%q) = %q, %t; want %q, %t", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if got, ok := (*UserClaims)(nil).GetString("name"); got != "" || ok {
+		t.Errorf("nil GetString = %q, %t; want \"\", false", got, ok)
+	}
+}
+
+func TestGetStringSlice(t *testing.T) {
+	claims := &UserClaims{RawClaims: rawClaims}
+	tests := []struct {
+		key    string
+		want   []string
+		wantOK bool
+	}{
+		{key: "groups", want: []string{"admins", "readers"}, wantOK: true},
+		{key: "missing"},
+		{key: "name"},
+		{key: "count"},
+	}
+
+	for _, tt := range tests {
+		got, ok := claims.GetStringSlice(tt.key)
+		if !slices.Equal(got, tt.want) || ok != tt.wantOK {
+			t.Errorf("GetStringSlice(%q) = %v, %t; want %v, %t", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if got, ok := (*UserClaims)(nil).GetStringSlice("groups"); got != nil || ok {
+		t.Errorf("nil GetStringSlice = %v, %t; want nil, false", got, ok)
+	}
+}
+
+func TestGetTime(t *testing.T) {
+	claims := &UserClaims{RawClaims: rawClaims}
+	tests := []struct {
+		key    string
+		want   time.Time
+		wantOK bool
+	}{
+		{key: "exp", want: time.Unix(1700000000, 5e8), wantOK: true},
+		{key: "iat", want: time.Unix(1700000000, 0), wantOK: true},
+		{key: "count", want: time.Unix(3, 0), wantOK: true},
+		{key: "bad"},
+		{key: "missing"},
+		{key: "name"},
+		{key: "flag"},
+	}
+
+	for _, tt := range tests {
+		got, ok := claims.GetTime(tt.key)
+		if !got.Equal(tt.want) || ok != tt.wantOK {
+			t.Errorf("GetTime(%q) = %v, %t; want %v, %t", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if got, ok := (*UserClaims)(nil).GetTime("exp"); !got.IsZero() || ok {
+		t.Errorf("nil GetTime = %v, %t; want zero, false", got, ok)
+	}
+}
+
+func TestGetTimeFromValidatedToken(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	claims, err := v.Validate(context.Background(), testToken(keySet))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	exp, ok := claims.GetTime("exp")
+	if !ok || !exp.Equal(claims.ExpiresAt) {
+		t.Fatalf("GetTime(\"exp\") = %v, %t; want %v", exp, ok, claims.ExpiresAt)
+	}
+}
+
+func TestExpiresAtIssuedAt(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	iat := time.Now().Add(-time.Minute).Truncate(time.Second)
+	exp := iat.Add(time.Hour)
+
+	claims, err := v.Validate(context.Background(), testToken(keySet, withClaim("iat", iat.Unix()), withClaim("exp", exp.Unix())))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !claims.ExpiresAt.Equal(exp) || !claims.IssuedAt.Equal(iat) {
+		t.Fatalf("ExpiresAt = %v, IssuedAt = %v; want %v, %v", claims.ExpiresAt, claims.IssuedAt, exp, iat)
+	}
+
+	// Sin `exp` ni `iat`, los campos quedan a cero.
+	claims = buildUserClaims(jwt.MapClaims{"sub": "subject"})
+	if !claims.ExpiresAt.IsZero() || !claims.IssuedAt.IsZero() {
+		t.Fatalf("ExpiresAt = %v, IssuedAt = %v; want zero times", claims.ExpiresAt, claims.IssuedAt)
+	}
+}
+
+func TestScopeList(t *testing.T) {
+	tests := []struct {
+		name string
+		scp  string
+		want []string
+	}{
+		{name: "empty"},
+		{name: "only whitespace", scp: "   "},
+		{name: "single scope", scp: "tasks.read", want: []string{"tasks.read"}},
+		{name: "extra whitespace", scp: "  tasks.read \t tasks.write  ", want: []string{"tasks.read", "tasks.write"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &UserClaims{Scopes: tt.scp}
+			if got := claims.ScopeList(); !slices.Equal(got, tt.want) {
+				t.Fatalf("ScopeList() = %q, want %q", got, tt.want)
+			}
+			if claims.Scopes != tt.scp {
+				t.Fatalf("Scopes = %q, want the raw %q", claims.Scopes, tt.scp)
+			}
+		})
+	}
+
+	if got := (*UserClaims)(nil).ScopeList(); got != nil {
+		t.Fatalf("nil ScopeList() = %q, want nil", got)
+	}
+}
+
+func TestScopeListFromValidatedToken(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	claims, err := v.Validate(context.Background(), testToken(keySet, withClaim("scp", "tasks.read  tasks.write")))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got, want := claims.ScopeList(), []string{"tasks.read", "tasks.write"}; !slices.Equal(got, want) {
+		t.Fatalf("ScopeList() = %q, want %q", got, want)
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	claims := &UserClaims{Roles: []string{"Tasks.Admin", "Reader"}}
+	tests := []struct {
+		claims *UserClaims
+		role   string
+		want   bool
+	}{
+		{claims: claims, role: "Tasks.Admin", want: true},
+		{claims: claims, role: "tasks.admin"},
+		{claims: claims, role: "Writer"},
+		{claims: claims, role: ""},
+		{claims: &UserClaims{}, role: "Reader"},
+		{claims: nil, role: "Reader"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.claims.HasRole(tt.role); got != tt.want {
+			t.Errorf("HasRole(%q) on %+v = %t, want %t", tt.role, tt.claims, got, tt.want)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	claims := &UserClaims{Scopes: " tasks.read  tasks.write "}
+	tests := []struct {
+		claims *UserClaims
+		scope  string
+		want   bool
+	}{
+		{claims: claims, scope: "tasks.write", want: true},
+		{claims: claims, scope: "tasks"},
+		{claims: claims, scope: ""},
+		{claims: &UserClaims{}, scope: "tasks.read"},
+		{claims: nil, scope: "tasks.read"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.claims.HasScope(tt.scope); got != tt.want {
+			t.Errorf("HasScope(%q) on %+v = %t, want %t", tt.scope, tt.claims, got, tt.want)
+		}
+	}
+}
+
+func TestGroupsClaim(t *testing.T) {
+	overage := map[string]any{
+		"_claim_names":   map[string]any{"groups": "src1"},
+		"_claim_sources": map[string]any{"src1": map[string]any{"endpoint": "https://graph.microsoft.com/v1.0/users/x/getMemberObjects"}},
+	}
+
+	tests := []struct {
+		name         string
+		mutate       []func(jwt.MapClaims)
+		wantGroups   []string
+		wantOverflow bool
+	}{
+		{name: "no groups"},
+		{
+			name:       "groups array",
+			mutate:     []func(jwt.MapClaims){withClaim("groups", []string{"g1", "g2"})},
+			wantGroups: []string{"g1", "g2"},
+		},
+		{
+			name: "claim sources overage",
+			mutate: []func(jwt.MapClaims){func(c jwt.MapClaims) {
+				for k, v := range overage {
+					c[k] = v
+				}
+			}},
+			wantOverflow: true,
+		},
+		{name: "hasgroups overage", mutate: []func(jwt.MapClaims){withClaim("hasgroups", true)}, wantOverflow: true},
+	}
+
+	v, keySet := newTestValidator(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !slices.Equal(claims.Groups, tt.wantGroups) || claims.GroupsOverflowed != tt.wantOverflow {
+				t.Fatalf("Groups = %q, GroupsOverflowed = %t; want %q, %t",
+					claims.Groups, claims.GroupsOverflowed, tt.wantGroups, tt.wantOverflow)
+			}
+		})
+	}
+}
+
+func TestWithGroupOverageResolver(t *testing.T) {
+	var calls []string
+	errGraph := errors.New("graph unavailable")
+	resolver := func(_ context.Context, claims *UserClaims) ([]string, error) {
+		calls = append(calls, claims.ObjectID)
+		if claims.ObjectID == "graph-down" {
+			return nil, errGraph
+		}
+		return []string{"resolved-1", "resolved-2"}, nil
+	}
+	v, keySet := newTestValidator(t, WithGroupOverageResolver(resolver))
+
+	claims, err := v.Validate(context.Background(), testToken(keySet, withClaim("hasgroups", true)))
+	if err != nil {
+		t.Fatalf("Validate with overage: %v", err)
+	}
+	if want := []string{"resolved-1", "resolved-2"}; !slices.Equal(claims.Groups, want) {
+		t.Fatalf("Groups = %q, want %q", claims.Groups, want)
+	}
+
+	// Sin overage el resolver no se invoca y se conservan los grupos del token.
+	claims, err = v.Validate(context.Background(), testToken(keySet, withClaim("groups", []string{"g1"})))
+	if err != nil {
+		t.Fatalf("Validate without overage: %v", err)
+	}
+	if !slices.Equal(claims.Groups, []string{"g1"}) || len(calls) != 1 {
+		t.Fatalf("Groups = %q after %d resolver calls, want [g1] after 1", claims.Groups, len(calls))
+	}
+
+	_, err = v.Validate(context.Background(), testToken(keySet, withClaim("hasgroups", true), withClaim("oid", "graph-down")))
+	if !errors.Is(err, ErrGroupResolutionFailed) || !errors.Is(err, errGraph) {
+		t.Fatalf("Validate with a failing resolver: got %v, want ErrGroupResolutionFailed", err)
+	}
+
+	// El middleware pide reintentar en lugar de rechazar el token.
+	rec := serve(v.Middleware(okHandler), testToken(keySet, withClaim("hasgroups", true), withClaim("oid", "graph-down")))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Middleware status = %d, Retry-After = %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if p := decodeProblem(t, rec.Body.Bytes()); p.Type != "urn:jwtazure:group-resolution-failed" {
+		t.Fatalf("problem type = %q, want urn:jwtazure:group-resolution-failed", p.Type)
+	}
+}
+
+func TestTokenType(t *testing.T) {
+	withoutUser := func(c jwt.MapClaims) {
+		delete(c, "name")
+		delete(c, "preferred_username")
+		delete(c, "scp")
+	}
+
+	tests := []struct {
+		name   string
+		mutate []func(jwt.MapClaims)
+		want   TokenType
+	}{
+		{name: "app-only", mutate: []func(jwt.MapClaims){withoutUser, withClaim("roles", []string{"Tasks.ReadWrite.All"})}, want: TokenTypeApplication},
+		{name: "user with scp", mutate: []func(jwt.MapClaims){withoutUser, withClaim("scp", "tasks.read")}, want: TokenTypeDelegated},
+		{name: "user with name", mutate: []func(jwt.MapClaims){withoutUser, withClaim("name", "Ada Lovelace")}, want: TokenTypeDelegated},
+		{name: "explicit idtyp=app", mutate: []func(jwt.MapClaims){withClaim("name", "Ada Lovelace"), withClaim("idtyp", "app")}, want: TokenTypeApplication},
+		{name: "explicit idtyp=user", mutate: []func(jwt.MapClaims){withoutUser, withClaim("idtyp", "user")}, want: TokenTypeDelegated},
+	}
+
+	v, keySet := newTestValidator(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if claims.TokenType != tt.want {
+				t.Fatalf("TokenType = %q, want %q", claims.TokenType, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectID(t *testing.T) {
+	const oid = "6c1b4c2e-9f4a-4d8e-b1a7-3e2f5d6c7b8a"
+	v, keySet := newTestValidator(t)
+
+	claims, err := v.Validate(context.Background(), testToken(keySet,
+		withClaim("oid", oid),
+		withClaim("sub", "pairwise-subject-for-this-app"),
+	))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if claims.ObjectID != oid || claims.Subject != "pairwise-subject-for-this-app" {
+		t.Fatalf("ObjectID = %q, Subject = %q; want %q and the sub claim", claims.ObjectID, claims.Subject, oid)
+	}
+}
+
+func TestWithRawClaimsAllowlist(t *testing.T) {
+	v, keySet := newTestValidator(t, WithRawClaimsAllowlist("sub", "employee_id"))
+	token := testToken(keySet,
+		withClaim("employee_id", "E-1"),
+		withClaim("ssn", "078-05-1120"),
+		withClaim("roles", []string{"reader"}),
+	)
+
+	var claims *UserClaims
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = GetClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	if rec := serve(handler, token); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if len(claims.RawClaims) != 2 || claims.RawClaims["sub"] != "jwtazuretest-subject" || claims.RawClaims["employee_id"] != "E-1" {
+		t.Fatalf("RawClaims = %v, want only sub and employee_id", claims.RawClaims)
+	}
+	// Los campos tipados se rellenan a partir del token completo.
+	if claims.TenantID != testTenantID || !slices.Equal(claims.Roles, []string{"reader"}) {
+		t.Fatalf("TenantID = %q, Roles = %v; want the token values", claims.TenantID, claims.Roles)
+	}
+
+	// Validate sigue devolviendo todos los claims.
+	full, err := v.Validate(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if full.RawClaims["ssn"] != "078-05-1120" {
+		t.Fatalf("Validate RawClaims = %v, want all the claims", full.RawClaims)
+	}
+}
@@ -0,0 +1,116 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// =============================================================================
+// Nubes de Azure
+// =============================================================================
+
+// Cloud identifica una nube de Azure por el host de su endpoint de inicio de sesión.
+type Cloud string
+
+const (
+	// AzurePublic es la nube pública global de Azure (valor por defecto).
+	AzurePublic Cloud = "login.microsoftonline.com"
+	// AzureUSGov es la nube de Azure para el Gobierno de EE. UU.
+	AzureUSGov Cloud = "login.microsoftonline.us"
+	// AzureChina es la nube de Azure operada por 21Vianet en China.
+	AzureChina Cloud = "login.chinacloudapi.cn"
+)
+
+// stsHost devuelve el host del emisor de los tokens v1.0 en esta nube.
+func (c Cloud) stsHost() string {
+	if c == AzureChina {
+		return "sts.chinacloudapi.cn"
+	}
+	return "sts.windows.net"
+}
+
+// issuers devuelve los emisores v1.0 y v2.0 de los tokens del inquilino en esta nube.
+func (c Cloud) issuers(tenantID string) []string {
+	return []string{
+		fmt.Sprintf("https://%s/%s/", c.stsHost(), tenantID),
+		fmt.Sprintf("https://%s/%s/v2.0", c, tenantID),
+	}
+}
+
+// endpoints devuelve las URLs de los JWKS v1.0 y v2.0, los emisores y los endpoints de tokens y
+// de autorización del inquilino en esta nube.
+func (c Cloud) endpoints(tenantID string) endpoints {
+	return endpoints{
+		jwksV1URL:        fmt.Sprintf("https://%s/%s/discovery/keys", c, tenantID),
+		jwksV2URL:        fmt.Sprintf("https://%s/%s/discovery/v2.0/keys", c, tenantID),
+		issuers:          c.issuers(tenantID),
+		tokenURL:         fmt.Sprintf("https://%s/%s/oauth2/v2.0/token", c, tenantID),
+		authorizationURL: fmt.Sprintf("https://%s/%s/oauth2/v2.0/authorize", c, tenantID),
+	}
+}
+
+// isAzureIssuer indica si el emisor pertenece a un host de inicio de sesión de Azure AD: el de
+// cualquiera de las nubes conocidas o de esta, sus hosts v1.0 (sts) o un inquilino de B2C.
+func (c Cloud) isAzureIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, cloud := range []Cloud{AzurePublic, AzureUSGov, AzureChina, c} {
+		if host == string(cloud) || host == cloud.stsHost() {
+			return true
+		}
+	}
+	return strings.HasSuffix(host, ".b2clogin.com")
+}
+
+// tenantAliases son los inquilinos especiales de Azure para aplicaciones multi-inquilino.
+var tenantAliases = []string{"common", "organizations", "consumers"}
+
+// normalizeTenantID limpia el ID de inquilino recibido por los constructores, WithAllowedTenants
+// y AddTenant: elimina los espacios sobrantes y las llaves de un GUID en formato de registro
+// ("{...}"), lo pasa a minúsculas (Azure emite los GUID en minúsculas en `iss` y `tid`) y
+// comprueba que sea un GUID, un dominio verificado (p. ej. contoso.onmicrosoft.com) o uno de los
+// alias multi-inquilino de Azure ("common", "organizations", "consumers"). Así, un valor mal
+// copiado falla al construir el validador en lugar de producir URLs de JWKS rotas.
+func normalizeTenantID(tenantID string) (string, error) {
+	tenantID = strings.ToLower(strings.TrimSpace(tenantID))
+	if unbraced, ok := strings.CutPrefix(tenantID, "{"); ok {
+		if unbraced, ok := strings.CutSuffix(unbraced, "}"); ok && isGUID(unbraced) {
+			tenantID = unbraced
+		}
+	}
+	if tenantID == "" {
+		return "", fmt.Errorf("el ID de inquilino (tenantID) no puede estar vacío")
+	}
+	if isGUID(tenantID) || isDomainName(tenantID) || slices.Contains(tenantAliases, tenantID) {
+		return tenantID, nil
+	}
+
+	return "", fmt.Errorf("el ID de inquilino %q no es válido: se espera un GUID, un dominio verificado (p. ej. contoso.onmicrosoft.com) o common/organizations/consumers", tenantID)
+}
+
+// isDomainName indica si s es un nombre de dominio con al menos dos etiquetas de letras, dígitos
+// y guiones, sin guiones al principio ni al final de cada etiqueta.
+func isDomainName(s string) bool {
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz0123456789-", r) {
+				return false
+			}
+		}
+	}
+	return true
+}
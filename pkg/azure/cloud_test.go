@@ -0,0 +1,210 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+func TestNormalizeTenantID(t *testing.T) {
+	upper := strings.ToUpper(testTenantID)
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: testTenantID, want: testTenantID},
+		{in: upper, want: testTenantID},
+		{in: "  " + testTenantID + "\n", want: testTenantID},
+		{in: "{" + upper + "}", want: testTenantID},
+		{in: "Contoso.onmicrosoft.com", want: "contoso.onmicrosoft.com"},
+		{in: "common", want: "common"},
+		{in: "Organizations", want: "organizations"},
+		{in: "consumers", want: "consumers"},
+		{in: "", wantErr: true},
+		{in: "   ", wantErr: true},
+		{in: "{contoso.onmicrosoft.com}", wantErr: true},
+		{in: "{" + testTenantID, wantErr: true},
+		{in: "https://login.microsoftonline.com/" + testTenantID, wantErr: true},
+		{in: "contoso", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeTenantID(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("normalizeTenantID(%q) = %q, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeTenantID(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewValidatorNormalizesTenantID(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	braced, err := NewValidator(context.Background(), "{"+strings.ToUpper(testTenantID)+"}",
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator with a braced GUID: %v", err)
+	}
+	defer braced.Close()
+
+	token := testToken(keySet)
+	for name, validator := range map[string]*Validator{"plain": v, "braced": braced} {
+		if _, err := validator.Validate(context.Background(), token); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if _, err := NewValidator(context.Background(), "not a tenant", WithAudiences(testAudience)); err == nil {
+		t.Error("NewValidator with an invalid tenant: expected an error")
+	}
+}
+
+func TestAllowedTenantsNormalized(t *testing.T) {
+	_, keySet := newTestValidator(t)
+	v, err := NewValidator(context.Background(), "organizations",
+		WithAllowedTenants("{"+strings.ToUpper(testTenantID)+"}"),
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	defer v.Close()
+
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("token from an allowed tenant: %v", err)
+	}
+
+	_, err = NewValidator(context.Background(), "organizations",
+		WithAllowedTenants("not a tenant"),
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	)
+	if err == nil {
+		t.Fatal("WithAllowedTenants with an invalid tenant: expected an error")
+	}
+}
+
+func TestCloudEndpoints(t *testing.T) {
+	tests := []struct {
+		cloud Cloud
+		want  endpoints
+	}{
+		{
+			cloud: AzurePublic,
+			want: endpoints{
+				jwksV1URL: "https://login.microsoftonline.com/" + testTenantID + "/discovery/keys",
+				jwksV2URL: "https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys",
+				issuers: []string{
+					"https://sts.windows.net/" + testTenantID + "/",
+					"https://login.microsoftonline.com/" + testTenantID + "/v2.0",
+				},
+				tokenURL:         "https://login.microsoftonline.com/" + testTenantID + "/oauth2/v2.0/token",
+				authorizationURL: "https://login.microsoftonline.com/" + testTenantID + "/oauth2/v2.0/authorize",
+			},
+		},
+		{
+			cloud: AzureUSGov,
+			want: endpoints{
+				jwksV1URL: "https://login.microsoftonline.us/" + testTenantID + "/discovery/keys",
+				jwksV2URL: "https://login.microsoftonline.us/" + testTenantID + "/discovery/v2.0/keys",
+				issuers: []string{
+					"https://sts.windows.net/" + testTenantID + "/",
+					"https://login.microsoftonline.us/" + testTenantID + "/v2.0",
+				},
+				tokenURL:         "https://login.microsoftonline.us/" + testTenantID + "/oauth2/v2.0/token",
+				authorizationURL: "https://login.microsoftonline.us/" + testTenantID + "/oauth2/v2.0/authorize",
+			},
+		},
+		{
+			cloud: AzureChina,
+			want: endpoints{
+				jwksV1URL: "https://login.chinacloudapi.cn/" + testTenantID + "/discovery/keys",
+				jwksV2URL: "https://login.chinacloudapi.cn/" + testTenantID + "/discovery/v2.0/keys",
+				issuers: []string{
+					"https://sts.chinacloudapi.cn/" + testTenantID + "/",
+					"https://login.chinacloudapi.cn/" + testTenantID + "/v2.0",
+				},
+				tokenURL:         "https://login.chinacloudapi.cn/" + testTenantID + "/oauth2/v2.0/token",
+				authorizationURL: "https://login.chinacloudapi.cn/" + testTenantID + "/oauth2/v2.0/authorize",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.cloud), func(t *testing.T) {
+			if got := tt.cloud.endpoints(testTenantID); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("endpoints = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCloud(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	var requests requestLog
+
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithCloud(AzureUSGov),
+		WithAudiences(testAudience),
+		WithHTTPClient(requests.client(keySet.HTTPClient())),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	got := requests.sorted()
+	want := []string{
+		"https://login.microsoftonline.us/" + testTenantID + "/discovery/keys",
+		"https://login.microsoftonline.us/" + testTenantID + "/discovery/v2.0/keys",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("requested %v, want %v", got, want)
+	}
+
+	usGovIssuer := "https://login.microsoftonline.us/" + testTenantID + "/v2.0"
+	if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("iss", usGovIssuer))); err != nil {
+		t.Fatalf("US Gov token: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), testToken(keySet)); !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("public cloud token: got %v, want ErrInvalidIssuer", err)
+	}
+}
+
+func TestIsAzureIssuer(t *testing.T) {
+	tests := map[string]bool{
+		"https://login.microsoftonline.com/" + testTenantID + "/v2.0": true,
+		"https://sts.windows.net/" + testTenantID + "/":               true,
+		"https://login.microsoftonline.us/" + testTenantID + "/v2.0":  true,
+		"https://sts.chinacloudapi.cn/" + testTenantID + "/":          true,
+		"https://contoso.b2clogin.com/tfp/contoso/v2.0/":              true,
+		"https://LOGIN.MICROSOFTONLINE.COM/" + testTenantID + "/v2.0": true,
+		"https://dev.local": false,
+		"https://login.microsoftonline.com.evil.example/": false,
+	}
+
+	for issuer, want := range tests {
+		if got := AzurePublic.isAzureIssuer(issuer); got != want {
+			t.Errorf("isAzureIssuer(%q) = %v, want %v", issuer, got, want)
+		}
+	}
+}
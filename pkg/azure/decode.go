@@ -0,0 +1,32 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// =============================================================================
+// Decodificación sin Verificar
+// =============================================================================
+
+// DecodeUnverified decodifica el token y devuelve sus claims SIN VALIDARLO: no verifica la firma,
+// el emisor, la audiencia ni las fechas, por lo que cualquiera puede fabricar un token que se
+// decodifique sin error. Solo es apto para usos de baja confianza, como mostrar el contenido de un
+// token en una interfaz de depuración o encaminar una petición antes de validarla; nunca para
+// autenticar ni autorizar. Para eso, use Validate o Middleware.
+func DecodeUnverified(tokenString string) (*UserClaims, error) {
+	if len(tokenString) > defaultMaxTokenBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrTokenTooLarge, len(tokenString), defaultMaxTokenBytes)
+	}
+
+	var mapClaims jwt.MapClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &mapClaims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+	}
+	if mapClaims == nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, jwt.ErrTokenMalformed)
+	}
+
+	return buildUserClaims(mapClaims), nil
+}
@@ -0,0 +1,76 @@
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// forgedToken construye un token con alg "none" y sin firma, con los claims de prueba y los roles indicados.
+func forgedToken(t *testing.T, roles ...string) string {
+	t.Helper()
+
+	claims := jwtazuretest.Claims(testTenantID, testAudience)
+	claims["roles"] = roles
+	header, err := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestDecodeUnverified(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	forged := forgedToken(t, "admin")
+
+	claims, err := DecodeUnverified(forged)
+	if err != nil {
+		t.Fatalf("DecodeUnverified: %v", err)
+	}
+	if claims.Subject != "jwtazuretest-subject" || claims.TenantID != testTenantID || !claims.HasRole("admin") {
+		t.Fatalf("claims = %+v, want the forged claims", claims)
+	}
+
+	// El mismo token nunca supera la validación.
+	if _, err := v.Validate(context.Background(), forged); err == nil {
+		t.Fatal("Validate accepted a forged token")
+	}
+	if rec := serve(v.Middleware(okHandler), forged); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Middleware status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Un token firmado se decodifica igual.
+	if claims, err := DecodeUnverified(testToken(keySet)); err != nil || claims.Subject != "jwtazuretest-subject" {
+		t.Fatalf("signed token: claims = %+v, err = %v", claims, err)
+	}
+}
+
+func TestDecodeUnverifiedErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "malformed", token: "not-a-jwt", wantErr: ErrTokenParsingFailed},
+		{name: "null payload", token: "eyJhbGciOiJub25lIn0.bnVsbA.", wantErr: ErrTokenParsingFailed},
+		{name: "oversized", token: strings.Repeat("a", defaultMaxTokenBytes+1), wantErr: ErrTokenTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeUnverified(tt.token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
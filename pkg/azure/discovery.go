@@ -0,0 +1,191 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// =============================================================================
+// Descubrimiento OpenID Connect
+// =============================================================================
+
+// maxDiscoveryDocumentBytes limita el tamaño del documento de descubrimiento leído.
+const maxDiscoveryDocumentBytes = 1 << 20
+
+// openIDConfiguration es la parte del documento /.well-known/openid-configuration que se utiliza.
+type openIDConfiguration struct {
+	Issuer                string `json:"issuer"`
+	JWKSURI               string `json:"jwks_uri"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+}
+
+// discoverySource es el documento de descubrimiento del que proceden los endpoints de un
+// validador creado con NewDiscoveryValidator.
+type discoverySource struct {
+	url string
+	// customIssuers indica que WithIssuers o SetIssuers tienen prioridad sobre el emisor
+	// descubierto. Se protege con el configMu del validador.
+	customIssuers bool
+	// refreshUnknownKID limita los refrescos provocados por un `kid` desconocido; nil los desactiva.
+	refreshUnknownKID *rate.Limiter
+	unknownKID        chan struct{}
+}
+
+// requestRefresh pide al watcher un refresco del documento si el limitador lo permite, sin bloquear.
+func (d *discoverySource) requestRefresh() {
+	if d.refreshUnknownKID == nil || !d.refreshUnknownKID.Allow() {
+		return
+	}
+	select {
+	case d.unknownKID <- struct{}{}:
+	default:
+	}
+}
+
+// NewDiscoveryValidator crea un validador cuyo emisor y URL de JWKS proceden del documento de
+// descubrimiento OpenID Connect v2.0 del inquilino, en lugar de construirse a partir de patrones
+// fijos. El documento se descarga con el cliente de WithHTTPClient al construir el validador y
+// después sigue el ciclo de vida del JWKS: se refresca cada WithRefreshInterval, ante un `kid`
+// desconocido (limitado por WithUnknownKIDRefresh) y con RefreshKeys. WithIssuers sigue teniendo
+// prioridad sobre el emisor descubierto, y WithJWKSURLs sobre la URL de JWKS descubierta.
+func NewDiscoveryValidator(ctx context.Context, tenantID string, opts ...Option) (*Validator, error) {
+	tenantID, err := normalizeTenantID(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newValidator(ctx, opts, func(ctx context.Context, v *Validator) (endpoints, error) {
+		discoveryURL := fmt.Sprintf("https://%s/%s/v2.0/.well-known/openid-configuration", v.cloud, tenantID)
+		config, err := fetchOpenIDConfiguration(ctx, v.httpClient, discoveryURL)
+		if err != nil {
+			return endpoints{}, err
+		}
+
+		v.discovery = &discoverySource{url: discoveryURL, unknownKID: make(chan struct{}, 1)}
+		if v.unknownKIDRefreshInterval > 0 {
+			v.discovery.refreshUnknownKID = rate.NewLimiter(rate.Every(v.unknownKIDRefreshInterval), 1)
+		}
+
+		return endpoints{
+			jwksV2URL:        config.JWKSURI,
+			issuers:          []string{config.Issuer},
+			tokenURL:         config.TokenEndpoint,
+			authorizationURL: config.AuthorizationEndpoint,
+		}, nil
+	})
+}
+
+// fetchOpenIDConfiguration descarga y valida el documento de descubrimiento OpenID Connect.
+func fetchOpenIDConfiguration(ctx context.Context, client *http.Client, discoveryURL string) (*openIDConfiguration, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fallo al crear la petición de descubrimiento: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fallo al descargar el documento de descubrimiento %s: %w", discoveryURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("el documento de descubrimiento %s respondió con status %d", discoveryURL, resp.StatusCode)
+	}
+
+	var config openIDConfiguration
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDiscoveryDocumentBytes)).Decode(&config); err != nil {
+		return nil, fmt.Errorf("documento de descubrimiento %s no válido: %w", discoveryURL, err)
+	}
+	if config.Issuer == "" || config.JWKSURI == "" {
+		return nil, fmt.Errorf("el documento de descubrimiento %s no incluye issuer o jwks_uri", discoveryURL)
+	}
+
+	return &config, nil
+}
+
+// watchDiscovery refresca el documento de descubrimiento cada intervalo de refresco del JWKS y
+// cuando se encuentra un `kid` desconocido, hasta que se cancela ctx (Close).
+func (v *Validator) watchDiscovery(ctx context.Context) {
+	ticker := time.NewTicker(v.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-v.discovery.unknownKID:
+		}
+
+		if err := v.refreshDiscovery(ctx); err != nil && ctx.Err() == nil {
+			v.logger.Warn("OpenID discovery refresh failed",
+				zap.String("url", v.discovery.url),
+				zap.Error(err),
+			)
+			if v.refreshErrorHandler != nil {
+				v.refreshErrorHandler(err)
+			}
+		}
+	}
+}
+
+// refreshDiscovery descarga de nuevo el documento de descubrimiento y aplica los cambios: una
+// nueva URL de JWKS reconstruye el JWKS v2 (conservando el anterior si la descarga falla) y un
+// nuevo emisor o endpoint de token o de autorización reemplazan la configuración como SetIssuers.
+func (v *Validator) refreshDiscovery(ctx context.Context) error {
+	config, err := fetchOpenIDConfiguration(ctx, v.httpClient, v.discovery.url)
+	if err != nil {
+		return err
+	}
+
+	// WithJWKSURLs, WithStaticJWKS y WithoutV2Endpoint fijan el JWKS v2 al construir el validador.
+	if jwks := v.jwksV2; v.jwksURLs == nil && jwks != nil && jwks.endpoint == endpointV2 {
+		if previousURL := jwks.jwksURL(); config.JWKSURI != previousURL {
+			if err := v.refreshJWKS(ctx, jwks, config.JWKSURI); err != nil {
+				return err
+			}
+			v.logger.Info("OpenID discovery changed the JWKS URL",
+				zap.String("previous", previousURL),
+				zap.String("url", config.JWKSURI),
+			)
+		}
+	}
+
+	issuers := []string{config.Issuer}
+	v.configMu.RLock()
+	changed := !slices.Equal(v.defaultIssuers, issuers) || v.tokenURL != config.TokenEndpoint ||
+		v.authorizationURL != config.AuthorizationEndpoint
+	v.configMu.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	// Con WithSymmetricKey los emisores siempre son propios (WithIssuers), por lo que el emisor
+	// descubierto nunca llega a aceptarse junto a la clave simétrica.
+	v.swapConfig(func() {
+		v.defaultIssuers = issuers
+		if !v.discovery.customIssuers {
+			v.validIssuers = issuers
+		}
+		v.tokenURL = config.TokenEndpoint
+		v.authorizationURL = config.AuthorizationEndpoint
+	})
+	v.logger.Info("OpenID discovery changed the issuer or token endpoint",
+		zap.String("issuer", config.Issuer),
+		zap.String("token_endpoint", config.TokenEndpoint),
+	)
+	return nil
+}
@@ -0,0 +1,246 @@
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// discoveryServer publica un documento de descubrimiento que las pruebas pueden cambiar.
+type discoveryServer struct {
+	*httptest.Server
+	config atomic.Pointer[openIDConfiguration]
+}
+
+// newDiscoveryServer inicia un servidor de descubrimiento que publica config.
+func newDiscoveryServer(t *testing.T, config openIDConfiguration) *discoveryServer {
+	t.Helper()
+
+	d := &discoveryServer{}
+	d.set(config)
+	d.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d.config.Load())
+	}))
+	t.Cleanup(d.Close)
+
+	return d
+}
+
+// set reemplaza el documento publicado.
+func (d *discoveryServer) set(config openIDConfiguration) {
+	d.config.Store(&config)
+}
+
+// HTTPClient devuelve un cliente que redirige las peticiones a la nube de Azure al servidor de
+// descubrimiento y deja pasar el resto (las URLs de JWKS de los KeySet).
+func (d *discoveryServer) HTTPClient() *http.Client {
+	target, _ := url.Parse(d.URL)
+	return &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Host == string(AzurePublic) {
+				r = r.Clone(r.Context())
+				r.URL.Scheme, r.URL.Host, r.Host = target.Scheme, target.Host, target.Host
+			}
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+}
+
+// roundTripFunc adapta una función a http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// discoveryConfig devuelve un documento con el emisor v2 de pruebas y el JWKS de keySet.
+func discoveryConfig(keySet *jwtazuretest.KeySet, issuer string) openIDConfiguration {
+	return openIDConfiguration{
+		Issuer:                issuer,
+		JWKSURI:               keySet.URL(),
+		TokenEndpoint:         keySet.Server.URL + "/oauth2/v2.0/token",
+		AuthorizationEndpoint: keySet.Server.URL + "/oauth2/v2.0/authorize",
+	}
+}
+
+// newTestDiscoveryValidator crea un validador de descubrimiento sobre server.
+func newTestDiscoveryValidator(t *testing.T, server *discoveryServer, opts ...Option) *Validator {
+	t.Helper()
+
+	opts = append([]Option{
+		WithAudiences(testAudience),
+		WithHTTPClient(server.HTTPClient()),
+		WithoutV1Endpoint(),
+		WithNoOpLogger(),
+	}, opts...)
+	v, err := NewDiscoveryValidator(context.Background(), testTenantID, opts...)
+	if err != nil {
+		t.Fatalf("NewDiscoveryValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	return v
+}
+
+// waitFor comprueba cond hasta que se cumpla o pasen unos segundos.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// jwksURLOf devuelve la URL del JWKS v2 que informa Health.
+func jwksURLOf(v *Validator) string {
+	for _, endpoint := range v.Health().Endpoints {
+		if endpoint.Endpoint == endpointV2 {
+			return endpoint.URL
+		}
+	}
+	return ""
+}
+
+// unknownKIDToken devuelve un token RS256 con un `kid` que ningún JWKS publica. La firma no es
+// válida, pero la búsqueda de la clave falla antes de comprobarla.
+func unknownKIDToken() string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "rotated-key"})
+	payload, _ := json.Marshal(jwtazuretest.Claims(testTenantID, testAudience))
+	return base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte("signature"))
+}
+
+func TestDiscoveryValidatorRefreshesOnInterval(t *testing.T) {
+	const rotatedIssuer = "https://login.example.test/rotated/v2.0"
+
+	before, after := jwtazuretest.NewKeySet(), jwtazuretest.NewKeySet()
+	t.Cleanup(before.Close)
+	t.Cleanup(after.Close)
+
+	issuer := jwtazuretest.Claims(testTenantID, testAudience)["iss"].(string)
+	server := newDiscoveryServer(t, discoveryConfig(before, issuer))
+	v := newTestDiscoveryValidator(t, server, WithRefreshInterval(20*time.Millisecond))
+
+	if _, err := v.Validate(context.Background(), testToken(before)); err != nil {
+		t.Fatalf("Validate before the rotation: %v", err)
+	}
+
+	server.set(discoveryConfig(after, rotatedIssuer))
+	waitFor(t, "the rotated JWKS URL", func() bool { return jwksURLOf(v) == after.URL() })
+	waitFor(t, "the rotated issuer", func() bool { return slices.Equal(v.issuers(), []string{rotatedIssuer}) })
+
+	if _, err := v.Validate(context.Background(), testToken(after, withClaim("iss", rotatedIssuer))); err != nil {
+		t.Fatalf("Validate after the rotation: %v", err)
+	}
+	if got, want := v.tokenEndpoint(), after.Server.URL+"/oauth2/v2.0/token"; got != want {
+		t.Fatalf("token endpoint = %q, want %q", got, want)
+	}
+	if got, want := v.authorizationEndpoint(), after.Server.URL+"/oauth2/v2.0/authorize"; got != want {
+		t.Fatalf("authorization endpoint = %q, want %q", got, want)
+	}
+}
+
+func TestDiscoveryValidatorRefreshesOnUnknownKID(t *testing.T) {
+	before, after := jwtazuretest.NewKeySet(), jwtazuretest.NewKeySet()
+	t.Cleanup(before.Close)
+	t.Cleanup(after.Close)
+
+	issuer := jwtazuretest.Claims(testTenantID, testAudience)["iss"].(string)
+	server := newDiscoveryServer(t, discoveryConfig(before, issuer))
+	v := newTestDiscoveryValidator(t, server, WithUnknownKIDRefresh(time.Millisecond))
+
+	server.set(discoveryConfig(after, issuer))
+	if jwksURLOf(v) != before.URL() {
+		t.Fatal("the JWKS URL changed before any refresh was triggered")
+	}
+
+	if _, err := v.Validate(context.Background(), unknownKIDToken()); err == nil {
+		t.Fatal("Validate with an unknown kid: expected an error")
+	}
+	waitFor(t, "the rotated JWKS URL", func() bool { return jwksURLOf(v) == after.URL() })
+
+	if _, err := v.Validate(context.Background(), testToken(after)); err != nil {
+		t.Fatalf("Validate after the rotation: %v", err)
+	}
+}
+
+func TestDiscoveryValidatorKeepsChosenIssuers(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	issuer := jwtazuretest.Claims(testTenantID, testAudience)["iss"].(string)
+	tests := []struct {
+		name  string
+		opts  []Option
+		setup func(v *Validator) error
+	}{
+		{
+			name: "WithIssuers",
+			opts: []Option{WithIssuers("https://custom.example.test")},
+		},
+		{
+			name:  "SetIssuers",
+			setup: func(v *Validator) error { return v.SetIssuers("https://custom.example.test") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newDiscoveryServer(t, discoveryConfig(keySet, issuer))
+			v := newTestDiscoveryValidator(t, server, tt.opts...)
+			if tt.setup != nil {
+				if err := tt.setup(v); err != nil {
+					t.Fatalf("setup: %v", err)
+				}
+			}
+
+			server.set(discoveryConfig(keySet, "https://login.example.test/rotated/v2.0"))
+			if err := v.RefreshKeys(context.Background()); err != nil {
+				t.Fatalf("RefreshKeys: %v", err)
+			}
+
+			if got, want := v.issuers(), []string{"https://custom.example.test"}; !slices.Equal(got, want) {
+				t.Fatalf("issuers = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiscoveryValidatorKeepsKeysWhenNewJWKSFails(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	issuer := jwtazuretest.Claims(testTenantID, testAudience)["iss"].(string)
+	server := newDiscoveryServer(t, discoveryConfig(keySet, issuer))
+	v := newTestDiscoveryValidator(t, server)
+
+	// El servidor de descubrimiento responde en cualquier ruta con el documento, que no es un JWKS.
+	broken := discoveryConfig(keySet, issuer)
+	broken.JWKSURI = server.URL + "/discovery/v2.0/keys"
+	server.set(broken)
+
+	if err := v.RefreshKeys(context.Background()); err == nil {
+		t.Fatal("RefreshKeys with an unreachable JWKS: expected an error")
+	}
+	if got := jwksURLOf(v); got != keySet.URL() {
+		t.Fatalf("JWKS URL = %q, want the previous %q", got, keySet.URL())
+	}
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate with the previous keys: %v", err)
+	}
+}
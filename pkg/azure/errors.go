@@ -0,0 +1,153 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultProblemTypeBase es el prefijo por defecto de los URIs de tipo de problema (RFC 7807).
+const defaultProblemTypeBase = "urn:jwtazure:"
+
+// WithProblemTypeBase cambia el prefijo de los URIs `type` de las respuestas de error (RFC 7807),
+// por defecto "urn:jwtazure:", p. ej. a "https://errors.example.com/auth/" para que apunten a la
+// documentación propia. El sufijo de cada categoría (p. ej. "token-expired") es estable.
+func WithProblemTypeBase(base string) Option {
+	return func(v *Validator) {
+		v.problemTypeBase = base
+	}
+}
+
+// problemTypes asocia cada error expuesto al cliente con el sufijo de su tipo de problema.
+var problemTypes = map[error]string{
+	ErrMissingAuthHeader:          "missing-authorization",
+	ErrInvalidAuthHeaderFormat:    "invalid-authorization-header",
+	ErrClaimsNotFound:             "claims-not-found",
+	ErrInsufficientRoles:          "insufficient-roles",
+	ErrInsufficientScopes:         "insufficient-scopes",
+	ErrMFARequired:                "mfa-required",
+	ErrAccessDenied:               "access-denied",
+	ErrInsufficientClaims:         "insufficient-claims",
+	ErrTokenParsingFailed:         "token-malformed",
+	ErrTokenInvalid:               "invalid-token",
+	ErrTokenExpired:               "token-expired",
+	ErrTokenNotYetValid:           "token-not-yet-valid",
+	ErrInvalidIssuer:              "invalid-issuer",
+	ErrInvalidAudience:            "invalid-audience",
+	ErrTenantNotAllowed:           "tenant-not-allowed",
+	ErrTenantMismatch:             "tenant-mismatch",
+	ErrMissingRequiredClaim:       "missing-required-claim",
+	ErrInvalidClientApp:           "invalid-client-app",
+	ErrUnsupportedTokenVersion:    "unsupported-token-version",
+	ErrKeySourceUnavailable:       "key-source-unavailable",
+	ErrMissingKID:                 "missing-kid",
+	ErrInvalidNonce:               "invalid-nonce",
+	ErrClaimsRejected:             "claims-rejected",
+	ErrTokenTooLarge:              "token-too-large",
+	ErrAmbiguousPermissions:       "ambiguous-permissions",
+	ErrInsufficientAppAuth:        "insufficient-app-auth",
+	ErrCertificateBindingMismatch: "certificate-binding-mismatch",
+	ErrTokenRevoked:               "token-revoked",
+	ErrRevocationCheckFailed:      "revocation-check-failed",
+	ErrGroupResolutionFailed:      "group-resolution-failed",
+}
+
+// ValidationError describe el claim que hizo fallar una validación, con el valor esperado y el
+// recibido. Envuelve el error centinela correspondiente, de modo que errors.Is sigue funcionando
+// (p. ej. con ErrInvalidAudience), y se puede inspeccionar con errors.As.
+type ValidationError struct {
+	// Code identifica el fallo con el mismo sufijo que el tipo de problema (p. ej. "invalid-audience").
+	Code     string
+	Claim    string
+	Expected any
+	Actual   any
+
+	err error
+}
+
+// newValidationError construye un ValidationError para el error centinela indicado.
+func newValidationError(sentinel error, claim string, expected, actual any) *ValidationError {
+	return &ValidationError{
+		Code:     problemTypes[sentinel],
+		Claim:    claim,
+		Expected: expected,
+		Actual:   actual,
+		err:      sentinel,
+	}
+}
+
+// Error implementa error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: claim %q: expected %v, received %v", e.err, e.Claim, e.Expected, e.Actual)
+}
+
+// Unwrap devuelve el error centinela, para errors.Is.
+func (e *ValidationError) Unwrap() error {
+	return e.err
+}
+
+// publicError reduce un error de validación al error del paquete que lo representa, para
+// exponerlo al cliente sin filtrar detalles internos. Los errores no reconocidos se
+// reducen a ErrTokenInvalid.
+func publicError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return ErrTokenNotYetValid
+	}
+
+	for _, known := range []error{
+		ErrKeySourceUnavailable,
+		ErrMissingKID,
+		ErrInvalidNonce,
+		ErrClaimsRejected,
+		ErrTokenTooLarge,
+		ErrAmbiguousPermissions,
+		ErrInsufficientAppAuth,
+		ErrCertificateBindingMismatch,
+		ErrTokenRevoked,
+		ErrRevocationCheckFailed,
+		ErrGroupResolutionFailed,
+		ErrUnsupportedTokenVersion,
+		ErrInvalidIssuer,
+		ErrInvalidAudience,
+		ErrTenantNotAllowed,
+		ErrTenantMismatch,
+		ErrMissingRequiredClaim,
+		ErrInvalidClientApp,
+		ErrTokenParsingFailed,
+		ErrMissingAuthHeader,
+		ErrInvalidAuthHeaderFormat,
+	} {
+		if errors.Is(err, known) {
+			return known
+		}
+	}
+
+	return ErrTokenInvalid
+}
+
+// unavailableError devuelve el error del paquete que corresponde a err si el token no se ha podido
+// verificar por un fallo de una dependencia (las claves de firma, el RevocationChecker o el
+// GroupResolver), en cuyo
+// caso el cliente debe reintentar en lugar de descartar sus credenciales. En otro caso devuelve nil.
+func unavailableError(err error) error {
+	for _, dependency := range []error{ErrKeySourceUnavailable, ErrRevocationCheckFailed, ErrGroupResolutionFailed} {
+		if errors.Is(err, dependency) {
+			return dependency
+		}
+	}
+	return nil
+}
+
+// problemType devuelve el URI del tipo de problema asociado a un error del paquete, con el prefijo
+// de WithProblemTypeBase. Los errores que no son del paquete se reducen antes con publicError.
+func (v *Validator) problemType(err error) string {
+	slug, ok := problemTypes[err]
+	if !ok {
+		slug = problemTypes[publicError(err)]
+	}
+	return v.problemTypeBase + slug
+}
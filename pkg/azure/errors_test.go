@@ -0,0 +1,148 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// problemBody es el cuerpo de una respuesta de error (RFC 7807).
+type problemBody struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// decodeProblem lee el problema de una respuesta de error.
+func decodeProblem(t *testing.T, body []byte) problemBody {
+	t.Helper()
+
+	var p problemBody
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatalf("decode problem %q: %v", body, err)
+	}
+	return p
+}
+
+// expiredClaims es un mutador de testToken que deja el token caducado hace una hora.
+func expiredClaims(claims jwt.MapClaims) {
+	now := time.Now()
+	claims["iat"] = now.Add(-2 * time.Hour).Unix()
+	claims["nbf"] = now.Add(-2 * time.Hour).Unix()
+	claims["exp"] = now.Add(-time.Hour).Unix()
+}
+
+func TestWithDetailedErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		detailed bool
+		mutate   func(jwt.MapClaims)
+		wantType string
+	}{
+		{name: "detailed/expired", detailed: true, mutate: expiredClaims, wantType: "urn:jwtazure:token-expired"},
+		{name: "detailed/wrong audience", detailed: true, mutate: withClaim("aud", "api://other"), wantType: "urn:jwtazure:invalid-audience"},
+		{name: "generic/expired", mutate: expiredClaims, wantType: "urn:jwtazure:invalid-token"},
+		{name: "generic/wrong audience", mutate: withClaim("aud", "api://other"), wantType: "urn:jwtazure:invalid-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.detailed {
+				opts = append(opts, WithDetailedErrors())
+			}
+			v, keySet := newTestValidator(t, opts...)
+
+			rec := serve(v.Middleware(okHandler), testToken(keySet, tt.mutate))
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if p := decodeProblem(t, rec.Body.Bytes()); p.Type != tt.wantType {
+				t.Fatalf("problem type = %q, want %q", p.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestValidationErrorAudienceMismatch(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	_, err := v.Validate(context.Background(), testToken(keySet, withClaim("aud", "api://other")))
+	if !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("got %v, want ErrInvalidAudience", err)
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("got %T, want a *ValidationError", err)
+	}
+	if validationErr.Code != "invalid-audience" || validationErr.Claim != "aud" {
+		t.Fatalf("Code = %q, Claim = %q; want invalid-audience, aud", validationErr.Code, validationErr.Claim)
+	}
+	if !reflect.DeepEqual(validationErr.Expected, []string{testAudience}) {
+		t.Fatalf("Expected = %v, want [%s]", validationErr.Expected, testAudience)
+	}
+	if !reflect.DeepEqual(validationErr.Actual, jwt.ClaimStrings{"api://other"}) {
+		t.Fatalf("Actual = %v, want [api://other]", validationErr.Actual)
+	}
+}
+
+func TestProblemTypeURIs(t *testing.T) {
+	const base = "https://errors.example.com/auth/"
+	v, keySet := newTestValidator(t, WithDetailedErrors(), WithProblemTypeBase(base))
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		token    string
+		wantType string
+	}{
+		{name: "missing token", handler: v.Middleware(okHandler), wantType: base + "missing-authorization"},
+		{name: "expired", handler: v.Middleware(okHandler), token: testToken(keySet, expiredClaims), wantType: base + "token-expired"},
+		{name: "wrong audience", handler: v.Middleware(okHandler), token: testToken(keySet, withClaim("aud", "api://other")), wantType: base + "invalid-audience"},
+		{name: "wrong issuer", handler: v.Middleware(okHandler), token: testToken(keySet, withClaim("iss", "https://evil.example")), wantType: base + "invalid-issuer"},
+		{name: "missing scope", handler: chain(v, v.RequireScopes("orders.write")), token: testToken(keySet, withClaim("scp", "orders.read")), wantType: base + "insufficient-scopes"},
+		{name: "missing role", handler: chain(v, v.RequireAllRoles("admin")), token: testToken(keySet), wantType: base + "insufficient-roles"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.handler, tt.token)
+			if p := decodeProblem(t, rec.Body.Bytes()); p.Type != tt.wantType || p.Status != rec.Code {
+				t.Fatalf("problem = %+v (status %d), want type %q", p, rec.Code, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestProblemTypeSlugs(t *testing.T) {
+	v := applyOptions(nil)
+	wrapped := newValidationError(ErrInvalidAudience, "aud", []string{testAudience}, []string{"api://other"})
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{ErrTokenExpired, "urn:jwtazure:token-expired"},
+		{ErrInvalidIssuer, "urn:jwtazure:invalid-issuer"},
+		{wrapped, "urn:jwtazure:invalid-audience"},
+		{ErrKeySourceUnavailable, "urn:jwtazure:key-source-unavailable"},
+		{fmt.Errorf("%w: %w", ErrRevocationCheckFailed, errors.New("blocklist unavailable")), "urn:jwtazure:revocation-check-failed"},
+		{fmt.Errorf("%w: %w", ErrGroupResolutionFailed, errors.New("graph unavailable")), "urn:jwtazure:group-resolution-failed"},
+		{errors.New("unexpected"), "urn:jwtazure:invalid-token"},
+	}
+
+	for _, tt := range tests {
+		if got := v.problemType(tt.err); got != tt.want {
+			t.Errorf("problemType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// =============================================================================
+// Diagnóstico de Tokens
+// =============================================================================
+
+// Report es el resultado de Explain: cada comprobación ejecutada con su resultado, además de la
+// cabecera y los claims del token tal como se leyeron (sin verificar).
+type Report struct {
+	// Valid indica si todas las comprobaciones se superaron.
+	Valid bool
+	// Revoked indica que el RevocationChecker de WithRevocationChecker considera revocado el token.
+	Revoked bool
+	Checks  []CheckResult
+	Header  map[string]any
+	Claims  jwt.MapClaims
+}
+
+// CheckResult es el resultado de una comprobación de Explain; Err es nil si se superó.
+type CheckResult struct {
+	Name string
+	Err  error
+}
+
+// Passed indica si la comprobación se superó.
+func (c CheckResult) Passed() bool {
+	return c.Err == nil
+}
+
+// Failed devuelve las comprobaciones que no se superaron.
+func (r Report) Failed() []CheckResult {
+	var failed []CheckResult
+	for _, check := range r.Checks {
+		if !check.Passed() {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// String formatea el informe para leerlo en una terminal: una línea por comprobación y
+// después la cabecera y los claims, ordenados por nombre.
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "valid: %t\n", r.Valid)
+	if r.Revoked {
+		fmt.Fprintf(&b, "revoked: %t\n", r.Revoked)
+	}
+	for _, check := range r.Checks {
+		if check.Passed() {
+			fmt.Fprintf(&b, "  [ok]   %s\n", check.Name)
+		} else {
+			fmt.Fprintf(&b, "  [fail] %s: %v\n", check.Name, check.Err)
+		}
+	}
+
+	for _, section := range []struct {
+		name   string
+		values map[string]any
+	}{{"header", r.Header}, {"claims", r.Claims}} {
+		if len(section.values) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", section.name)
+		keys := make([]string, 0, len(section.values))
+		for key := range section.values {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "  %s: %v\n", key, section.values[key])
+		}
+	}
+	return b.String()
+}
+
+// Explain ejecuta las comprobaciones de Validate sin detenerse en el primer fallo y devuelve
+// el resultado de cada una, para diagnosticar problemas de autenticación (p. ej. desde un
+// comando de depuración). Solo se detiene si el token no puede decodificarse. Usa la
+// configuración del validador, incluida la audiencia por defecto y el RevocationChecker, pero no
+// la caché de resultados, las métricas ni el resolver de grupos. No debe usarse para autorizar
+// peticiones: use Validate.
+func (v *Validator) Explain(tokenString string) Report {
+	return v.explain(context.Background(), tokenString, false, "")
+}
+
+// ExplainPoP es como Explain, pero comprueba además la vinculación del token al certificado de
+// cliente cuya huella es peerCertThumbprint, igual que ValidatePoP. ctx se propaga a la búsqueda
+// de claves y al RevocationChecker.
+func (v *Validator) ExplainPoP(ctx context.Context, tokenString, peerCertThumbprint string) Report {
+	return v.explain(ctx, tokenString, true, peerCertThumbprint)
+}
+
+// explain implementa Explain y ExplainPoP; certificateBinding indica si se comprueba la
+// vinculación a peerCertThumbprint.
+func (v *Validator) explain(ctx context.Context, tokenString string, certificateBinding bool, peerCertThumbprint string) Report {
+	var report Report
+	check := func(name string, err error) {
+		report.Checks = append(report.Checks, CheckResult{Name: name, Err: err})
+	}
+
+	if v.closed.Load() {
+		check("validator", ErrValidatorClosed)
+		return report
+	}
+	check("size", v.checkTokenSize(tokenString))
+
+	mapClaims := jwt.MapClaims{}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, mapClaims)
+	if err != nil {
+		check("format", fmt.Errorf("%w: %w", ErrTokenParsingFailed, err))
+		return report
+	}
+	check("format", nil)
+	report.Header, report.Claims = token.Header, mapClaims
+
+	_, err = jwt.Parse(tokenString, v.keyFunc(ctx),
+		jwt.WithValidMethods(v.validMethods),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+	}
+	check("signature", err)
+	check("lifetime", v.validateTimes(mapClaims, time.Now()))
+
+	if v.requiredVersion != "" {
+		check("version", v.checkVersion(mapClaims))
+	}
+
+	issuer, _ := mapClaims.GetIssuer()
+	check("issuer", v.validateIssuer(issuer, mapClaims))
+	if v.verifyTenantID {
+		check("tenant", v.checkTenantMatch(issuer, mapClaims))
+	}
+
+	if audCheck := v.defaultAudienceCheck(); audCheck.enabled {
+		audience, err := tokenAudience(mapClaims)
+		if err == nil && !audCheck.matches(issuer, audience) {
+			err = newValidationError(ErrInvalidAudience, "aud", audCheck.expected(issuer), audience)
+		}
+		check("audience", err)
+	}
+
+	if len(v.allowedClientApps) > 0 {
+		check("client_app", v.checkClientApp(mapClaims))
+	}
+	if len(v.requiredClaims) > 0 {
+		check("required_claims", v.checkRequiredClaims(mapClaims))
+	}
+	if len(v.claimsValidators) > 0 {
+		check("claims_validators", v.runClaimsValidators(mapClaims))
+	}
+
+	claims, err := v.buildClaims(mapClaims)
+	check("claims", err)
+	if claims != nil {
+		if v.permissionPolicy != PermissionPolicyBoth {
+			check("permission_policy", v.applyPermissionPolicy(claims))
+		}
+		if v.minAppAuthLevel > AppAuthPublicClient {
+			check("app_auth_level", v.checkAppAuthLevel(claims))
+		}
+		if certificateBinding {
+			check("certificate_binding", checkCertificateBinding(claims, peerCertThumbprint))
+		}
+		if v.revocationChecker != nil {
+			err := v.checkRevocation(ctx, claims)
+			report.Revoked = errors.Is(err, ErrTokenRevoked)
+			check("revocation", err)
+		}
+	}
+
+	report.Valid = len(report.Failed()) == 0
+	return report
+}
@@ -0,0 +1,158 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// findCheck devuelve la comprobación name del informe y si se ejecutó.
+func findCheck(report Report, name string) (CheckResult, bool) {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check, true
+		}
+	}
+	return CheckResult{}, false
+}
+
+func TestExplainMarksFailedChecks(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	other := jwtazuretest.NewKeySet()
+	t.Cleanup(other.Close)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantFailed []string
+	}{
+		{name: "valid", token: testToken(keySet)},
+		{name: "expired", token: testToken(keySet, expiredClaims), wantFailed: []string{"lifetime"}},
+		{name: "wrong audience", token: testToken(keySet, withClaim("aud", "api://other")), wantFailed: []string{"audience"}},
+		{name: "wrong issuer", token: testToken(keySet, withClaim("iss", "https://evil.example")), wantFailed: []string{"issuer"}},
+		{name: "unknown signing key", token: testToken(other), wantFailed: []string{"signature"}},
+		// Sin cortocircuito: se informan todos los fallos.
+		{name: "expired with wrong audience", token: testToken(keySet, expiredClaims, withClaim("aud", "api://other")), wantFailed: []string{"lifetime", "audience"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := v.Explain(tt.token)
+
+			var failed []string
+			for _, check := range report.Failed() {
+				failed = append(failed, check.Name)
+			}
+			if !slices.Equal(failed, tt.wantFailed) || report.Valid != (len(tt.wantFailed) == 0) {
+				t.Fatalf("failed checks = %v, Valid = %t; want %v\n%s", failed, report.Valid, tt.wantFailed, report)
+			}
+			if report.Claims["sub"] != "jwtazuretest-subject" {
+				t.Fatalf("Claims = %v, want the parsed token claims", report.Claims)
+			}
+		})
+	}
+}
+
+func TestExplainRevocation(t *testing.T) {
+	errLookup := errors.New("blocklist unavailable")
+
+	tests := []struct {
+		name        string
+		checker     RevocationChecker
+		wantValid   bool
+		wantRevoked bool
+		wantErr     error
+	}{
+		{
+			name:      "not revoked",
+			checker:   func(context.Context, *UserClaims) (bool, error) { return false, nil },
+			wantValid: true,
+		},
+		{
+			name:        "revoked",
+			checker:     func(context.Context, *UserClaims) (bool, error) { return true, nil },
+			wantRevoked: true,
+			wantErr:     ErrTokenRevoked,
+		},
+		{
+			name:    "checker failure",
+			checker: func(context.Context, *UserClaims) (bool, error) { return false, errLookup },
+			wantErr: ErrRevocationCheckFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, WithRevocationChecker(tt.checker))
+			report := v.Explain(testToken(keySet))
+
+			if report.Valid != tt.wantValid || report.Revoked != tt.wantRevoked {
+				t.Fatalf("Valid = %t, Revoked = %t, want %t, %t\n%s",
+					report.Valid, report.Revoked, tt.wantValid, tt.wantRevoked, report)
+			}
+			check, ran := findCheck(report, "revocation")
+			if !ran {
+				t.Fatal("the revocation check did not run")
+			}
+			if !errors.Is(check.Err, tt.wantErr) {
+				t.Fatalf("revocation check error = %v, want %v", check.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExplainSkipsRevocationWithoutChecker(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	report := v.Explain(testToken(keySet))
+
+	if !report.Valid || report.Revoked {
+		t.Fatalf("Valid = %t, Revoked = %t, want true, false\n%s", report.Valid, report.Revoked, report)
+	}
+	if _, ran := findCheck(report, "revocation"); ran {
+		t.Fatal("the revocation check ran without a RevocationChecker")
+	}
+}
+
+func TestExplainPoP(t *testing.T) {
+	customBuilder := WithClaimsBuilder(func(c jwt.MapClaims) *UserClaims {
+		sub, _ := c.GetSubject()
+		return &UserClaims{Subject: sub}
+	})
+
+	for _, opts := range [][]Option{nil, {customBuilder}} {
+		v, keySet := newTestValidator(t, opts...)
+		token := testToken(keySet, withCnf(boundCert))
+
+		for _, tt := range []struct {
+			name       string
+			thumbprint string
+			wantValid  bool
+		}{
+			{name: "matching certificate", thumbprint: CertificateThumbprint(boundCert), wantValid: true},
+			{name: "other certificate", thumbprint: CertificateThumbprint(otherCert)},
+			{name: "no client certificate"},
+		} {
+			report := v.ExplainPoP(context.Background(), token, tt.thumbprint)
+			if report.Valid != tt.wantValid {
+				t.Fatalf("%s: Valid = %t, want %t\n%s", tt.name, report.Valid, tt.wantValid, report)
+			}
+			check, ran := findCheck(report, "certificate_binding")
+			if !ran {
+				t.Fatalf("%s: the certificate binding check did not run", tt.name)
+			}
+			if !tt.wantValid && !errors.Is(check.Err, ErrCertificateBindingMismatch) {
+				t.Fatalf("%s: certificate binding error = %v, want ErrCertificateBindingMismatch", tt.name, check.Err)
+			}
+		}
+	}
+
+	// Explain, como Validate, no comprueba la vinculación.
+	v, keySet := newTestValidator(t)
+	if _, ran := findCheck(v.Explain(testToken(keySet)), "certificate_binding"); ran {
+		t.Fatal("Explain ran the certificate binding check")
+	}
+}
@@ -0,0 +1,63 @@
+package azure
+
+import (
+	"net/http"
+	"strings"
+)
+
+// =============================================================================
+// Reenvío de Identidad
+// =============================================================================
+
+// IdentityHeaders asocia cada cabecera reenviada al backend con el valor de UserClaims que transporta.
+type IdentityHeaders map[string]func(claims *UserClaims) string
+
+// DefaultIdentityHeaders devuelve las cabeceras X-User-Sub, X-User-Tenant y X-User-Roles
+// (roles separados por comas).
+func DefaultIdentityHeaders() IdentityHeaders {
+	return IdentityHeaders{
+		"X-User-Sub":    func(c *UserClaims) string { return c.Subject },
+		"X-User-Tenant": func(c *UserClaims) string { return c.TenantID },
+		"X-User-Roles":  func(c *UserClaims) string { return strings.Join(c.Roles, ",") },
+	}
+}
+
+// WithIdentityHeaders hace que el middleware, tras validar el token, reenvíe la identidad al
+// handler siguiente (normalmente un proxy inverso) en las cabeceras indicadas y elimine la
+// cabecera Authorization. Las cabeceras configuradas que envíe el cliente se eliminan siempre,
+// también en las peticiones anónimas de OptionalMiddleware, para que no puedan suplantarse.
+func WithIdentityHeaders(headers IdentityHeaders) Option {
+	return func(v *Validator) {
+		v.identityHeaders = headers
+	}
+}
+
+// forwardIdentity devuelve la petición sin las cabeceras de identidad enviadas por el cliente y,
+// si hay claims, con esas cabeceras rellenadas a partir de ellos y sin la cabecera Authorization.
+func (v *Validator) forwardIdentity(r *http.Request, claims *UserClaims) *http.Request {
+	if len(v.identityHeaders) == 0 {
+		return r
+	}
+
+	// Las cabeceras se copian para no modificar las de la petición original.
+	r = r.WithContext(r.Context())
+	r.Header = r.Header.Clone()
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+
+	for name := range v.identityHeaders {
+		r.Header.Del(name)
+	}
+	if claims == nil {
+		return r
+	}
+
+	r.Header.Del("Authorization")
+	for name, value := range v.identityHeaders {
+		if headerValue := value(claims); headerValue != "" {
+			r.Header.Set(name, headerValue)
+		}
+	}
+	return r
+}
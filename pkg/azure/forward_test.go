@@ -0,0 +1,77 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// spoofedRequest construye una petición con cabeceras de identidad falsificadas por el cliente.
+func spoofedRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	r.Header.Set("X-User-Sub", "admin")
+	r.Header.Add("X-User-Sub", "root")
+	r.Header.Set("X-User-Tenant", otherTenantID)
+	r.Header.Set("X-User-Roles", "admin")
+	return r
+}
+
+func TestWithIdentityHeaders(t *testing.T) {
+	v, keySet := newTestValidator(t, WithIdentityHeaders(DefaultIdentityHeaders()))
+
+	var got http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r := spoofedRequest(testToken(keySet, withClaim("roles", []string{"reader", "writer"})))
+	rec := httptest.NewRecorder()
+	v.Middleware(next).ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	want := map[string]string{
+		"X-User-Sub":    "jwtazuretest-subject",
+		"X-User-Tenant": testTenantID,
+		"X-User-Roles":  "reader,writer",
+	}
+	for name, value := range want {
+		if values := got.Values(name); len(values) != 1 || values[0] != value {
+			t.Errorf("%s = %q, want [%s]", name, values, value)
+		}
+	}
+	if auth := got.Get("Authorization"); auth != "" {
+		t.Errorf("Authorization = %q, want it removed", auth)
+	}
+	// La petición original no se modifica.
+	if r.Header.Get("X-User-Sub") != "admin" {
+		t.Errorf("original X-User-Sub = %q, want it untouched", r.Header.Get("X-User-Sub"))
+	}
+}
+
+func TestWithIdentityHeadersAnonymous(t *testing.T) {
+	v, _ := newTestValidator(t, WithIdentityHeaders(DefaultIdentityHeaders()))
+
+	var got http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	v.OptionalMiddleware(next).ServeHTTP(rec, spoofedRequest(""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// Sin token, las cabeceras falsificadas se eliminan sin reemplazarlas.
+	for _, name := range []string{"X-User-Sub", "X-User-Tenant", "X-User-Roles"} {
+		if values := got.Values(name); len(values) != 0 {
+			t.Errorf("%s = %q, want it removed", name, values)
+		}
+	}
+}
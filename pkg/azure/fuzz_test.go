@@ -0,0 +1,94 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fuzzIssuer y fuzzSecret configuran el validador de FuzzValidateClaims, que firma con HS256
+// los payloads generados para que el fuzzer alcance el código posterior a la firma.
+const fuzzIssuer = "https://fuzz.local"
+
+var fuzzSecret = []byte("jwtazure-fuzz-secret")
+
+// FuzzValidateToken comprueba que Validate no entra en pánico con tokens arbitrarios (segmentos
+// truncados, base64 no válido, JSON mal formado) y que nunca los acepta sin claims.
+func FuzzValidateToken(f *testing.F) {
+	v, keySet := newTestValidator(f)
+	f.Add(testToken(keySet))
+	f.Add("")
+	f.Add("a.b.c")
+	f.Add("eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiIx")
+	f.Add("eyJhbGciOiJSUzI1NiJ9.bnVsbA.")
+
+	f.Fuzz(func(t *testing.T, token string) {
+		claims, err := v.Validate(context.Background(), token)
+		if err == nil && claims == nil {
+			t.Fatal("Validate returned neither claims nor an error")
+		}
+	})
+}
+
+// FuzzValidateClaims firma con HS256 payloads arbitrarios y comprueba que la validación no entra
+// en pánico con mapas nulos ni con claims de tipos inesperados.
+func FuzzValidateClaims(f *testing.F) {
+	v, _ := newTestValidator(f,
+		WithIssuers(fuzzIssuer),
+		WithSymmetricKey(jwt.SigningMethodHS256.Alg(), fuzzSecret),
+		WithoutAudienceValidation(),
+	)
+	f.Add([]byte(`{"iss":"` + fuzzIssuer + `","exp":4102444800}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`{"iss":"` + fuzzIssuer + `","exp":4102444800,"aud":123,"roles":"admin","scp":7,"groups":{"a":1}}`))
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		signingString := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+		signature, err := jwt.SigningMethodHS256.Sign(signingString, fuzzSecret)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+
+		token := signingString + "." + base64.RawURLEncoding.EncodeToString(signature)
+		claims, err := v.Validate(context.Background(), token)
+		if err == nil && claims == nil {
+			t.Fatal("Validate returned neither claims nor an error")
+		}
+		// Un payload `null` decodifica a un mapa de claims nil, que se rechaza como mal formado.
+		if bytes.Equal(bytes.TrimSpace(payload), []byte("null")) && !errors.Is(err, ErrTokenParsingFailed) {
+			t.Fatalf("null payload: got %v, want ErrTokenParsingFailed", err)
+		}
+	})
+}
+
+// FuzzExtractToken comprueba que las fuentes del token no entran en pánico con cabeceras y
+// consultas arbitrarias, ni con peticiones sin URL (nilURL).
+func FuzzExtractToken(f *testing.F) {
+	v, _ := newTestValidator(f, WithTokenFromQuery("access_token"))
+	f.Add("Bearer abc", "access_token=abc", false)
+	f.Add("bearer", "", false)
+	f.Add("Bearer ", "%zz", false)
+	f.Add("", "", true)
+
+	f.Fuzz(func(t *testing.T, header, rawQuery string, nilURL bool) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", header)
+		r.URL.RawQuery = rawQuery
+		if nilURL {
+			r.URL = nil
+		}
+
+		token, err := v.extractToken(r)
+		if err == nil {
+			stripQueryToken(r, token)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package azure
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// =============================================================================
+// Interceptor gRPC
+// =============================================================================
+
+// authorizationMetadataKey es la clave de los metadatos gRPC que transporta el token.
+// gRPC normaliza las claves a minúsculas.
+const authorizationMetadataKey = "authorization"
+
+// UnaryServerInterceptor devuelve un interceptor gRPC unario que valida el token de portador
+// recibido en los metadatos entrantes. Si el token es válido, inyecta los claims en el contexto
+// para que los handlers puedan usar GetClaimsFromContext; si no, responde codes.Unauthenticated,
+// o codes.Unavailable si no se ha podido verificar (sin claves de firma o si falla el
+// RevocationChecker o el GroupResolver).
+func (v *Validator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		tokenString, err := v.authScheme.parseValues(md.Get(authorizationMetadataKey))
+		if err == nil && tokenString == "" {
+			err = ErrMissingAuthHeader
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		claims, err := v.validateToken(ctx, tokenString)
+		if err == nil && v.certificateBinding {
+			err = checkCertificateBinding(claims, grpcPeerCertificateThumbprint(ctx))
+		}
+		if unavailableErr := unavailableError(err); unavailableErr != nil {
+			v.logger.Error("Token verification unavailable", zap.Error(err), zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.Unavailable, unavailableErr.Error())
+		}
+		if err != nil {
+			v.logger.Warn("Token validation failed", zap.Error(err), zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.Unauthenticated, ErrTokenInvalid.Error())
+		}
+
+		return handler(v.injectClaims(ctx, claims, tokenString), req)
+	}
+}
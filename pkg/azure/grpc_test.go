@@ -0,0 +1,119 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newBufconnHealthClient inicia un servidor gRPC en memoria con el servicio de salud, protegido por
+// el interceptor de v, y devuelve un cliente conectado. seen recibe los claims de cada llamada
+// autenticada.
+func newBufconnHealthClient(t *testing.T, v *Validator, seen func(*UserClaims)) healthpb.HealthClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		v.UnaryServerInterceptor(),
+		func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			claims, _ := GetClaimsFromContext(ctx)
+			seen(claims)
+			return handler(ctx, req)
+		},
+	))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	var claims *UserClaims
+	client := newBufconnHealthClient(t, v, func(c *UserClaims) { claims = c })
+
+	tests := []struct {
+		name          string
+		authorization []string
+		want          codes.Code
+	}{
+		{name: "valid token", authorization: []string{"Bearer " + testToken(keySet)}, want: codes.OK},
+		{name: "missing token", want: codes.Unauthenticated},
+		{name: "wrong scheme", authorization: []string{"Basic " + testToken(keySet)}, want: codes.Unauthenticated},
+		{name: "invalid token", authorization: []string{"Bearer " + testToken(keySet, withClaim("aud", "api://other"))}, want: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims = nil
+			ctx := context.Background()
+			for _, value := range tt.authorization {
+				ctx = metadata.AppendToOutgoingContext(ctx, authorizationMetadataKey, value)
+			}
+
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("code = %v, want %v (%v)", got, tt.want, err)
+			}
+			if tt.want == codes.OK && (claims == nil || claims.TenantID != testTenantID) {
+				t.Fatalf("claims in the handler context = %+v, want the token claims", claims)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptorKeysUnavailable(t *testing.T) {
+	_, keySet := newTestValidator(t)
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(&http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("network unreachable")
+		})}),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+	client := newBufconnHealthClient(t, v, func(*UserClaims) {})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authorizationMetadataKey, "Bearer "+testToken(keySet))
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want codes.Unavailable", err)
+	}
+}
+
+func TestUnaryServerInterceptorRevocationCheckFailed(t *testing.T) {
+	v, keySet := newTestValidator(t, WithRevocationChecker(func(context.Context, *UserClaims) (bool, error) {
+		return false, errors.New("blocklist unavailable")
+	}))
+	client := newBufconnHealthClient(t, v, func(*UserClaims) {})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authorizationMetadataKey, "Bearer "+testToken(keySet))
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want codes.Unavailable", err)
+	}
+}
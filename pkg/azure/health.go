@@ -0,0 +1,137 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// =============================================================================
+// Estado de los JWKS
+// =============================================================================
+
+// HealthStatus describe el estado del material de claves del validador.
+type HealthStatus struct {
+	// KeysLoaded indica si todos los endpoints tienen al menos una clave cargada.
+	KeysLoaded bool
+	Endpoints  []EndpointHealth
+}
+
+// EndpointHealth describe el estado del JWKS de un endpoint.
+type EndpointHealth struct {
+	// Endpoint es "v1", "v2" o "static" (WithStaticJWKS, sin URL).
+	Endpoint   string
+	URL        string
+	KeysLoaded bool
+	// LastRefresh es el momento de la última descarga correcta; cero si aún no hubo ninguna.
+	LastRefresh time.Time
+	// LastError es el último error de descarga, o nil si la última descarga fue correcta.
+	LastError error
+}
+
+// StaleFor devuelve cuánto tiempo ha pasado desde el refresco correcto más antiguo entre
+// todos los endpoints, para alertar cuando los JWKS lleven demasiado sin actualizarse.
+// Si algún endpoint no se ha descargado nunca, devuelve el tiempo transcurrido desde el instante cero.
+func (h HealthStatus) StaleFor(now time.Time) time.Duration {
+	var stale time.Duration
+	for _, endpoint := range h.Endpoints {
+		stale = max(stale, now.Sub(endpoint.LastRefresh))
+	}
+	return stale
+}
+
+// Health devuelve el estado de los JWKS de cada endpoint: si hay claves cargadas, cuándo fue
+// la última descarga correcta y el último error. Pensado para sondas de liveness/readiness.
+func (v *Validator) Health() HealthStatus {
+	status := HealthStatus{KeysLoaded: true}
+	for _, jwks := range v.keySets() {
+		keys, err := jwks.Storage().KeyReadAll(context.Background())
+		loaded := err == nil && len(keys) > 0
+		jwksURL := jwks.jwksURL()
+
+		status.KeysLoaded = status.KeysLoaded && loaded
+		status.Endpoints = append(status.Endpoints, EndpointHealth{
+			Endpoint:    jwks.endpoint,
+			URL:         jwksURL,
+			KeysLoaded:  loaded,
+			LastRefresh: v.refreshStatus.lastRefresh(jwksURL),
+			LastError:   v.refreshStatus.get(jwksURL),
+		})
+	}
+	return status
+}
+
+// trackingClient devuelve una copia del cliente HTTP del validador que registra cada descarga
+// correcta de la URL indicada, ya que jwkset solo notifica los errores. Una descarga solo es
+// correcta si la respuesta contiene un JWK Set con claves que jwkset puede cargar.
+func (v *Validator) trackingClient(jwksURL string) *http.Client {
+	client := v.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	tracking := *client
+	tracking.Transport = &refreshTrackingTransport{
+		next: next,
+		onSuccess: func() {
+			v.refreshStatus.recordSuccess(jwksURL, time.Now())
+		},
+	}
+	return &tracking
+}
+
+// refreshTrackingTransport invoca onSuccess cuando una petición recibe 200 OK con un JWK Set
+// válido y no vacío. Lee el cuerpo completo para comprobarlo y lo repone para jwkset.
+type refreshTrackingTransport struct {
+	next      http.RoundTripper
+	onSuccess func()
+}
+
+// RoundTrip implementa http.RoundTripper.
+func (t *refreshTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if parseJWKS(body) == nil {
+		t.onSuccess()
+	}
+	return resp, nil
+}
+
+// parseJWKS comprueba que body sea un JWK Set con al menos una clave, interpretándolo igual que
+// jwkset al refrescar el almacenamiento HTTP.
+func parseJWKS(body []byte) error {
+	var jwks jwkset.JWKSMarshal
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&jwks); err != nil {
+		return err
+	}
+	if len(jwks.Keys) == 0 {
+		return errEmptyJWKS
+	}
+
+	for _, marshal := range jwks.Keys {
+		if _, err := jwkset.NewJWKFromMarshal(marshal, jwkset.JWKMarshalOptions{Private: true}, jwkset.JWKValidateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package azure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	before := time.Now()
+	v, _ := newTestValidator(t)
+
+	status := v.Health()
+	if !status.KeysLoaded || len(status.Endpoints) != 2 {
+		t.Fatalf("Health() = %+v, want keys loaded for both endpoints", status)
+	}
+	for _, endpoint := range status.Endpoints {
+		if !endpoint.KeysLoaded || endpoint.LastError != nil {
+			t.Errorf("%s: KeysLoaded = %t, LastError = %v; want loaded without error", endpoint.Endpoint, endpoint.KeysLoaded, endpoint.LastError)
+		}
+		if endpoint.LastRefresh.Before(before) {
+			t.Errorf("%s: LastRefresh = %v, want after %v", endpoint.Endpoint, endpoint.LastRefresh, before)
+		}
+	}
+	if stale := status.StaleFor(time.Now()); stale > time.Minute {
+		t.Fatalf("StaleFor = %v right after the fetch", stale)
+	}
+}
+
+func TestHealthWithoutKeys(t *testing.T) {
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(unreachableClient()),
+		WithLazyJWKS(),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+	_ = v.RefreshKeys(context.Background())
+
+	status := v.Health()
+	if status.KeysLoaded {
+		t.Fatal("KeysLoaded = true with an unreachable JWKS")
+	}
+	for _, endpoint := range status.Endpoints {
+		if endpoint.KeysLoaded || !endpoint.LastRefresh.IsZero() || endpoint.LastError == nil {
+			t.Errorf("%s: %+v, want no keys, no refresh and an error", endpoint.Endpoint, endpoint)
+		}
+	}
+}
+
+func TestHealthIgnoresUnusableResponses(t *testing.T) {
+	for name, body := range map[string]string{
+		"not json":  "<html>maintenance</html>",
+		"empty set": `{"keys":[]}`,
+		"bad key":   `{"keys":[{"kty":"RSA","kid":"k1","n":"!","e":"AQAB"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Un 200 cuyo cuerpo no aporta claves no cuenta como refresco correcto.
+			client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{},
+					Body:       io.NopCloser(strings.NewReader(body)),
+					Request:    r,
+				}, nil
+			})}
+			v, err := NewValidator(context.Background(), testTenantID,
+				WithAudiences(testAudience),
+				WithHTTPClient(client),
+				WithNoOpLogger(),
+			)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			for _, endpoint := range v.Health().Endpoints {
+				if !endpoint.LastRefresh.IsZero() {
+					t.Errorf("%s: LastRefresh = %v, want no successful refresh", endpoint.Endpoint, endpoint.LastRefresh)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package azure
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+)
+
+// =============================================================================
+// ID Tokens (OpenID Connect)
+// =============================================================================
+
+// ValidateIDToken valida un ID token de OpenID Connect: además de la firma, el emisor y las
+// fechas, exige que la audiencia sea uno de los client ID configurados con WithAudiences (aunque
+// se haya usado WithoutAudienceValidation) y, si expectedNonce no está vacío, que el claim `nonce`
+// coincida con el enviado en la petición de autenticación. La validación de access tokens no cambia.
+func (v *Validator) ValidateIDToken(ctx context.Context, tokenString, expectedNonce string) (*UserClaims, error) {
+	clientIDs := v.audiences()
+	if len(clientIDs) == 0 {
+		return nil, fmt.Errorf("%w: no hay client ID configurados con WithAudiences", ErrInvalidAudience)
+	}
+
+	claims, err := v.validateTokenFor(ctx, tokenString, audienceCheck{enabled: true, audiences: clientIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedNonce != "" {
+		nonce, _ := claims.RawClaims["nonce"].(string)
+		if subtle.ConstantTimeCompare([]byte(nonce), []byte(expectedNonce)) != 1 {
+			return nil, newValidationError(ErrInvalidNonce, "nonce", expectedNonce, nonce)
+		}
+	}
+
+	return claims, nil
+}
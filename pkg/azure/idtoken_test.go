@@ -0,0 +1,46 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateIDToken(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	token := testToken(keySet, withClaim("nonce", "n-0S6_WzA2Mj"))
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr error
+	}{
+		{name: "matching nonce", token: token, nonce: "n-0S6_WzA2Mj"},
+		{name: "mismatching nonce", token: token, nonce: "n-other", wantErr: ErrInvalidNonce},
+		{name: "missing nonce", token: testToken(keySet), nonce: "n-0S6_WzA2Mj", wantErr: ErrInvalidNonce},
+		{name: "nonce not checked", token: testToken(keySet)},
+		{name: "other client ID", token: testToken(keySet, withClaim("aud", "api://other"), withClaim("nonce", "n-0S6_WzA2Mj")), nonce: "n-0S6_WzA2Mj", wantErr: ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.ValidateIDToken(context.Background(), tt.token, tt.nonce); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateIDTokenIgnoresWithoutAudienceValidation(t *testing.T) {
+	v, keySet := newTestValidator(t, WithoutAudienceValidation())
+	token := testToken(keySet, withClaim("aud", "api://other"))
+
+	// Los access tokens no comprueban la audiencia; los ID tokens siguen exigiendo el client ID.
+	if _, err := v.Validate(context.Background(), token); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if _, err := v.ValidateIDToken(context.Background(), token, ""); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("ValidateIDToken: got %v, want ErrInvalidAudience", err)
+	}
+}
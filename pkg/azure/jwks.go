@@ -0,0 +1,425 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// Nombres de los endpoints JWKS, usados en los logs y en Health.
+const (
+	endpointV1     = "v1"
+	endpointV2     = "v2"
+	endpointStatic = "static"
+)
+
+const (
+	// defaultRefreshInterval es la frecuencia por defecto con la que se refresca el JWKS en segundo plano.
+	defaultRefreshInterval = time.Hour
+	// defaultRateLimitWaitMax es la espera máxima ante un `kid` desconocido antes de desistir.
+	defaultRateLimitWaitMax = time.Minute
+	// defaultRefreshUnknownKID limita los refrescos provocados por un `kid` desconocido.
+	defaultRefreshUnknownKID = 5 * time.Minute
+	// unavailableRetryAfter es el valor de Retry-After cuando el token no se ha podido verificar,
+	// p. ej. porque no hay claves con las que hacerlo (ver unavailableError).
+	unavailableRetryAfter = 30 * time.Second
+	// waitForKeysInterval es la frecuencia con la que WaitForKeys comprueba si hay claves cargadas.
+	waitForKeysInterval = 100 * time.Millisecond
+)
+
+// errEmptyJWKS indica que la descarga de un JWKS no produjo ninguna clave.
+var errEmptyJWKS = errors.New("el JWKS no contiene claves")
+
+// refreshStatus guarda, para cada URL de JWKS, el último error de descarga observado y el
+// momento de la última descarga correcta.
+type refreshStatus struct {
+	mu          sync.Mutex
+	byURL       map[string]error
+	lastSuccess map[string]time.Time
+}
+
+// record guarda el último error de descarga de la URL indicada.
+func (e *refreshStatus) record(jwksURL string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.byURL == nil {
+		e.byURL = make(map[string]error)
+	}
+	e.byURL[jwksURL] = fmt.Errorf("%s: %w", jwksURL, err)
+}
+
+// recordSuccess guarda una descarga correcta de la URL indicada y descarta su último error.
+func (e *refreshStatus) recordSuccess(jwksURL string, at time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lastSuccess == nil {
+		e.lastSuccess = make(map[string]time.Time)
+	}
+	e.lastSuccess[jwksURL] = at
+	delete(e.byURL, jwksURL)
+}
+
+// lastRefresh devuelve el momento de la última descarga correcta de la URL, o cero si no hubo ninguna.
+func (e *refreshStatus) lastRefresh(jwksURL string) time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastSuccess[jwksURL]
+}
+
+// get devuelve el último error registrado para la URL indicada, o nil si no hay ninguno.
+func (e *refreshStatus) get(jwksURL string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.byURL[jwksURL]
+}
+
+// join devuelve todos los errores registrados combinados, o nil si no hay ninguno.
+func (e *refreshStatus) join() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	errs := make([]error, 0, len(e.byURL))
+	for _, err := range e.byURL {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// newJWKS construye un keyfunc.Keyfunc para la URL indicada a partir de la configuración
+// del validador. Replica los valores por defecto de keyfunc.NewDefaultCtx, pero permite
+// inyectar el cliente HTTP y el resto de ajustes que keyfunc no expone.
+func (v *Validator) newJWKS(ctx context.Context, endpoint, jwksURL string) (keyfunc.Keyfunc, error) {
+	remote, err := jwkset.NewStorageFromHTTP(jwksURL, jwkset.HTTPClientStorageOptions{
+		Client:                    v.trackingClient(jwksURL),
+		Ctx:                       ctx,
+		NoErrorReturnFirstHTTPReq: true,
+		RefreshErrorHandler: func(_ context.Context, err error) {
+			v.refreshStatus.record(jwksURL, err)
+			v.logger.Warn("JWKS refresh failed",
+				zap.String("endpoint", endpoint),
+				zap.String("url", jwksURL),
+				zap.Error(err),
+			)
+			if v.refreshErrorHandler != nil {
+				v.refreshErrorHandler(fmt.Errorf("%s: %w", jwksURL, err))
+			}
+		},
+		RefreshInterval: v.refreshInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fallo al crear el almacenamiento HTTP para %q: %w", jwksURL, err)
+	}
+
+	// Ante un `kid` desconocido (p. ej. tras una rotación de claves de Azure) se descarga de nuevo
+	// el JWKS y se reintenta, limitado a un refresco por intervalo. Si el limitador no permite
+	// refrescar dentro de la espera máxima, la búsqueda falla de inmediato.
+	var refreshUnknownKID *rate.Limiter
+	if v.unknownKIDRefreshInterval > 0 {
+		refreshUnknownKID = rate.NewLimiter(rate.Every(v.unknownKIDRefreshInterval), 1)
+	}
+
+	storage, err := jwkset.NewHTTPClient(jwkset.HTTPClientOptions{
+		HTTPURLs:          map[string]jwkset.Storage{jwksURL: remote},
+		RateLimitWaitMax:  defaultRateLimitWaitMax,
+		RefreshUnknownKID: refreshUnknownKID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fallo al crear el cliente JWKS: %w", err)
+	}
+
+	return keyfunc.New(keyfunc.Options{
+		Ctx:     ctx,
+		Storage: storage,
+	})
+}
+
+// refreshableJWKS implementa keyfunc.Keyfunc sobre el JWKS de una URL que puede reconstruirse
+// con RefreshKeys. Cada generación tiene su propio contexto, que se cancela al reemplazarla
+// para detener su gorutina de refresco. La URL puede cambiar entre generaciones cuando procede
+// del documento de descubrimiento (NewDiscoveryValidator).
+type refreshableJWKS struct {
+	ctx      context.Context
+	endpoint string
+
+	mu      sync.RWMutex
+	url     string
+	current keyfunc.Keyfunc
+	cancel  context.CancelFunc
+}
+
+// loadJWKS construye el JWKS de la URL indicada: de inmediato o, con WithLazyJWKS, en segundo plano.
+func (v *Validator) loadJWKS(ctx context.Context, endpoint, jwksURL string) (*refreshableJWKS, error) {
+	genCtx, cancel := context.WithCancel(ctx)
+
+	var jwks keyfunc.Keyfunc
+	if v.lazyJWKS {
+		jwks = v.newLazyJWKS(genCtx, endpoint, jwksURL)
+	} else {
+		var err error
+		if jwks, err = v.newJWKS(genCtx, endpoint, jwksURL); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	return &refreshableJWKS{ctx: ctx, endpoint: endpoint, url: jwksURL, current: jwks, cancel: cancel}, nil
+}
+
+// newStaticJWKS construye el JWKS proporcionado con WithStaticJWKS, que no se descarga ni se
+// refresca. Falla si el JSON no es un JWK Set válido o no contiene claves.
+func (v *Validator) newStaticJWKS(ctx context.Context, jwksJSON []byte) (*refreshableJWKS, error) {
+	jwks, err := keyfunc.NewJWKSetJSON(jwksJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := jwks.Storage().KeyReadAll(ctx)
+	if err == nil && len(keys) == 0 {
+		err = errEmptyJWKS
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Las claves estáticas se consideran descargadas al construir el validador.
+	v.refreshStatus.recordSuccess("", time.Now())
+	return &refreshableJWKS{ctx: ctx, endpoint: endpointStatic, current: jwks, cancel: func() {}}, nil
+}
+
+// load devuelve la generación actual del JWKS.
+func (r *refreshableJWKS) load() keyfunc.Keyfunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// jwksURL devuelve la URL de la generación actual, o "" para el JWKS estático.
+func (r *refreshableJWKS) jwksURL() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.url
+}
+
+// swap reemplaza la generación actual, descargada de jwksURL, y detiene la anterior.
+func (r *refreshableJWKS) swap(jwksURL string, jwks keyfunc.Keyfunc, cancel context.CancelFunc) {
+	r.mu.Lock()
+	previousCancel := r.cancel
+	r.url, r.current, r.cancel = jwksURL, jwks, cancel
+	r.mu.Unlock()
+
+	previousCancel()
+}
+
+// Keyfunc implementa keyfunc.Keyfunc.
+func (r *refreshableJWKS) Keyfunc(token *jwt.Token) (any, error) {
+	return r.load().Keyfunc(token)
+}
+
+// KeyfuncCtx implementa keyfunc.Keyfunc.
+func (r *refreshableJWKS) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return r.load().KeyfuncCtx(ctx)
+}
+
+// Storage implementa keyfunc.Keyfunc.
+func (r *refreshableJWKS) Storage() jwkset.Storage {
+	return r.load().Storage()
+}
+
+// RefreshKeys descarga de inmediato todos los JWKS configurados, sin esperar al siguiente refresco
+// programado. Útil tras una rotación de claves fuera de ciclo, p. ej. desde una señal SIGHUP o un
+// endpoint de administración. Si la descarga de un JWKS falla, se conservan sus claves anteriores.
+func (v *Validator) RefreshKeys(ctx context.Context) error {
+	if v.closed.Load() {
+		return ErrValidatorClosed
+	}
+
+	var errs []error
+	// Con NewDiscoveryValidator se descarga antes el documento de descubrimiento, por si la URL
+	// del JWKS ha cambiado.
+	if v.discovery != nil {
+		if err := v.refreshDiscovery(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, jwks := range v.keySets() {
+		jwksURL := jwks.jwksURL()
+		// El JWKS estático (WithStaticJWKS) no tiene URL de la que descargarse.
+		if jwksURL == "" {
+			continue
+		}
+		if err := v.refreshJWKS(ctx, jwks, jwksURL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refreshJWKS construye una nueva generación del JWKS a partir de jwksURL y, si se descargó alguna
+// clave, reemplaza la actual.
+func (v *Validator) refreshJWKS(ctx context.Context, jwks *refreshableJWKS, jwksURL string) error {
+	genCtx, cancel := context.WithCancel(jwks.ctx)
+	// La descarga inicial respeta el contexto del llamador; la generación resultante, no.
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	next, err := v.newJWKS(genCtx, jwks.endpoint, jwksURL)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	// El almacenamiento no devuelve el error de la descarga inicial; un JWKS vacío indica que falló.
+	keys, err := next.Storage().KeyReadAll(ctx)
+	if err == nil && len(keys) == 0 {
+		err = errors.Join(errEmptyJWKS, v.refreshStatus.get(jwksURL), ctx.Err())
+	}
+	if err != nil {
+		cancel()
+		return fmt.Errorf("fallo al refrescar el JWKS %s: %w", jwksURL, err)
+	}
+
+	jwks.swap(jwksURL, next, cancel)
+	return nil
+}
+
+// lazyJWKS implementa keyfunc.Keyfunc sobre un JWKS que se construye en segundo plano.
+// Mientras no esté listo, las búsquedas de clave esperan a que lo esté o a que expire su contexto.
+type lazyJWKS struct {
+	ready chan struct{}
+	jwks  keyfunc.Keyfunc
+	err   error
+}
+
+// newLazyJWKS inicia la construcción del JWKS en segundo plano y devuelve inmediatamente.
+func (v *Validator) newLazyJWKS(ctx context.Context, endpoint, jwksURL string) *lazyJWKS {
+	l := &lazyJWKS{ready: make(chan struct{})}
+	go func() {
+		defer close(l.ready)
+		l.jwks, l.err = v.newJWKS(ctx, endpoint, jwksURL)
+		if l.err != nil {
+			v.refreshStatus.record(jwksURL, l.err)
+			v.logger.Warn("JWKS creation failed",
+				zap.String("endpoint", endpoint),
+				zap.String("url", jwksURL),
+				zap.Error(l.err),
+			)
+		}
+	}()
+	return l
+}
+
+// Keyfunc implementa keyfunc.Keyfunc.
+func (l *lazyJWKS) Keyfunc(token *jwt.Token) (any, error) {
+	return l.KeyfuncCtx(context.Background())(token)
+}
+
+// KeyfuncCtx implementa keyfunc.Keyfunc, esperando a que el JWKS esté construido.
+func (l *lazyJWKS) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		select {
+		case <-l.ready:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("el JWKS aún no está disponible: %w", ctx.Err())
+		}
+		if l.err != nil {
+			return nil, l.err
+		}
+		return l.jwks.KeyfuncCtx(ctx)(token)
+	}
+}
+
+// Storage implementa keyfunc.Keyfunc. Mientras el JWKS no esté construido devuelve un
+// almacenamiento vacío, de modo que WaitForKeys siga esperando.
+func (l *lazyJWKS) Storage() jwkset.Storage {
+	select {
+	case <-l.ready:
+		if l.err == nil {
+			return l.jwks.Storage()
+		}
+	default:
+	}
+	return jwkset.NewMemoryStorage()
+}
+
+// keySets devuelve los JWKS configurados en orden de búsqueda: primero v2 y después v1.
+func (v *Validator) keySets() []*refreshableJWKS {
+	sets := make([]*refreshableJWKS, 0, 2)
+	for _, jwks := range []*refreshableJWKS{v.jwksV2, v.jwksV1} {
+		if jwks != nil {
+			sets = append(sets, jwks)
+		}
+	}
+	return sets
+}
+
+// WaitForKeys bloquea hasta que todos los JWKS configurados hayan cargado al menos una clave,
+// o hasta que el contexto expire. Permite condicionar la sonda de readiness del servicio a que
+// el validador pueda verificar firmas. Si el contexto expira, el error incluye el último fallo
+// de descarga observado para cada endpoint.
+func (v *Validator) WaitForKeys(ctx context.Context) error {
+	ticker := time.NewTicker(waitForKeysInterval)
+	defer ticker.Stop()
+
+	for {
+		if v.keysLoaded(ctx) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("los JWKS no se cargaron a tiempo: %w", errors.Join(ctx.Err(), v.refreshStatus.join()))
+		case <-ticker.C:
+		}
+	}
+}
+
+// keysLoaded indica si todos los JWKS configurados tienen al menos una clave cargada.
+func (v *Validator) keysLoaded(ctx context.Context) bool {
+	for _, jwks := range v.keySets() {
+		keys, err := jwks.Storage().KeyReadAll(ctx)
+		if err != nil || len(keys) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hasKeys indica si alguno de los JWKS configurados tiene al menos una clave cargada.
+func (v *Validator) hasKeys(ctx context.Context) bool {
+	for _, jwks := range v.keySets() {
+		keys, err := jwks.Storage().KeyReadAll(ctx)
+		if err == nil && len(keys) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyIDs devuelve, ordenados y sin duplicados, los `kid` de las claves cargadas actualmente en
+// todos los JWKS. Sirve para diagnosticar errores de `kid` desconocido: si el `kid` del token no
+// aparece, las claves aún no se han refrescado (ver RefreshKeys).
+func (v *Validator) KeyIDs() []string {
+	var kids []string
+	for _, jwks := range v.keySets() {
+		keys, err := jwks.Storage().KeyReadAll(context.Background())
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			if kid := key.Marshal().KID; kid != "" {
+				kids = append(kids, kid)
+			}
+		}
+	}
+
+	slices.Sort(kids)
+	return slices.Compact(kids)
+}
@@ -0,0 +1,733 @@
+package azure
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// countingClient devuelve un cliente que envía las peticiones por next y cuenta cuántas hizo.
+func countingClient(next *http.Client, requests *atomic.Int32) *http.Client {
+	return &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			requests.Add(1)
+			return next.Transport.RoundTrip(r)
+		}),
+	}
+}
+
+// requestLog registra las URLs que se piden a través de su cliente.
+type requestLog struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+// client devuelve un cliente que registra cada petición y la envía por next.
+func (l *requestLog) client(next *http.Client) *http.Client {
+	return &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			l.mu.Lock()
+			l.urls = append(l.urls, r.URL.String())
+			l.mu.Unlock()
+			return next.Transport.RoundTrip(r)
+		}),
+	}
+}
+
+// sorted devuelve las URLs pedidas hasta ahora, ordenadas.
+func (l *requestLog) sorted() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Sorted(slices.Values(l.urls))
+}
+
+// signingKey es una clave de prueba que se publica en un JWKS con su `kid` y su algoritmo.
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+// newSigningKey genera una clave del tipo que requiere method (RSA para RS*/PS*, P-256 para ES256).
+func newSigningKey(t *testing.T, kid string, method jwt.SigningMethod) signingKey {
+	t.Helper()
+
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch method.(type) {
+	case *jwt.SigningMethodECDSA:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatalf("generate %s key: %v", method.Alg(), err)
+	}
+
+	return signingKey{kid: kid, method: method, key: key}
+}
+
+// sign firma claims de prueba válidos con la clave, tras aplicar mutate.
+func (k signingKey) sign(t *testing.T, mutate ...func(jwt.MapClaims)) string {
+	t.Helper()
+
+	claims := jwtazuretest.Claims(testTenantID, testAudience)
+	for _, fn := range mutate {
+		fn(claims)
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+// serveJWKS publica keys en un servidor de prueba y devuelve un cliente que le redirige cualquier
+// petición.
+func serveJWKS(t *testing.T, keys ...signingKey) *http.Client {
+	t.Helper()
+
+	var jwks jwkset.JWKSMarshal
+	for _, k := range keys {
+		jwk, err := jwkset.NewJWKFromKey(k.key.Public(), jwkset.JWKOptions{
+			Metadata: jwkset.JWKMetadataOptions{ALG: jwkset.ALG(k.method.Alg()), KID: k.kid, USE: jwkset.UseSig},
+		})
+		if err != nil {
+			t.Fatalf("jwkset.NewJWKFromKey: %v", err)
+		}
+		jwks.Keys = append(jwks.Keys, jwk.Marshal())
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	return redirectClient(server.URL)
+}
+
+// redirectClient devuelve un cliente que envía cualquier petición al servidor de serverURL,
+// conservando la ruta.
+func redirectClient(serverURL string) *http.Client {
+	target, _ := url.Parse(serverURL)
+	return &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			r = r.Clone(r.Context())
+			r.URL.Scheme, r.URL.Host, r.Host = target.Scheme, target.Host, target.Host
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	var requests atomic.Int32
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(countingClient(keySet.HTTPClient(), &requests)),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	// Las URLs de Azure solo resuelven a través del cliente inyectado, que las redirige al KeySet.
+	if got := requests.Load(); got == 0 {
+		t.Fatal("the JWKS was not fetched through the injected client")
+	}
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+// delayedClient devuelve un cliente que responde 503 hasta que pase delay y después envía las
+// peticiones por next, como un JWKS que tarda en estar disponible.
+func delayedClient(next *http.Client, delay time.Duration) *http.Client {
+	ready := time.Now().Add(delay)
+	return &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if time.Now().Before(ready) {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Body:       io.NopCloser(strings.NewReader("")),
+					Request:    r,
+				}, nil
+			}
+			return next.Transport.RoundTrip(r)
+		}),
+	}
+}
+
+func TestWaitForKeys(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		timeout time.Duration
+		wantErr bool
+	}{
+		{name: "keys load after a delay", delay: 200 * time.Millisecond, timeout: 5 * time.Second},
+		{name: "keys never load", delay: time.Hour, timeout: 200 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(context.Background(), testTenantID,
+				WithAudiences(testAudience),
+				WithHTTPClient(delayedClient(keySet.HTTPClient(), tt.delay)),
+				WithRefreshInterval(20*time.Millisecond),
+				WithNoOpLogger(),
+			)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			if _, err := v.Validate(context.Background(), testToken(keySet)); err == nil {
+				t.Fatal("Validate before the keys loaded: expected an error")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err = v.WaitForKeys(ctx)
+			if tt.wantErr {
+				if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "503") {
+					t.Fatalf("WaitForKeys: got %v, want the deadline and the load error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WaitForKeys: %v", err)
+			}
+			if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+				t.Fatalf("Validate after WaitForKeys: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithoutEndpoint(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	tests := []struct {
+		name string
+		opt  Option
+		want string
+	}{
+		{name: "without v1", opt: WithoutV1Endpoint(), want: "https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys"},
+		{name: "without v2", opt: WithoutV2Endpoint(), want: "https://login.microsoftonline.com/" + testTenantID + "/discovery/keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests requestLog
+			v, err := NewValidator(context.Background(), testTenantID,
+				WithAudiences(testAudience),
+				WithHTTPClient(requests.client(keySet.HTTPClient())),
+				WithNoOpLogger(),
+				tt.opt,
+			)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			if got := requests.sorted(); !slices.Equal(got, []string{tt.want}) {
+				t.Fatalf("requested %v, want only %s", got, tt.want)
+			}
+			if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+		})
+	}
+
+	if _, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+		WithoutV1Endpoint(),
+		WithoutV2Endpoint(),
+	); err == nil {
+		t.Fatal("NewValidator without any endpoint: expected an error")
+	}
+}
+
+// unreachableClient devuelve un cliente cuyas peticiones fallan siempre, como sin red.
+func unreachableClient() *http.Client {
+	return &http.Client{
+		Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("network is unreachable")
+		}),
+	}
+}
+
+func TestNewValidatorWithUnreachableJWKS(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "eager"},
+		{name: "lazy", opts: []Option{WithLazyJWKS()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(context.Background(), testTenantID, append([]Option{
+				WithAudiences(testAudience),
+				WithHTTPClient(unreachableClient()),
+				WithNoOpLogger(),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("NewValidator with an unreachable JWKS: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			keySet := jwtazuretest.NewKeySet()
+			t.Cleanup(keySet.Close)
+			if _, err := v.Validate(context.Background(), testToken(keySet)); !errors.Is(err, ErrKeySourceUnavailable) {
+				t.Fatalf("Validate: got %v, want ErrKeySourceUnavailable", err)
+			}
+		})
+	}
+}
+
+func TestWithLazyJWKS(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	// Las descargas quedan retenidas hasta release: la construcción no debe esperarlas.
+	release := make(chan struct{})
+	client := &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			}
+			return keySet.HTTPClient().Transport.RoundTrip(r)
+		}),
+	}
+
+	built := make(chan *Validator, 1)
+	go func() {
+		v, err := NewValidator(context.Background(), testTenantID,
+			WithAudiences(testAudience),
+			WithHTTPClient(client),
+			WithLazyJWKS(),
+			WithNoOpLogger(),
+		)
+		if err != nil {
+			t.Errorf("NewValidator: %v", err)
+		}
+		built <- v
+	}()
+
+	var v *Validator
+	select {
+	case v = <-built:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewValidator waited for the JWKS download")
+	}
+	if v == nil {
+		return
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	// La primera validación espera a la descarga inicial, acotada por su contexto.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := v.Validate(ctx, testToken(keySet)); err == nil {
+		t.Fatal("Validate before the JWKS downloaded: expected an error")
+	}
+
+	close(release)
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate after the JWKS downloaded: %v", err)
+	}
+}
+
+// statusClient devuelve un cliente que responde siempre con el código indicado.
+func statusClient(code int) *http.Client {
+	return &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: code,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader("")),
+				Request:    r,
+			}, nil
+		}),
+	}
+}
+
+func TestWithRefreshErrorHandler(t *testing.T) {
+	errs := make(chan error, 16)
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(statusClient(http.StatusInternalServerError)),
+		WithRefreshInterval(20*time.Millisecond),
+		WithRefreshErrorHandler(func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}),
+		WithoutV1Endpoint(),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	select {
+	case err := <-errs:
+		jwksURL := "https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys"
+		if !strings.Contains(err.Error(), jwksURL) || !strings.Contains(err.Error(), "500") {
+			t.Fatalf("refresh error = %v, want the JWKS URL and the 500 status", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the refresh error handler was not called")
+	}
+}
+
+func TestJWKSRefreshErrorLogged(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(statusClient(http.StatusInternalServerError)),
+		WithRefreshInterval(20*time.Millisecond),
+		WithoutV1Endpoint(),
+		WithLogger(zap.New(core)),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	failed := func() []observer.LoggedEntry { return logs.FilterMessage("JWKS refresh failed").All() }
+	waitFor(t, "the JWKS refresh failure to be logged", func() bool { return len(failed()) > 0 })
+
+	entry := failed()[0]
+	fields := entry.ContextMap()
+	if entry.Level != zapcore.WarnLevel {
+		t.Fatalf("level = %s, want warn", entry.Level)
+	}
+	if fields["endpoint"] != endpointV2 {
+		t.Fatalf("endpoint = %v, want %q", fields["endpoint"], endpointV2)
+	}
+	if fields["url"] != "https://login.microsoftonline.com/"+testTenantID+"/discovery/v2.0/keys" {
+		t.Fatalf("url = %v, want the v2 JWKS URL", fields["url"])
+	}
+	if msg, _ := fields["error"].(string); !strings.Contains(msg, "500") {
+		t.Fatalf("error = %v, want the 500 status", fields["error"])
+	}
+}
+
+func TestMiddlewareKeySourceUnavailable(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	tests := []struct {
+		name   string
+		client *http.Client
+	}{
+		{name: "unreachable", client: unreachableClient()},
+		{name: "server error", client: statusClient(http.StatusBadGateway)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(context.Background(), testTenantID,
+				WithAudiences(testAudience),
+				WithHTTPClient(tt.client),
+				WithNoOpLogger(),
+			)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			rec := serve(v.Middleware(okHandler), testToken(keySet))
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+			}
+			if got := rec.Header().Get("Retry-After"); got != "30" {
+				t.Fatalf("Retry-After = %q, want 30", got)
+			}
+			if p := decodeProblem(t, rec.Body.Bytes()); p.Type != "urn:jwtazure:key-source-unavailable" {
+				t.Fatalf("problem type = %q, want urn:jwtazure:key-source-unavailable", p.Type)
+			}
+		})
+	}
+
+	// Con las claves cargadas, un token inválido sigue respondiendo 401.
+	v, _ := newTestValidator(t)
+	if rec := serve(v.Middleware(okHandler), "not-a-jwt"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("malformed token with keys loaded: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshKeys(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	var requests requestLog
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(requests.client(keySet.HTTPClient())),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+
+	v1URL := "https://login.microsoftonline.com/" + testTenantID + "/discovery/keys"
+	v2URL := "https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys"
+	if got := requests.sorted(); !slices.Equal(got, []string{v1URL, v2URL}) {
+		t.Fatalf("requested %v at startup, want %v", got, []string{v1URL, v2URL})
+	}
+
+	// RefreshKeys descarga de nuevo los dos endpoints, sin esperar al refresco programado.
+	if err := v.RefreshKeys(context.Background()); err != nil {
+		t.Fatalf("RefreshKeys: %v", err)
+	}
+	if got := requests.sorted(); !slices.Equal(got, []string{v1URL, v1URL, v2URL, v2URL}) {
+		t.Fatalf("requested %v after RefreshKeys, want each endpoint twice", got)
+	}
+
+	_ = v.Close()
+	if err := v.RefreshKeys(context.Background()); !errors.Is(err, ErrValidatorClosed) {
+		t.Fatalf("RefreshKeys after Close: got %v, want ErrValidatorClosed", err)
+	}
+}
+
+func TestKeyIDs(t *testing.T) {
+	client := serveJWKS(t,
+		newSigningKey(t, "key-b", jwt.SigningMethodRS256),
+		newSigningKey(t, "key-a", jwt.SigningMethodRS256),
+	)
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(client),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	// Los dos endpoints publican las mismas claves: KeyIDs devuelve la unión, ordenada y sin duplicados.
+	if got := v.KeyIDs(); !slices.Equal(got, []string{"key-a", "key-b"}) {
+		t.Fatalf("KeyIDs() = %v, want [key-a key-b]", got)
+	}
+}
+
+func TestJWKSKeyTypes(t *testing.T) {
+	rs256 := newSigningKey(t, "rs256-key", jwt.SigningMethodRS256)
+	ps256 := newSigningKey(t, "ps256-key", jwt.SigningMethodPS256)
+	es256 := newSigningKey(t, "es256-key", jwt.SigningMethodES256)
+	client := serveJWKS(t, rs256, ps256, es256)
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		key       signingKey
+		wantValid bool
+	}{
+		{name: "default/RS256", key: rs256, wantValid: true},
+		{name: "default/PS256", key: ps256, wantValid: true},
+		// ES256 no está permitido por defecto: hay que habilitarlo explícitamente.
+		{name: "default/ES256", key: es256},
+		{name: "opt-in/ES256", opts: []Option{WithAllowedAlgorithms("RS256", "PS256", "ES256")}, key: es256, wantValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(context.Background(), testTenantID, append([]Option{
+				WithAudiences(testAudience),
+				WithHTTPClient(client),
+				WithNoOpLogger(),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			_, err = v.Validate(context.Background(), tt.key.sign(t))
+			if tt.wantValid && err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !tt.wantValid && !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+				t.Fatalf("got %v, want jwt.ErrTokenSignatureInvalid", err)
+			}
+		})
+	}
+}
+
+func TestWithRequireKID(t *testing.T) {
+	key := newSigningKey(t, "key-a", jwt.SigningMethodRS256)
+	client := serveJWKS(t, key)
+
+	// El mismo par de claves, firmando sin `kid` en la cabecera.
+	withoutKID := key
+	withoutKID.kid = ""
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		token   string
+		wantErr error
+	}{
+		{name: "with kid", opts: []Option{WithRequireKID()}, token: key.sign(t)},
+		{name: "without kid", opts: []Option{WithRequireKID()}, token: withoutKID.sign(t), wantErr: ErrMissingKID},
+		// Sin la opción, el token llega a la búsqueda de clave del JWKS.
+		{name: "without kid, not required", token: withoutKID.sign(t), wantErr: jwt.ErrTokenUnverifiable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(context.Background(), testTenantID, append([]Option{
+				WithAudiences(testAudience),
+				WithHTTPClient(client),
+				WithNoOpLogger(),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			_, err = v.Validate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != ErrMissingKID && errors.Is(err, ErrMissingKID) {
+				t.Fatalf("got %v, want no ErrMissingKID", err)
+			}
+		})
+	}
+}
+
+func TestWithStaticJWKS(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	resp, err := keySet.HTTPClient().Get(keySet.URL())
+	if err != nil {
+		t.Fatalf("GET JWKS: %v", err)
+	}
+	jwksJSON, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read JWKS: %v", err)
+	}
+
+	// Sin red: cualquier descarga fallaría.
+	var requests atomic.Int32
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithStaticJWKS(jwksJSON),
+		WithHTTPClient(countingClient(unreachableClient(), &requests)),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := requests.Load(); got != 0 {
+		t.Fatalf("%d HTTP requests with a static JWKS, want 0", got)
+	}
+
+	other := jwtazuretest.NewKeySet()
+	t.Cleanup(other.Close)
+	if _, err := v.Validate(context.Background(), testToken(other)); err == nil {
+		t.Fatal("token signed by a key outside the static JWKS: expected an error")
+	}
+
+	if _, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithStaticJWKS([]byte("not json")),
+		WithNoOpLogger(),
+	); err == nil {
+		t.Fatal("NewValidator with an invalid static JWKS: expected an error")
+	}
+}
+
+func TestWithJWKSURLs(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	const (
+		v1URL  = "https://sts.partner.example/tenant/discovery/keys"
+		v2URL  = "https://sts.partner.example/tenant/discovery/v2.0/keys"
+		issuer = "https://sts.partner.example/tenant/v2.0"
+	)
+
+	tests := []struct {
+		name   string
+		v1, v2 string
+		want   []string
+	}{
+		{name: "both endpoints", v1: v1URL, v2: v2URL, want: []string{v1URL, v2URL}},
+		{name: "only v2", v2: v2URL, want: []string{v2URL}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests requestLog
+			v, err := NewValidator(context.Background(), testTenantID,
+				WithAudiences(testAudience),
+				WithJWKSURLs(tt.v1, tt.v2),
+				WithIssuers(issuer),
+				WithHTTPClient(requests.client(keySet.HTTPClient())),
+				WithNoOpLogger(),
+			)
+			if err != nil {
+				t.Fatalf("NewValidator: %v", err)
+			}
+			t.Cleanup(func() { _ = v.Close() })
+
+			if got := requests.sorted(); !slices.Equal(got, tt.want) {
+				t.Fatalf("requested %v, want %v", got, tt.want)
+			}
+			if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("iss", issuer))); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+		})
+	}
+}
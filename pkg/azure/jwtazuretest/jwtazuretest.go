@@ -0,0 +1,135 @@
+// Package jwtazuretest ofrece utilidades para probar de extremo a extremo código que usa
+// el paquete azure: un servidor JWKS en memoria y la firma de tokens con la clave asociada.
+//
+//	keySet := jwtazuretest.NewKeySet()
+//	defer keySet.Close()
+//
+//	validator, _ := azure.NewValidator(ctx, tenantID,
+//		azure.WithAudiences("api://my-api"),
+//		azure.WithHTTPClient(keySet.HTTPClient()),
+//	)
+//	token := keySet.Sign(jwtazuretest.Claims(tenantID, "api://my-api"))
+package jwtazuretest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// KeyID es el `kid` de la clave publicada en el JWKS y usado en la cabecera de los tokens.
+	KeyID = "jwtazuretest-key"
+	// rsaKeyBits es el tamaño de la clave RSA generada.
+	rsaKeyBits = 2048
+)
+
+// KeySet es un JWKS de pruebas: publica una clave RSA pública en un httptest.Server y firma
+// tokens RS256 con la clave privada correspondiente.
+type KeySet struct {
+	Server     *httptest.Server
+	privateKey *rsa.PrivateKey
+}
+
+// NewKeySet genera una clave RSA e inicia un servidor que la publica como JWKS en cualquier ruta.
+// Entra en pánico si no se puede generar la clave, al tratarse de una utilidad de pruebas.
+func NewKeySet() *KeySet {
+	privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		panic(fmt.Sprintf("jwtazuretest: fallo al generar la clave RSA: %v", err))
+	}
+
+	k := &KeySet{privateKey: privateKey}
+	k.Server = httptest.NewServer(http.HandlerFunc(k.serveJWKS))
+	return k
+}
+
+// URL devuelve la URL del JWKS publicado.
+func (k *KeySet) URL() string {
+	return k.Server.URL + "/discovery/v2.0/keys"
+}
+
+// HTTPClient devuelve un cliente que redirige cualquier petición al servidor de pruebas,
+// conservando la ruta. Permite usar azure.WithHTTPClient sin cambiar las URLs de Azure.
+func (k *KeySet) HTTPClient() *http.Client {
+	target, _ := url.Parse(k.Server.URL)
+	return &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			r = r.Clone(r.Context())
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			r.Host = target.Host
+			return k.Server.Client().Transport.RoundTrip(r)
+		}),
+	}
+}
+
+// Sign firma los claims con RS256 y la clave del KeySet, incluyendo el `kid` en la cabecera.
+// Entra en pánico si la firma falla, al tratarse de una utilidad de pruebas.
+func (k *KeySet) Sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+
+	signed, err := token.SignedString(k.privateKey)
+	if err != nil {
+		panic(fmt.Sprintf("jwtazuretest: fallo al firmar el token: %v", err))
+	}
+	return signed
+}
+
+// Close detiene el servidor JWKS.
+func (k *KeySet) Close() {
+	k.Server.Close()
+}
+
+// Claims devuelve claims válidos de un token de acceso v2.0 de Azure AD para el inquilino y la
+// audiencia indicados, con una validez de una hora. Se pueden modificar antes de firmarlos.
+func Claims(tenantID, audience string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", tenantID),
+		"aud": audience,
+		"sub": "jwtazuretest-subject",
+		"oid": "00000000-0000-0000-0000-000000000001",
+		"tid": tenantID,
+		"ver": "2.0",
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+// serveJWKS responde con el JWKS que contiene la clave pública del KeySet.
+func (k *KeySet) serveJWKS(w http.ResponseWriter, _ *http.Request) {
+	publicKey := k.privateKey.PublicKey
+	jwks := map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": jwt.SigningMethodRS256.Alg(),
+			"kid": KeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(jwks)
+}
+
+// roundTripperFunc adapta una función a http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implementa http.RoundTripper.
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
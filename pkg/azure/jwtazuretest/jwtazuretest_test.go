@@ -0,0 +1,96 @@
+package jwtazuretest
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fetchKeyfunc descarga el JWKS del KeySet a través de su cliente, desde una URL de Azure.
+func fetchKeyfunc(t *testing.T, k *KeySet) keyfunc.Keyfunc {
+	t.Helper()
+
+	resp, err := k.HTTPClient().Get("https://login.microsoftonline.com/tenant/discovery/v2.0/keys")
+	if err != nil {
+		t.Fatalf("GET JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read JWKS: %v", err)
+	}
+
+	jwks, err := keyfunc.NewJWKSetJSON(body)
+	if err != nil {
+		t.Fatalf("keyfunc.NewJWKSetJSON(%s): %v", body, err)
+	}
+	return jwks
+}
+
+func TestKeySetSignVerifiesAgainstJWKS(t *testing.T) {
+	keySet := NewKeySet()
+	defer keySet.Close()
+
+	jwks := fetchKeyfunc(t, keySet)
+	keys, err := jwks.Storage().KeyReadAll(context.Background())
+	if err != nil || len(keys) != 1 || keys[0].Marshal().KID != KeyID {
+		t.Fatalf("JWKS keys = %v, %v; want a single key with kid %q", keys, err, KeyID)
+	}
+
+	token, err := jwt.Parse(keySet.Sign(Claims("tenant", "api://test")), jwks.Keyfunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		t.Fatalf("parse signed token: %v", err)
+	}
+	if kid := token.Header["kid"]; kid != KeyID {
+		t.Fatalf("kid = %v, want %q", kid, KeyID)
+	}
+}
+
+func TestKeySetsUseDistinctKeys(t *testing.T) {
+	keySet, other := NewKeySet(), NewKeySet()
+	defer keySet.Close()
+	defer other.Close()
+
+	jwks := fetchKeyfunc(t, keySet)
+	if _, err := jwt.Parse(other.Sign(Claims("tenant", "api://test")), jwks.Keyfunc); err == nil {
+		t.Fatal("a token signed by another KeySet verified")
+	}
+}
+
+func TestURL(t *testing.T) {
+	keySet := NewKeySet()
+	defer keySet.Close()
+
+	resp, err := keySet.Server.Client().Get(keySet.URL())
+	if err != nil {
+		t.Fatalf("GET %s: %v", keySet.URL(), err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+}
+
+func TestClaims(t *testing.T) {
+	const tenantID, audience = "72f988bf-86f1-41af-91ab-2d7cd011db47", "api://test"
+	claims := Claims(tenantID, audience)
+
+	if iss, _ := claims.GetIssuer(); iss != "https://login.microsoftonline.com/"+tenantID+"/v2.0" {
+		t.Errorf("iss = %q, want the v2.0 issuer of the tenant", iss)
+	}
+	if aud, _ := claims.GetAudience(); len(aud) != 1 || aud[0] != audience {
+		t.Errorf("aud = %v, want [%s]", aud, audience)
+	}
+	if claims["tid"] != tenantID || claims["ver"] != "2.0" {
+		t.Errorf("tid = %v, ver = %v; want %s, 2.0", claims["tid"], claims["ver"], tenantID)
+	}
+	iat, exp := claims["iat"].(int64), claims["exp"].(int64)
+	if now := time.Now().Unix(); iat > now || exp-iat != int64(time.Hour.Seconds()) {
+		t.Errorf("iat = %d, exp = %d; want an hour of validity from now", iat, exp)
+	}
+}
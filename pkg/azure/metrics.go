@@ -0,0 +1,74 @@
+package azure
+
+import "time"
+
+// =============================================================================
+// Métricas
+// =============================================================================
+
+// Resultados de validación reportados a MetricsRecorder.
+const (
+	ResultSuccess        = "success"
+	ResultExpired        = "expired"
+	ResultBadIssuer      = "bad_issuer"
+	ResultBadAudience    = "bad_audience"
+	ResultParseError     = "parse_error"
+	ResultKeyUnavailable = "key_unavailable"
+	ResultRevoked        = "revoked"
+	ResultInvalid        = "invalid"
+)
+
+// MetricsRecorder recibe el resultado y la duración de cada validación de token.
+// Aísla al paquete de cualquier sistema de métricas concreto; el subpaquete azureprom
+// ofrece una implementación para Prometheus.
+type MetricsRecorder interface {
+	ObserveValidation(result string, duration time.Duration)
+}
+
+// NamedMetricsRecorder es un MetricsRecorder que además recibe el nombre del validador
+// (ver WithName), para distinguir las métricas de varios validadores en un mismo proceso.
+type NamedMetricsRecorder interface {
+	MetricsRecorder
+	ObserveNamedValidation(validator, result string, duration time.Duration)
+}
+
+// WithMetrics registra el resultado y la latencia de cada validación en el recorder indicado.
+func WithMetrics(recorder MetricsRecorder) Option {
+	return func(v *Validator) {
+		v.metrics = recorder
+	}
+}
+
+// observeValidation informa una validación al recorder, con el nombre del validador si el
+// recorder lo admite y se configuró con WithName.
+func (v *Validator) observeValidation(result string, duration time.Duration) {
+	if named, ok := v.metrics.(NamedMetricsRecorder); ok && v.name != "" {
+		named.ObserveNamedValidation(v.name, result, duration)
+		return
+	}
+	v.metrics.ObserveValidation(result, duration)
+}
+
+// validationResult clasifica un error de validación en uno de los resultados de las métricas.
+func validationResult(err error) string {
+	if err == nil {
+		return ResultSuccess
+	}
+
+	switch publicError(err) {
+	case ErrTokenExpired:
+		return ResultExpired
+	case ErrInvalidIssuer:
+		return ResultBadIssuer
+	case ErrInvalidAudience:
+		return ResultBadAudience
+	case ErrTokenParsingFailed:
+		return ResultParseError
+	case ErrKeySourceUnavailable:
+		return ResultKeyUnavailable
+	case ErrTokenRevoked:
+		return ResultRevoked
+	}
+
+	return ResultInvalid
+}
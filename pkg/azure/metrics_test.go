@@ -0,0 +1,80 @@
+package azure
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// recordedValidations es un MetricsRecorder que guarda los resultados observados.
+type recordedValidations struct {
+	mu      sync.Mutex
+	results []string
+	names   []string
+}
+
+func (r *recordedValidations) ObserveValidation(result string, _ time.Duration) {
+	r.ObserveNamedValidation("", result, 0)
+}
+
+func (r *recordedValidations) ObserveNamedValidation(validator, result string, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+	r.names = append(r.names, validator)
+}
+
+// last devuelve el último resultado observado y el número total de observaciones.
+func (r *recordedValidations) last() (string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.results) == 0 {
+		return "", 0
+	}
+	return r.results[len(r.results)-1], len(r.results)
+}
+
+func TestWithMetrics(t *testing.T) {
+	recorder := &recordedValidations{}
+	v, keySet := newTestValidator(t, WithMetrics(recorder))
+	other := jwtazuretest.NewKeySet()
+	t.Cleanup(other.Close)
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "success", token: testToken(keySet), want: ResultSuccess},
+		{name: "expired", token: testToken(keySet, expiredClaims), want: ResultExpired},
+		{name: "bad issuer", token: testToken(keySet, withClaim("iss", "https://issuer.example.test/")), want: ResultBadIssuer},
+		{name: "bad audience", token: testToken(keySet, withClaim("aud", "api://other")), want: ResultBadAudience},
+		{name: "parse error", token: "not-a-jwt", want: ResultParseError},
+		{name: "bad signature", token: testToken(other), want: ResultParseError},
+		{name: "not yet valid", token: testToken(keySet, withClaim("nbf", time.Now().Add(time.Hour).Unix())), want: ResultInvalid},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _ = v.Validate(context.Background(), tt.token)
+			if got, n := recorder.last(); got != tt.want || n != i+1 {
+				t.Fatalf("observation #%d = %q, want #%d = %q", n, got, i+1, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithMetricsName(t *testing.T) {
+	recorder := &recordedValidations{}
+	v, keySet := newTestValidator(t, WithMetrics(recorder), WithName("orders-api"))
+
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if len(recorder.names) != 1 || recorder.names[0] != "orders-api" {
+		t.Fatalf("validator names = %q, want [orders-api]", recorder.names)
+	}
+}
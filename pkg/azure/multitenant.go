@@ -0,0 +1,215 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/httpgate/pkg/kit/problem"
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// Validación Multi-Inquilino
+// =============================================================================
+
+// MultiTenantValidator valida tokens de varios inquilinos de Azure AD, cada uno con sus propios
+// JWKS y emisores. Solo se aceptan inquilinos registrados con AddTenant; el Validator de cada
+// inquilino se crea de forma perezosa con el primer token recibido y queda cacheado.
+type MultiTenantValidator struct {
+	ctx        context.Context
+	opts       []Option
+	config     *Validator
+	mu         sync.RWMutex
+	allowed    map[string]struct{}
+	validators map[string]*tenantValidator
+}
+
+// tenantValidator es el Validator de un inquilino, que se construye una sola vez fuera del mutex
+// del MultiTenantValidator: la descarga de sus JWKS no bloquea a los demás inquilinos. ready se
+// cierra cuando v o err están disponibles.
+type tenantValidator struct {
+	ready chan struct{}
+	v     *Validator
+	err   error
+}
+
+// NewMultiTenantValidator crea un validador multi-inquilino que acepta los inquilinos indicados.
+// Las opciones se aplican a cada Validator por inquilino, y ctx controla el ciclo de vida de sus
+// gorutinas de refresco.
+func NewMultiTenantValidator(ctx context.Context, tenantIDs []string, opts ...Option) (*MultiTenantValidator, error) {
+	m := &MultiTenantValidator{
+		ctx:        ctx,
+		opts:       opts,
+		config:     applyOptions(opts),
+		allowed:    make(map[string]struct{}),
+		validators: make(map[string]*tenantValidator),
+	}
+
+	// Si no se proporciona un logger, usar el de producción compartido por defecto, el mismo
+	// que recibirán los validadores de cada inquilino.
+	if m.config.logger == nil {
+		m.config.logger = defaultLogger()
+	}
+	if m.config.auditLogger == nil {
+		m.config.auditLogger = m.config.logger
+	}
+
+	for _, tenantID := range tenantIDs {
+		if err := m.AddTenant(tenantID); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// AddTenant añade un inquilino a la lista de inquilinos permitidos, normalizado igual que en
+// NewValidator (minúsculas, sin espacios ni llaves). Su Validator se crea con el primer token
+// recibido de ese inquilino. Devuelve un error si el ID de inquilino no es válido.
+func (m *MultiTenantValidator) AddTenant(tenantID string) error {
+	tenantID, err := normalizeTenantID(tenantID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allowed[tenantID] = struct{}{}
+	return nil
+}
+
+// Validate identifica el inquilino a partir del claim `tid` y valida el token con los JWKS
+// y emisores de ese inquilino. Devuelve ErrTenantNotAllowed si el inquilino no está registrado.
+func (m *MultiTenantValidator) Validate(ctx context.Context, tokenString string) (*UserClaims, error) {
+	v, err := m.validatorFor(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return v.Validate(ctx, tokenString)
+}
+
+// Middleware devuelve un manejador de middleware HTTP que valida el token de portador con el
+// Validator del inquilino que lo emitió.
+func (m *MultiTenantValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, err := m.config.extractToken(r)
+		if err != nil {
+			m.config.auditDenial(r, http.StatusUnauthorized, err, nil)
+			m.config.setChallenge(w, extractionErrorCode(err), nil, nil)
+			problem.RespondError(w,
+				problem.FromError(
+					err,
+					http.StatusUnauthorized,
+					problem.WithInstance(r),
+					problem.WithType(m.config.problemType(err)),
+				),
+			)
+			return
+		}
+
+		v, err := m.validatorFor(r.Context(), tokenString)
+		if err != nil {
+			m.config.logger.Warn("Token tenant resolution failed", zap.Error(err), zap.String("remote_addr", r.RemoteAddr))
+			m.config.auditDenial(r, http.StatusUnauthorized, err, nil)
+			m.config.setChallenge(w, bearerErrorInvalidToken, ErrTokenInvalid, nil)
+			problem.RespondError(w,
+				problem.FromError(
+					ErrTokenInvalid,
+					http.StatusUnauthorized,
+					problem.WithInstance(r),
+					problem.WithType(m.config.problemType(ErrTokenInvalid)),
+				),
+			)
+			return
+		}
+
+		v.Middleware(next).ServeHTTP(w, r)
+	})
+}
+
+// Close detiene las gorutinas de refresco de todos los validadores creados, esperando a que
+// terminen de construirse los que estén en curso.
+func (m *MultiTenantValidator) Close() error {
+	m.mu.RLock()
+	entries := slices.Collect(maps.Values(m.validators))
+	m.mu.RUnlock()
+
+	var errs []error
+	for _, entry := range entries {
+		<-entry.ready
+		if entry.v != nil {
+			errs = append(errs, entry.v.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validatorFor devuelve el Validator del inquilino del token, creándolo si es necesario.
+// El `tid` se lee sin verificar la firma solo para seleccionar el inquilino; la verificación
+// completa la realiza el Validator de ese inquilino. Mientras otra llamada construye el Validator
+// del mismo inquilino, espera a que termine o a que expire ctx.
+func (m *MultiTenantValidator) validatorFor(ctx context.Context, tokenString string) (*Validator, error) {
+	var mapClaims jwt.MapClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &mapClaims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenParsingFailed, err)
+	}
+	tenantID, _ := mapClaims["tid"].(string)
+
+	m.mu.RLock()
+	_, allowed := m.allowed[tenantID]
+	entry, ok := m.validators[tenantID]
+	var allowedTenants []string
+	if !allowed {
+		allowedTenants = slices.Sorted(maps.Keys(m.allowed))
+	}
+	m.mu.RUnlock()
+
+	if !allowed {
+		return nil, newValidationError(ErrTenantNotAllowed, "tid", allowedTenants, tenantID)
+	}
+	if !ok {
+		entry = m.buildValidator(tenantID)
+	}
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.v, nil
+}
+
+// buildValidator devuelve la entrada del inquilino y, si no existía, construye su Validator sin
+// retener el mutex. Si la construcción falla, la entrada se descarta para que la siguiente
+// petición lo reintente.
+func (m *MultiTenantValidator) buildValidator(tenantID string) *tenantValidator {
+	m.mu.Lock()
+	// Otra gorutina pudo registrarlo mientras se esperaba el bloqueo.
+	if entry, ok := m.validators[tenantID]; ok {
+		m.mu.Unlock()
+		return entry
+	}
+	entry := &tenantValidator{ready: make(chan struct{})}
+	m.validators[tenantID] = entry
+	m.mu.Unlock()
+
+	defer close(entry.ready)
+	entry.v, entry.err = NewValidator(m.ctx, tenantID, m.opts...)
+	if entry.err != nil {
+		entry.err = fmt.Errorf("fallo al crear el validador para el inquilino %s: %w", tenantID, entry.err)
+
+		m.mu.Lock()
+		delete(m.validators, tenantID)
+		m.mu.Unlock()
+	}
+	return entry
+}
@@ -0,0 +1,232 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// newTestMultiTenantValidator crea un MultiTenantValidator que obtiene las claves del mismo
+// KeySet que newTestValidator, sin inquilinos permitidos.
+func newTestMultiTenantValidator(t *testing.T) (*MultiTenantValidator, *jwtazuretest.KeySet) {
+	t.Helper()
+
+	_, keySet := newTestValidator(t)
+	m, err := NewMultiTenantValidator(context.Background(), nil,
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewMultiTenantValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close() })
+
+	return m, keySet
+}
+
+func TestMultiTenantAddTenantNormalizes(t *testing.T) {
+	m, keySet := newTestMultiTenantValidator(t)
+	token := testToken(keySet)
+
+	if _, err := m.Validate(context.Background(), token); !errors.Is(err, ErrTenantNotAllowed) {
+		t.Fatalf("before AddTenant: got %v, want ErrTenantNotAllowed", err)
+	}
+
+	if err := m.AddTenant(" {" + strings.ToUpper(testTenantID) + "} "); err != nil {
+		t.Fatalf("AddTenant: %v", err)
+	}
+	if _, err := m.Validate(context.Background(), token); err != nil {
+		t.Fatalf("after AddTenant: %v", err)
+	}
+
+	if err := m.AddTenant("not a tenant"); err == nil {
+		t.Fatal("AddTenant with an invalid tenant: expected an error")
+	}
+}
+
+// tenantTransport cuenta las peticiones por inquilino y retiene las de blocked hasta que se
+// cierre release.
+type tenantTransport struct {
+	next     http.RoundTripper
+	blocked  string
+	release  chan struct{}
+	requests sync.Map // inquilino -> *atomic.Int32
+}
+
+func (tt *tenantTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	tenantID, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	counter, _ := tt.requests.LoadOrStore(tenantID, new(atomic.Int32))
+	counter.(*atomic.Int32).Add(1)
+
+	if tenantID == tt.blocked {
+		select {
+		case <-tt.release:
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+	return tt.next.RoundTrip(r)
+}
+
+func (tt *tenantTransport) count(tenantID string) int32 {
+	counter, ok := tt.requests.Load(tenantID)
+	if !ok {
+		return 0
+	}
+	return counter.(*atomic.Int32).Load()
+}
+
+func TestMultiTenantSlowTenantDoesNotBlockOthers(t *testing.T) {
+	const slowTenantID = "11111111-2222-3333-4444-555555555555"
+
+	_, keySet := newTestValidator(t)
+	transport := &tenantTransport{
+		next:    keySet.HTTPClient().Transport,
+		blocked: slowTenantID,
+		release: make(chan struct{}),
+	}
+	m, err := NewMultiTenantValidator(context.Background(), []string{testTenantID, slowTenantID},
+		WithAudiences(testAudience),
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewMultiTenantValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close() })
+
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := m.Validate(context.Background(), keySet.Sign(jwtazuretest.Claims(slowTenantID, testAudience)))
+		slowDone <- err
+	}()
+	for transport.count(slowTenantID) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := m.Validate(ctx, testToken(keySet)); err != nil {
+		t.Fatalf("fast tenant while another tenant is loading: %v", err)
+	}
+
+	// Un segundo token del inquilino lento espera a la construcción en curso y respeta su ctx.
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer waitCancel()
+	_, err = m.Validate(waitCtx, keySet.Sign(jwtazuretest.Claims(slowTenantID, testAudience)))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waiting on slow tenant: got %v, want context.DeadlineExceeded", err)
+	}
+
+	close(transport.release)
+	if err := <-slowDone; err != nil {
+		t.Fatalf("slow tenant: %v", err)
+	}
+}
+
+func TestMultiTenantBuildsValidatorOnce(t *testing.T) {
+	_, keySet := newTestValidator(t)
+	transport := &tenantTransport{next: keySet.HTTPClient().Transport}
+	m, err := NewMultiTenantValidator(context.Background(), []string{testTenantID},
+		WithAudiences(testAudience),
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewMultiTenantValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close() })
+
+	// Referencia: peticiones que hace un único Validator al construirse.
+	if _, err := m.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	want := transport.count(testTenantID)
+
+	m2, err := NewMultiTenantValidator(context.Background(), []string{testTenantID},
+		WithAudiences(testAudience),
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewMultiTenantValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = m2.Close() })
+
+	token := testToken(keySet)
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m2.Validate(context.Background(), token); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := transport.count(testTenantID) - want; got != want {
+		t.Fatalf("concurrent first use made %d key requests, want %d", got, want)
+	}
+}
+
+func TestMultiTenantPerTenantJWKS(t *testing.T) {
+	keySets := map[string]*jwtazuretest.KeySet{
+		testTenantID:  jwtazuretest.NewKeySet(),
+		otherTenantID: jwtazuretest.NewKeySet(),
+	}
+	for _, keySet := range keySets {
+		t.Cleanup(keySet.Close)
+	}
+
+	// Cada inquilino descarga las claves de su propio servidor.
+	client := &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			tenantID, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+			keySet, ok := keySets[tenantID]
+			if !ok {
+				return nil, errors.New("unexpected tenant " + tenantID)
+			}
+			return keySet.HTTPClient().Transport.RoundTrip(r)
+		}),
+	}
+	m, err := NewMultiTenantValidator(context.Background(), []string{testTenantID, otherTenantID},
+		WithAudiences(testAudience),
+		WithHTTPClient(client),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewMultiTenantValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close() })
+
+	for tenantID, keySet := range keySets {
+		claims, err := m.Validate(context.Background(), keySet.Sign(jwtazuretest.Claims(tenantID, testAudience)))
+		if err != nil {
+			t.Fatalf("token from tenant %s: %v", tenantID, err)
+		}
+		if claims.TenantID != tenantID {
+			t.Fatalf("TenantID = %q, want %q", claims.TenantID, tenantID)
+		}
+	}
+
+	// Un token de un inquilino firmado con las claves de otro no se acepta.
+	forged := keySets[testTenantID].Sign(jwtazuretest.Claims(otherTenantID, testAudience))
+	if _, err := m.Validate(context.Background(), forged); !errors.Is(err, ErrTokenParsingFailed) {
+		t.Fatalf("token signed with another tenant's keys: got %v, want ErrTokenParsingFailed", err)
+	}
+
+	unknown := keySets[testTenantID].Sign(jwtazuretest.Claims("0b6a4b8e-5c4d-4f7a-9d1e-2a3b4c5d6e7f", testAudience))
+	if _, err := m.Validate(context.Background(), unknown); !errors.Is(err, ErrTenantNotAllowed) {
+		t.Fatalf("token from a tenant outside the allowlist: got %v, want ErrTenantNotAllowed", err)
+	}
+}
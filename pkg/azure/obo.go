@@ -0,0 +1,81 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// =============================================================================
+// Flujo On-Behalf-Of
+// =============================================================================
+
+// oboGrantType es el grant_type de OAuth 2.0 usado por Azure para el flujo on-behalf-of.
+const oboGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// maxTokenResponseBytes limita el tamaño de la respuesta leída del endpoint de tokens.
+const maxTokenResponseBytes = 1 << 20
+
+// tokenResponse es la parte de la respuesta del endpoint de tokens de Azure que se utiliza.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// OnBehalfOf intercambia el token de la petición (guardado en el contexto por Middleware) por
+// un token de acceso para otra API, mediante el flujo on-behalf-of de Azure AD. clientID y
+// clientSecret identifican a esta aplicación y scope al recurso de destino
+// (p. ej. "https://graph.microsoft.com/.default").
+func (v *Validator) OnBehalfOf(ctx context.Context, clientID, clientSecret, scope string) (string, error) {
+	tokenURL := v.tokenEndpoint()
+	if tokenURL == "" {
+		return "", ErrOnBehalfOfUnsupported
+	}
+
+	assertion, ok := GetTokenFromContext(ctx)
+	if !ok {
+		return "", ErrTokenNotInContext
+	}
+
+	form := url.Values{
+		"grant_type":          {oboGrantType},
+		"client_id":           {clientID},
+		"client_secret":       {clientSecret},
+		"assertion":           {assertion},
+		"scope":               {scope},
+		"requested_token_use": {"on_behalf_of"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrOnBehalfOfFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := v.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrOnBehalfOfFailed, err)
+	}
+	defer resp.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: respuesta no válida (status %d): %w", ErrOnBehalfOfFailed, resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("%w: status %d: %s: %s", ErrOnBehalfOfFailed, resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	return body.AccessToken, nil
+}
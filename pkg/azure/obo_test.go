@@ -0,0 +1,104 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// newTokenEndpoint inicia un servidor que publica el JWKS de keySet y simula el endpoint de
+// tokens del inquilino de pruebas: acepta la aserción assertion y devuelve un token fijo.
+func newTokenEndpoint(t *testing.T, keySet *jwtazuretest.KeySet, assertion string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", keySet.Server.Config.Handler)
+	mux.HandleFunc("POST /"+testTenantID+"/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := r.ParseForm(); err != nil ||
+			r.PostForm.Get("grant_type") != oboGrantType ||
+			r.PostForm.Get("requested_token_use") != "on_behalf_of" ||
+			r.PostForm.Get("client_id") != "client-id" ||
+			r.PostForm.Get("client_secret") != "client-secret" ||
+			r.PostForm.Get("scope") != "https://graph.microsoft.com/.default" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_request", ErrorDescription: "unexpected form"})
+			return
+		}
+		if r.PostForm.Get("assertion") != assertion {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant", ErrorDescription: "AADSTS50013: assertion failed"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: "downstream-token"})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOnBehalfOf(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+	token := testToken(keySet)
+	server := newTokenEndpoint(t, keySet, token)
+
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(redirectClient(server.URL)),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	// El token de la petición llega al flujo a través del contexto de Middleware.
+	var got string
+	var oboErr error
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, oboErr = v.OnBehalfOf(r.Context(), "client-id", "client-secret", "https://graph.microsoft.com/.default")
+	}))
+	serve(handler, token)
+	if oboErr != nil || got != "downstream-token" {
+		t.Fatalf("OnBehalfOf = %q, %v; want the downstream token", got, oboErr)
+	}
+
+	ctx := context.WithValue(context.Background(), rawTokenKey{}, testToken(keySet, withClaim("sub", "other")))
+	_, err = v.OnBehalfOf(ctx, "client-id", "client-secret", "https://graph.microsoft.com/.default")
+	if !errors.Is(err, ErrOnBehalfOfFailed) || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("rejected assertion: got %v, want ErrOnBehalfOfFailed with invalid_grant", err)
+	}
+
+	if _, err := v.OnBehalfOf(context.Background(), "client-id", "client-secret", "scope"); !errors.Is(err, ErrTokenNotInContext) {
+		t.Fatalf("no token in context: got %v, want ErrTokenNotInContext", err)
+	}
+}
+
+func TestOnBehalfOfUnsupported(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	// Los validadores de B2C no tienen endpoint de tokens para el flujo on-behalf-of.
+	v, err := NewB2CValidator(context.Background(), "contoso", "B2C_1_signin",
+		WithAudiences(testAudience),
+		WithHTTPClient(keySet.HTTPClient()),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewB2CValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	ctx := context.WithValue(context.Background(), rawTokenKey{}, testToken(keySet))
+	if _, err := v.OnBehalfOf(ctx, "client-id", "client-secret", "scope"); !errors.Is(err, ErrOnBehalfOfUnsupported) {
+		t.Fatalf("got %v, want ErrOnBehalfOfUnsupported", err)
+	}
+}
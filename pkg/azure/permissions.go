@@ -0,0 +1,51 @@
+package azure
+
+import "errors"
+
+// =============================================================================
+// Política de Permisos (scp / roles)
+// =============================================================================
+
+// ErrAmbiguousPermissions indica que el token incluye `scp` y `roles` con PermissionPolicyExclusive.
+var ErrAmbiguousPermissions = errors.New("token carries both scp and roles")
+
+// PermissionPolicy decide qué permisos se conservan cuando un token incluye a la vez `scp`
+// (permisos delegados) y `roles` (permisos de aplicación), como ocurre en escenarios híbridos.
+type PermissionPolicy int
+
+const (
+	// PermissionPolicyBoth conserva ambos claims (comportamiento por defecto).
+	PermissionPolicyBoth PermissionPolicy = iota
+	// PermissionPolicyPreferScopes descarta los roles cuando el token incluye `scp`.
+	PermissionPolicyPreferScopes
+	// PermissionPolicyPreferRoles descarta los scopes cuando el token incluye `roles`.
+	PermissionPolicyPreferRoles
+	// PermissionPolicyExclusive rechaza los tokens que incluyen ambos claims con ErrAmbiguousPermissions.
+	PermissionPolicyExclusive
+)
+
+// WithPermissionPolicy establece qué hacer con los tokens que incluyen `scp` y `roles` a la vez.
+// La política se aplica sobre los UserClaims construidos, por lo que afecta a RequireScopes,
+// RequireAllRoles, RequireAnyRole y Protect.
+func WithPermissionPolicy(policy PermissionPolicy) Option {
+	return func(v *Validator) {
+		v.permissionPolicy = policy
+	}
+}
+
+// applyPermissionPolicy aplica la política de permisos a los claims construidos.
+func (v *Validator) applyPermissionPolicy(claims *UserClaims) error {
+	if claims.Scopes == "" || len(claims.Roles) == 0 {
+		return nil
+	}
+
+	switch v.permissionPolicy {
+	case PermissionPolicyPreferScopes:
+		claims.Roles = nil
+	case PermissionPolicyPreferRoles:
+		claims.Scopes = ""
+	case PermissionPolicyExclusive:
+		return newValidationError(ErrAmbiguousPermissions, "roles", "absent when scp is present", claims.Roles)
+	}
+	return nil
+}
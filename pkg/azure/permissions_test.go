@@ -0,0 +1,58 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestWithPermissionPolicy(t *testing.T) {
+	scopesOnly := []func(jwt.MapClaims){withClaim("scp", "orders.read")}
+	rolesOnly := []func(jwt.MapClaims){withClaim("roles", []string{"reader"})}
+	both := append(slices.Clone(scopesOnly), rolesOnly...)
+
+	tests := []struct {
+		name       string
+		policy     PermissionPolicy
+		mutate     []func(jwt.MapClaims)
+		wantScopes string
+		wantRoles  []string
+		wantErr    error
+	}{
+		{name: "both/scp only", policy: PermissionPolicyBoth, mutate: scopesOnly, wantScopes: "orders.read"},
+		{name: "both/roles only", policy: PermissionPolicyBoth, mutate: rolesOnly, wantRoles: []string{"reader"}},
+		{name: "both/both present", policy: PermissionPolicyBoth, mutate: both, wantScopes: "orders.read", wantRoles: []string{"reader"}},
+
+		{name: "prefer scopes/scp only", policy: PermissionPolicyPreferScopes, mutate: scopesOnly, wantScopes: "orders.read"},
+		{name: "prefer scopes/roles only", policy: PermissionPolicyPreferScopes, mutate: rolesOnly, wantRoles: []string{"reader"}},
+		{name: "prefer scopes/both present", policy: PermissionPolicyPreferScopes, mutate: both, wantScopes: "orders.read"},
+
+		{name: "prefer roles/scp only", policy: PermissionPolicyPreferRoles, mutate: scopesOnly, wantScopes: "orders.read"},
+		{name: "prefer roles/roles only", policy: PermissionPolicyPreferRoles, mutate: rolesOnly, wantRoles: []string{"reader"}},
+		{name: "prefer roles/both present", policy: PermissionPolicyPreferRoles, mutate: both, wantRoles: []string{"reader"}},
+
+		{name: "exclusive/scp only", policy: PermissionPolicyExclusive, mutate: scopesOnly, wantScopes: "orders.read"},
+		{name: "exclusive/roles only", policy: PermissionPolicyExclusive, mutate: rolesOnly, wantRoles: []string{"reader"}},
+		{name: "exclusive/both present", policy: PermissionPolicyExclusive, mutate: both, wantErr: ErrAmbiguousPermissions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, WithPermissionPolicy(tt.policy))
+
+			claims, err := v.Validate(context.Background(), testToken(keySet, tt.mutate...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if claims.Scopes != tt.wantScopes || !slices.Equal(claims.Roles, tt.wantRoles) {
+				t.Fatalf("Scopes = %q, Roles = %v; want %q, %v", claims.Scopes, claims.Roles, tt.wantScopes, tt.wantRoles)
+			}
+		})
+	}
+}
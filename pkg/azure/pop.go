@@ -0,0 +1,96 @@
+package azure
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// =============================================================================
+// Tokens Vinculados a Certificado (Proof-of-Possession)
+// =============================================================================
+
+// ErrCertificateBindingMismatch indica que el token está vinculado a un certificado de cliente
+// (claim `cnf` con `x5t#S256`) distinto del presentado en la conexión mTLS, o que el token no
+// está vinculado cuando se exige.
+var ErrCertificateBindingMismatch = errors.New("token is not bound to the presented client certificate")
+
+// WithCertificateThumbprintBinding exige en Middleware y en UnaryServerInterceptor que el token esté
+// vinculado al certificado de cliente de la conexión mTLS (RFC 8705): el claim `cnf.x5t#S256` debe
+// coincidir con la huella SHA-256 del certificado en r.TLS o en las credenciales TLS del peer gRPC.
+// Se rechazan con 401 (codes.Unauthenticated) los tokens sin `cnf` y las peticiones sin certificado
+// de cliente. Si el TLS termina en un proxy, usar ValidatePoP con la huella que reenvíe.
+func WithCertificateThumbprintBinding() Option {
+	return func(v *Validator) {
+		v.certificateBinding = true
+	}
+}
+
+// CertificateThumbprint devuelve la huella `x5t#S256` de un certificado: el SHA-256 de su
+// codificación DER en base64url sin relleno, el formato del claim `cnf`.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidatePoP valida el token igual que Validate y comprueba además que esté vinculado al
+// certificado de cliente cuya huella `x5t#S256` es peerCertThumbprint (ver CertificateThumbprint).
+func (v *Validator) ValidatePoP(ctx context.Context, tokenString, peerCertThumbprint string) (*UserClaims, error) {
+	claims, err := v.validateToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCertificateBinding(claims, peerCertThumbprint); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkCertificateBinding compara el claim `cnf.x5t#S256` del token con la huella del certificado
+// presentado. Una huella vacía (sin certificado) nunca coincide.
+func checkCertificateBinding(claims *UserClaims, peerCertThumbprint string) error {
+	bound := claims.certThumbprint
+	if bound == "" || peerCertThumbprint == "" ||
+		subtle.ConstantTimeCompare([]byte(bound), []byte(peerCertThumbprint)) != 1 {
+		return newValidationError(ErrCertificateBindingMismatch, "cnf.x5t#S256", peerCertThumbprint, bound)
+	}
+	return nil
+}
+
+// boundCertificateThumbprint devuelve el claim `cnf.x5t#S256` del token, o "" si no está vinculado.
+func boundCertificateThumbprint(mapClaims jwt.MapClaims) string {
+	cnf, _ := mapClaims["cnf"].(map[string]any)
+	bound, _ := cnf["x5t#S256"].(string)
+	return bound
+}
+
+// peerCertificateThumbprint devuelve la huella del certificado de cliente de la petición, o ""
+// si la conexión no es TLS o el cliente no presentó certificado.
+func peerCertificateThumbprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return CertificateThumbprint(r.TLS.PeerCertificates[0])
+}
+
+// grpcPeerCertificateThumbprint es como peerCertificateThumbprint para el peer de una llamada gRPC.
+func grpcPeerCertificateThumbprint(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return ""
+	}
+	return CertificateThumbprint(tlsInfo.State.PeerCertificates[0])
+}
@@ -0,0 +1,153 @@
+package azure
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// boundCert es el certificado de cliente al que se vinculan los tokens de prueba; la huella
+	// solo depende de Raw.
+	boundCert = &x509.Certificate{Raw: []byte("jwtazure-bound-client-cert")}
+	otherCert = &x509.Certificate{Raw: []byte("jwtazure-other-client-cert")}
+)
+
+// withCnf vincula el token al certificado indicado.
+func withCnf(cert *x509.Certificate) func(jwt.MapClaims) {
+	return withClaim("cnf", map[string]any{"x5t#S256": CertificateThumbprint(cert)})
+}
+
+// bindingValidatorOptions son las configuraciones con las que la vinculación debe funcionar igual.
+var bindingValidatorOptions = []struct {
+	name string
+	opts []Option
+}{
+	{name: "default claims"},
+	{
+		name: "custom claims builder",
+		opts: []Option{WithClaimsBuilder(func(c jwt.MapClaims) *UserClaims {
+			sub, _ := c.GetSubject()
+			return &UserClaims{Subject: sub}
+		})},
+	},
+	{name: "raw claims allowlist", opts: []Option{WithRawClaimsAllowlist("sub")}},
+	{name: "result cache", opts: []Option{WithResultCache(16)}},
+}
+
+// bindingCases son los tokens y certificados de cliente de las pruebas de vinculación.
+var bindingCases = []struct {
+	name    string
+	mutate  []func(jwt.MapClaims)
+	cert    *x509.Certificate
+	wantErr bool
+}{
+	{name: "matching certificate", mutate: []func(jwt.MapClaims){withCnf(boundCert)}, cert: boundCert},
+	{name: "other certificate", mutate: []func(jwt.MapClaims){withCnf(boundCert)}, cert: otherCert, wantErr: true},
+	{name: "no client certificate", mutate: []func(jwt.MapClaims){withCnf(boundCert)}, wantErr: true},
+	{name: "unbound token", cert: boundCert, wantErr: true},
+}
+
+func TestCertificateBindingMiddleware(t *testing.T) {
+	for _, config := range bindingValidatorOptions {
+		t.Run(config.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, append([]Option{WithCertificateThumbprintBinding()}, config.opts...)...)
+			handler := v.Middleware(okHandler)
+
+			for _, tt := range bindingCases {
+				t.Run(tt.name, func(t *testing.T) {
+					req := httptest.NewRequest(http.MethodGet, "/", nil)
+					req.Header.Set("Authorization", "Bearer "+testToken(keySet, tt.mutate...))
+					if tt.cert != nil {
+						req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+					}
+
+					// Dos veces, para cubrir también la respuesta desde la caché de resultados.
+					for range 2 {
+						rec := httptest.NewRecorder()
+						handler.ServeHTTP(rec, req)
+
+						want := http.StatusOK
+						if tt.wantErr {
+							want = http.StatusUnauthorized
+						}
+						if rec.Code != want {
+							t.Fatalf("status = %d, want %d", rec.Code, want)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestCertificateBindingGRPC(t *testing.T) {
+	for _, config := range bindingValidatorOptions {
+		t.Run(config.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, append([]Option{WithCertificateThumbprintBinding()}, config.opts...)...)
+			interceptor := v.UnaryServerInterceptor()
+			info := &grpc.UnaryServerInfo{FullMethod: "/jwtazure.Test/Call"}
+			handler := func(ctx context.Context, _ any) (any, error) { return "ok", nil }
+
+			for _, tt := range bindingCases {
+				t.Run(tt.name, func(t *testing.T) {
+					ctx := metadata.NewIncomingContext(context.Background(),
+						metadata.Pairs(authorizationMetadataKey, "Bearer "+testToken(keySet, tt.mutate...)))
+					if tt.cert != nil {
+						ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{
+							State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}},
+						}})
+					}
+
+					_, err := interceptor(ctx, nil, info, handler)
+					if tt.wantErr {
+						if status.Code(err) != codes.Unauthenticated {
+							t.Fatalf("got %v, want codes.Unauthenticated", err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("interceptor: %v", err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestValidatePoP(t *testing.T) {
+	for _, config := range bindingValidatorOptions {
+		t.Run(config.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, config.opts...)
+
+			for _, tt := range bindingCases {
+				t.Run(tt.name, func(t *testing.T) {
+					var thumbprint string
+					if tt.cert != nil {
+						thumbprint = CertificateThumbprint(tt.cert)
+					}
+
+					_, err := v.ValidatePoP(context.Background(), testToken(keySet, tt.mutate...), thumbprint)
+					if tt.wantErr != errors.Is(err, ErrCertificateBindingMismatch) {
+						t.Fatalf("ValidatePoP: %v, want mismatch: %v", err, tt.wantErr)
+					}
+					if !tt.wantErr && err != nil {
+						t.Fatalf("ValidatePoP: %v", err)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package azure
+
+import (
+	"fmt"
+	"slices"
+)
+
+// =============================================================================
+// Reconfiguración en Caliente
+// =============================================================================
+
+// SetAudiences reemplaza las audiencias válidas (las de WithAudiences) mientras el validador está
+// en uso, p. ej. al dar de alta nuevas aplicaciones cliente, sin reiniciar el servicio. Es seguro
+// llamarlo de forma concurrente con las validaciones: cada validación usa las audiencias vigentes
+// al empezar. Aplica las mismas restricciones que la construcción del validador.
+func (v *Validator) SetAudiences(audiences ...string) error {
+	if v.isAudienceCheckEnabled && len(audiences) == 0 &&
+		len(v.issuerAudiences) == 0 && v.audienceValidationFunc == nil {
+		return fmt.Errorf("la validación de audiencia está habilitada pero no se proporcionaron audiencias válidas")
+	}
+	if v.strictAudience && len(audiences) > 1 {
+		return fmt.Errorf("WithStrictAudience requiere una única audiencia, se proporcionaron %d", len(audiences))
+	}
+	if err := v.checkAudienceConfig(audiences, v.currentEndpoints()); err != nil {
+		return err
+	}
+
+	v.swapConfig(func() {
+		v.validAudiences = slices.Clone(audiences)
+	})
+	return nil
+}
+
+// SetIssuers reemplaza los emisores válidos mientras el validador está en uso, con las mismas
+// garantías que SetAudiences. No afecta al modo multi-inquilino (WithAllowedTenants), que
+// calcula los emisores a partir del `tid`. Con WithSymmetricKey, rechaza los emisores de Azure
+// igual que NewValidator. Con NewDiscoveryValidator, prevalece sobre el emisor descubierto.
+func (v *Validator) SetIssuers(issuers ...string) error {
+	if len(issuers) == 0 {
+		return fmt.Errorf("no se proporcionaron emisores válidos")
+	}
+	if err := v.checkSymmetricIssuers(issuers); err != nil {
+		return err
+	}
+
+	v.swapConfig(func() {
+		v.validIssuers = slices.Clone(issuers)
+		// El documento de descubrimiento ya no reemplaza los emisores elegidos.
+		if v.discovery != nil {
+			v.discovery.customIssuers = true
+		}
+	})
+	return nil
+}
+
+// swapConfig aplica un cambio de configuración y descarta las cachés de resultados y de rechazos
+// (WithResultCache, WithNegativeCache): sus entradas se obtuvieron con la configuración anterior.
+// La nueva generación impide además reutilizar las que guarden validaciones aún en curso.
+func (v *Validator) swapConfig(apply func()) {
+	v.configMu.Lock()
+	apply()
+	v.configGeneration++
+	v.configMu.Unlock()
+
+	v.purgeCaches()
+}
+
+// currentEndpoints devuelve las URLs de los JWKS y los emisores por defecto vigentes, que pueden
+// haber cambiado desde la construcción con el documento de descubrimiento.
+func (v *Validator) currentEndpoints() endpoints {
+	var ep endpoints
+	if v.jwksV1 != nil {
+		ep.jwksV1URL = v.jwksV1.jwksURL()
+	}
+	if v.jwksV2 != nil {
+		ep.jwksV2URL = v.jwksV2.jwksURL()
+	}
+
+	v.configMu.RLock()
+	defer v.configMu.RUnlock()
+	ep.issuers = v.defaultIssuers
+	ep.tokenURL = v.tokenURL
+	ep.authorizationURL = v.authorizationURL
+	return ep
+}
+
+// generation devuelve la generación vigente de la configuración, que forma parte de la clave de
+// las cachés.
+func (v *Validator) generation() uint64 {
+	v.configMu.RLock()
+	defer v.configMu.RUnlock()
+	return v.configGeneration
+}
+
+// audiences devuelve las audiencias válidas vigentes. Los setters reemplazan el slice en lugar
+// de modificarlo, por lo que el resultado puede usarse tras liberar el mutex.
+func (v *Validator) audiences() []string {
+	v.configMu.RLock()
+	defer v.configMu.RUnlock()
+	return v.validAudiences
+}
+
+// issuers devuelve los emisores válidos vigentes, con el mismo criterio que audiences.
+func (v *Validator) issuers() []string {
+	v.configMu.RLock()
+	defer v.configMu.RUnlock()
+	return v.validIssuers
+}
+
+// tokenEndpoint devuelve el endpoint de token vigente, que puede cambiar con el documento de
+// descubrimiento.
+func (v *Validator) tokenEndpoint() string {
+	v.configMu.RLock()
+	defer v.configMu.RUnlock()
+	return v.tokenURL
+}
+
+// authorizationEndpoint devuelve el endpoint de autorización vigente, con el mismo criterio que
+// tokenEndpoint.
+func (v *Validator) authorizationEndpoint() string {
+	v.configMu.RLock()
+	defer v.configMu.RUnlock()
+	return v.authorizationURL
+}
@@ -0,0 +1,183 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+func TestSetAudiences(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	token := testToken(keySet)
+
+	if err := v.SetAudiences("api://other"); err != nil {
+		t.Fatalf("SetAudiences: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), token); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("old audience: got %v, want ErrInvalidAudience", err)
+	}
+
+	other := testToken(keySet, withClaim("aud", "api://other"))
+	if _, err := v.Validate(context.Background(), other); err != nil {
+		t.Fatalf("new audience: %v", err)
+	}
+
+	if err := v.SetAudiences(); err == nil {
+		t.Fatal("SetAudiences without audiences: expected an error")
+	}
+
+	// Se rechazan los mismos errores de configuración que en NewValidator, sin aplicar el cambio.
+	for _, audience := range []string{
+		"https://login.microsoftonline.com/" + testTenantID + "/discovery/v2.0/keys",
+		"https://login.microsoftonline.com/" + testTenantID + "/v2.0",
+		testTenantID,
+	} {
+		if err := v.SetAudiences(audience); err == nil || !strings.Contains(err.Error(), audience) {
+			t.Errorf("SetAudiences(%q): got %v, want an error naming it", audience, err)
+		}
+	}
+	if _, err := v.Validate(context.Background(), other); err != nil {
+		t.Fatalf("audience after rejected updates: %v", err)
+	}
+}
+
+// TestSetAudiencesConcurrent actualiza la configuración mientras se valida en paralelo; ejecutado
+// con -race, detecta accesos sin sincronizar.
+func TestSetAudiencesConcurrent(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	token := testToken(keySet)
+	issuer := jwtazuretest.Claims(testTenantID, testAudience)["iss"].(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				// Según el momento, el token encaja o no con las audiencias vigentes.
+				if _, err := v.Validate(context.Background(), token); err != nil && !errors.Is(err, ErrInvalidAudience) {
+					t.Errorf("Validate: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; ctx.Err() == nil; i++ {
+		audiences := []string{testAudience}
+		if i%2 == 1 {
+			audiences = []string{"api://other"}
+		}
+		if err := v.SetAudiences(audiences...); err != nil {
+			t.Fatalf("SetAudiences: %v", err)
+		}
+		if err := v.SetIssuers(issuer); err != nil {
+			t.Fatalf("SetIssuers: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if err := v.SetAudiences(testAudience); err != nil {
+		t.Fatalf("SetAudiences: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), token); err != nil {
+		t.Fatalf("Validate after the updates: %v", err)
+	}
+}
+
+func TestSetAudiencesAppliesToProtect(t *testing.T) {
+	v, keySet := newTestValidator(t)
+	protect := v.Protect(ProtectOptions{})(okHandler)
+	middleware := v.Middleware(okHandler)
+	token := testToken(keySet)
+
+	if w := serve(protect, token); w.Code != http.StatusOK {
+		t.Fatalf("before SetAudiences: status %d, want 200", w.Code)
+	}
+
+	if err := v.SetAudiences("api://other"); err != nil {
+		t.Fatalf("SetAudiences: %v", err)
+	}
+	for name, handler := range map[string]http.Handler{"Protect": protect, "Middleware": middleware} {
+		if w := serve(handler, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s after SetAudiences: status %d, want 401", name, w.Code)
+		}
+	}
+}
+
+func TestSetIssuersRejectsAzureIssuerWithSymmetricKey(t *testing.T) {
+	secret := []byte("jwtazure-test-secret")
+	v, _ := newTestValidator(t,
+		WithIssuers("https://dev.local"),
+		WithSymmetricKey(jwt.SigningMethodHS256.Alg(), secret),
+	)
+
+	azureIssuers := []string{
+		"https://login.microsoftonline.com/" + testTenantID + "/v2.0",
+		"https://sts.windows.net/" + testTenantID + "/",
+		"https://login.microsoftonline.com/00000000-0000-0000-0000-000000000002/v2.0",
+		"https://contoso.b2clogin.com/contoso.onmicrosoft.com/v2.0/",
+	}
+	for _, issuer := range azureIssuers {
+		if err := v.SetIssuers("https://dev.local", issuer); err == nil {
+			t.Errorf("SetIssuers(%q): expected an error", issuer)
+		}
+	}
+
+	claims := jwtazuretest.Claims(testTenantID, testAudience)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), token); !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("HS256 token with Azure issuer: got %v, want ErrInvalidIssuer", err)
+	}
+
+	if err := v.SetIssuers("https://dev2.local"); err != nil {
+		t.Fatalf("SetIssuers with a development issuer: %v", err)
+	}
+}
+
+func TestSetIssuersInvalidatesNegativeCache(t *testing.T) {
+	v1Issuer := "https://sts.windows.net/" + testTenantID + "/"
+	v2Issuer := "https://login.microsoftonline.com/" + testTenantID + "/v2.0"
+	v, keySet := newTestValidator(t, WithIssuers(v1Issuer), WithNegativeCache(16, time.Hour))
+	token := testToken(keySet)
+
+	if _, err := v.Validate(context.Background(), token); !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("before SetIssuers: got %v, want ErrInvalidIssuer", err)
+	}
+
+	if err := v.SetIssuers(v1Issuer, v2Issuer); err != nil {
+		t.Fatalf("SetIssuers: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), token); err != nil {
+		t.Fatalf("after SetIssuers: %v", err)
+	}
+}
+
+func TestSetIssuersInvalidatesResultCache(t *testing.T) {
+	v, keySet := newTestValidator(t, WithResultCache(16))
+	token := testToken(keySet)
+
+	if _, err := v.Validate(context.Background(), token); err != nil {
+		t.Fatalf("before SetIssuers: %v", err)
+	}
+
+	if err := v.SetIssuers("https://login.microsoftonline.com/00000000-0000-0000-0000-000000000002/v2.0"); err != nil {
+		t.Fatalf("SetIssuers: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), token); !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("after SetIssuers: got %v, want ErrInvalidIssuer", err)
+	}
+}
@@ -0,0 +1,108 @@
+package azure
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxRetryAfter es la espera máxima que se respeta ante un 429 al descargar los JWKS.
+const defaultMaxRetryAfter = 10 * time.Second
+
+// WithMaxRetryAfter limita cuánto se espera cuando Azure responde 429 con Retry-After al
+// descargar los JWKS. Si Retry-After supera el límite, no se reintenta y el refresco falla
+// hasta el siguiente intervalo. Cero desactiva los reintentos. Por defecto es 10s.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(v *Validator) {
+		v.maxRetryAfter = d
+	}
+}
+
+// retryAfterTransport reintenta una vez las peticiones que reciben 429, esperando lo indicado
+// en Retry-After siempre que no supere maxWait, en lugar de insistir contra Azure.
+type retryAfterTransport struct {
+	next    http.RoundTripper
+	maxWait time.Duration
+}
+
+// withRetryAfter devuelve una copia del cliente cuyo transporte respeta 429 + Retry-After.
+// No modifica el cliente recibido, que puede estar compartido con el resto de la aplicación.
+func withRetryAfter(client *http.Client, maxWait time.Duration) *http.Client {
+	if maxWait <= 0 {
+		return client
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	wrapped := *client
+	wrapped.Transport = &retryAfterTransport{next: next, maxWait: maxWait}
+	return &wrapped
+}
+
+// RoundTrip implementa http.RoundTripper.
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	// Solo se reintenta si la petición puede repetirse (las descargas de JWKS no llevan cuerpo).
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok || wait > t.maxWait {
+		return resp, nil
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-timer.C:
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	return t.next.RoundTrip(req)
+}
+
+// parseRetryAfter interpreta la cabecera Retry-After, expresada en segundos o como fecha HTTP.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
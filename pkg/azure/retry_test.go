@@ -0,0 +1,128 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+// rateLimitedOnce devuelve un handler que responde 429 con el Retry-After indicado a la primera
+// petición y delega el resto en next.
+func rateLimitedOnce(retryAfter string, next http.Handler, requests *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestRetryAfterTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryAfter   string
+		maxWait      time.Duration
+		wantStatus   int
+		wantRequests int32
+	}{
+		{name: "retried after the wait", retryAfter: "1", maxWait: 5 * time.Second, wantStatus: http.StatusOK, wantRequests: 2},
+		{name: "wait above the cap", retryAfter: "60", maxWait: 5 * time.Second, wantStatus: http.StatusTooManyRequests, wantRequests: 1},
+		{name: "invalid Retry-After", retryAfter: "soon", maxWait: 5 * time.Second, wantStatus: http.StatusTooManyRequests, wantRequests: 1},
+		{name: "retries disabled", retryAfter: "1", wantStatus: http.StatusTooManyRequests, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(rateLimitedOnce(tt.retryAfter, okHandler, &requests))
+			t.Cleanup(server.Close)
+
+			start := time.Now()
+			resp, err := withRetryAfter(server.Client(), tt.maxWait).Get(server.URL)
+			if err != nil {
+				t.Fatalf("GET: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus || requests.Load() != tt.wantRequests {
+				t.Fatalf("status = %d after %d requests, want %d after %d",
+					resp.StatusCode, requests.Load(), tt.wantStatus, tt.wantRequests)
+			}
+			if tt.wantRequests == 2 && time.Since(start) < time.Second {
+				t.Fatalf("retried after %v, before Retry-After elapsed", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestRetryAfterTransportContextCanceled(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(rateLimitedOnce("5", okHandler, &requests))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := withRetryAfter(server.Client(), time.Minute).Do(req); err == nil {
+		t.Fatal("request canceled while waiting for Retry-After: expected an error")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "3", want: 3 * time.Second, wantOK: true},
+		{value: " 0 ", wantOK: true},
+		{value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOK: true},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), wantOK: true},
+		{value: "-1"},
+		{value: ""},
+		{value: "soon"},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %t; want %v, %t", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestJWKSFetchHonorsRetryAfter(t *testing.T) {
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(rateLimitedOnce("0", keySet.Server.Config.Handler, &requests))
+	t.Cleanup(server.Close)
+
+	v, err := NewValidator(context.Background(), testTenantID,
+		WithAudiences(testAudience),
+		WithHTTPClient(redirectClient(server.URL)),
+		WithoutV1Endpoint(),
+		WithNoOpLogger(),
+	)
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	t.Cleanup(func() { _ = v.Close() })
+
+	// El 429 inicial se reintenta dentro de la misma descarga, así que las claves ya están cargadas.
+	if _, err := v.Validate(context.Background(), testToken(keySet)); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("JWKS requests = %d, want 2", got)
+	}
+}
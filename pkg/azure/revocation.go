@@ -0,0 +1,52 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// =============================================================================
+// Revocación de Tokens
+// =============================================================================
+
+var (
+	// ErrTokenRevoked indica que el RevocationChecker configurado con WithRevocationChecker
+	// considera revocado un token por lo demás válido.
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrRevocationCheckFailed indica que no se pudo consultar el estado de revocación del token;
+	// el token se rechaza en lugar de aceptarse sin comprobar.
+	ErrRevocationCheckFailed = errors.New("failed to check token revocation")
+)
+
+// RevocationChecker indica si un token ya validado está revocado, p. ej. consultando una lista de
+// bloqueo por `jti` (disponible en RawClaims) o por ObjectID tras dar de baja a un usuario.
+type RevocationChecker func(ctx context.Context, claims *UserClaims) (revoked bool, err error)
+
+// WithRevocationChecker registra un RevocationChecker que se invoca tras comprobar la firma, el
+// emisor, la audiencia y el resto de reglas, también para los tokens servidos desde la caché de
+// resultados (WithResultCache), de modo que una revocación surte efecto de inmediato. Un token
+// revocado falla con ErrTokenRevoked; si el checker devuelve un error, la validación falla con
+// ErrRevocationCheckFailed y los middlewares responden 503 para que el cliente reintente. Ninguno
+// de los dos resultados se guarda en la caché negativa.
+func WithRevocationChecker(checker RevocationChecker) Option {
+	return func(v *Validator) {
+		v.revocationChecker = checker
+	}
+}
+
+// checkRevocation aplica WithRevocationChecker a los claims validados.
+func (v *Validator) checkRevocation(ctx context.Context, claims *UserClaims) error {
+	if v.revocationChecker == nil {
+		return nil
+	}
+
+	revoked, err := v.revocationChecker(ctx, claims)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRevocationCheckFailed, err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
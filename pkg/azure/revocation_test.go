@@ -0,0 +1,102 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jtiBlocklist es una lista de bloqueo por `jti` en memoria, como la que consultaría un checker real.
+type jtiBlocklist struct {
+	mu      sync.Mutex
+	blocked map[string]bool
+}
+
+func (b *jtiBlocklist) set(jti string, blocked bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocked[jti] = blocked
+}
+
+func (b *jtiBlocklist) check(_ context.Context, claims *UserClaims) (bool, error) {
+	jti, _ := claims.RawClaims["jti"].(string)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.blocked[jti], nil
+}
+
+func TestWithRevocationChecker(t *testing.T) {
+	blocklist := &jtiBlocklist{blocked: map[string]bool{}}
+	// Con las cachés habilitadas, la revocación y su anulación surten efecto de inmediato.
+	v, keySet := newTestValidator(t,
+		WithRevocationChecker(blocklist.check),
+		WithResultCache(16),
+		WithNegativeCache(16, time.Hour),
+	)
+	token := testToken(keySet, withClaim("jti", "token-1"))
+
+	steps := []struct {
+		name    string
+		blocked bool
+		wantErr error
+	}{
+		{name: "allowed"},
+		{name: "blocklisted", blocked: true, wantErr: ErrTokenRevoked},
+		{name: "allowed again"},
+	}
+
+	for _, step := range steps {
+		blocklist.set("token-1", step.blocked)
+		if _, err := v.Validate(context.Background(), token); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: got %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	blocklist.set("token-1", true)
+	if rec := serve(v.Middleware(okHandler), token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Middleware status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Otros tokens no se ven afectados.
+	if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("jti", "token-2"))); err != nil {
+		t.Fatalf("other jti: %v", err)
+	}
+}
+
+func TestWithRevocationCheckerFailure(t *testing.T) {
+	errLookup := errors.New("blocklist unavailable")
+	calls := 0
+	v, keySet := newTestValidator(t, WithRevocationChecker(func(context.Context, *UserClaims) (bool, error) {
+		calls++
+		return false, errLookup
+	}))
+
+	if _, err := v.Validate(context.Background(), testToken(keySet)); !errors.Is(err, ErrRevocationCheckFailed) || !errors.Is(err, errLookup) {
+		t.Fatalf("got %v, want ErrRevocationCheckFailed wrapping the checker error", err)
+	}
+
+	// El middleware pide reintentar en lugar de rechazar unas credenciales posiblemente válidas.
+	rec := serve(v.Middleware(okHandler), testToken(keySet))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Middleware status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("Retry-After = %q, want 30", got)
+	}
+	if p := decodeProblem(t, rec.Body.Bytes()); p.Type != "urn:jwtazure:revocation-check-failed" {
+		t.Fatalf("problem type = %q, want urn:jwtazure:revocation-check-failed", p.Type)
+	}
+
+	// El checker solo se consulta para tokens que superan el resto de comprobaciones.
+	calls = 0
+	if _, err := v.Validate(context.Background(), testToken(keySet, withClaim("aud", "api://other"))); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("wrong audience: got %v, want ErrInvalidAudience", err)
+	}
+	if calls != 0 {
+		t.Fatalf("the checker ran %d times for an invalid token", calls)
+	}
+}
@@ -0,0 +1,78 @@
+package azure
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// =============================================================================
+// Clave Simétrica (solo desarrollo)
+// =============================================================================
+
+// symmetricAlgorithms son los algoritmos HMAC admitidos por WithSymmetricKey.
+var symmetricAlgorithms = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodHS384.Alg(),
+	jwt.SigningMethodHS512.Alg(),
+}
+
+// WithSymmetricKey acepta, además de los tokens de Azure, tokens firmados con el algoritmo HMAC
+// indicado (HS256, HS384 o HS512) y el secreto compartido, para desarrollo local y pruebas.
+//
+// SOLO PARA DESARROLLO: cualquiera que conozca el secreto puede emitir tokens válidos. Para
+// evitar habilitarlo por accidente en producción, exige WithIssuers con emisores propios:
+// NewValidator falla si alguno de los emisores configurados es un emisor de Azure.
+func WithSymmetricKey(alg string, secret []byte) Option {
+	return func(v *Validator) {
+		v.symmetricAlg = alg
+		v.symmetricKey = secret
+	}
+}
+
+// configureSymmetricKey valida la configuración de WithSymmetricKey frente a los emisores de
+// Azure del validador y añade el algoritmo a los permitidos.
+func (v *Validator) configureSymmetricKey() error {
+	if v.symmetricKey == nil {
+		return nil
+	}
+
+	if !slices.Contains(symmetricAlgorithms, v.symmetricAlg) {
+		return fmt.Errorf("algoritmo simétrico no soportado: %q", v.symmetricAlg)
+	}
+	if len(v.symmetricKey) == 0 {
+		return fmt.Errorf("la clave simétrica no puede estar vacía")
+	}
+	if len(v.allowedTenants) > 0 {
+		return fmt.Errorf("la clave simétrica no puede combinarse con WithAllowedTenants")
+	}
+	if err := v.checkSymmetricIssuers(v.validIssuers); err != nil {
+		return err
+	}
+
+	if !slices.Contains(v.validMethods, v.symmetricAlg) {
+		v.validMethods = append(slices.Clone(v.validMethods), v.symmetricAlg)
+	}
+	return nil
+}
+
+// checkSymmetricIssuers impide que, con WithSymmetricKey, se acepten emisores de Azure: los del
+// inquilino del validador o cualquiera de un host de inicio de sesión de Azure. Se aplica al
+// construir el validador y en SetIssuers, para que la reconfiguración no eluda la restricción.
+func (v *Validator) checkSymmetricIssuers(issuers []string) error {
+	if v.symmetricKey == nil {
+		return nil
+	}
+
+	v.configMu.RLock()
+	defaultIssuers := v.defaultIssuers
+	v.configMu.RUnlock()
+
+	for _, issuer := range issuers {
+		if slices.Contains(defaultIssuers, issuer) || v.cloud.isAzureIssuer(issuer) {
+			return fmt.Errorf("la clave simétrica no puede combinarse con el emisor de Azure %q: usa WithIssuers con emisores de desarrollo", issuer)
+		}
+	}
+	return nil
+}
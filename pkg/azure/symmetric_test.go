@@ -0,0 +1,82 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/norlis/jwtazure/pkg/azure/jwtazuretest"
+)
+
+const devIssuer = "https://dev.local"
+
+// hmacToken firma con secret claims de prueba válidos del emisor de desarrollo.
+func hmacToken(t *testing.T, method jwt.SigningMethod, secret []byte) string {
+	t.Helper()
+
+	claims := jwtazuretest.Claims(testTenantID, testAudience)
+	claims["iss"] = devIssuer
+	signed, err := jwt.NewWithClaims(method, claims).SignedString(secret)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestWithSymmetricKey(t *testing.T) {
+	secret := []byte("dev-only-shared-secret")
+	v, _ := newTestValidator(t, WithIssuers(devIssuer), WithSymmetricKey(jwt.SigningMethodHS256.Alg(), secret))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "shared secret", token: hmacToken(t, jwt.SigningMethodHS256, secret)},
+		{name: "wrong secret", token: hmacToken(t, jwt.SigningMethodHS256, []byte("other-secret")), wantErr: jwt.ErrTokenSignatureInvalid},
+		{name: "other algorithm", token: hmacToken(t, jwt.SigningMethodHS384, secret), wantErr: jwt.ErrTokenSignatureInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Validate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Subject != "jwtazuretest-subject" {
+				t.Fatalf("Subject = %q", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestWithSymmetricKeyRejectsAzureIssuers(t *testing.T) {
+	secret := []byte("dev-only-shared-secret")
+	keySet := jwtazuretest.NewKeySet()
+	t.Cleanup(keySet.Close)
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "default issuers", opts: []Option{WithSymmetricKey(jwt.SigningMethodHS256.Alg(), secret)}},
+		{name: "azure issuer", opts: []Option{WithIssuers("https://login.microsoftonline.com/" + otherTenantID + "/v2.0"), WithSymmetricKey(jwt.SigningMethodHS256.Alg(), secret)}},
+		{name: "asymmetric algorithm", opts: []Option{WithIssuers(devIssuer), WithSymmetricKey(jwt.SigningMethodRS256.Alg(), secret)}},
+		{name: "empty secret", opts: []Option{WithIssuers(devIssuer), WithSymmetricKey(jwt.SigningMethodHS256.Alg(), []byte{})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(context.Background(), testTenantID, append([]Option{
+				WithAudiences(testAudience),
+				WithHTTPClient(keySet.HTTPClient()),
+				WithNoOpLogger(),
+			}, tt.opts...)...)
+			if err == nil {
+				_ = v.Close()
+				t.Fatal("NewValidator succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// =============================================================================
+// Fuentes del Token
+// =============================================================================
+
+// TokenSource obtiene el token en bruto de una petición HTTP. Devuelve ("", nil) cuando
+// la fuente no está presente en la petición, para que se pruebe la siguiente fuente; un error
+// detiene la búsqueda y rechaza la petición.
+type TokenSource func(r *http.Request) (string, error)
+
+// extractToken recorre las fuentes configuradas en orden y devuelve el primer token encontrado.
+func (v *Validator) extractToken(r *http.Request) (string, error) {
+	// HeaderSource lee el esquema configurado del contexto, ya que también puede usarse
+	// en WithTokenSources sin referencia al validador.
+	if v.authScheme != defaultAuthScheme {
+		r = r.WithContext(context.WithValue(r.Context(), authSchemeKey{}, v.authScheme))
+	}
+
+	for _, source := range v.tokenSources {
+		tokenString, err := source(r)
+		if err != nil {
+			return "", err
+		}
+		if tokenString != "" {
+			if err := v.checkTokenSize(tokenString); err != nil {
+				return "", err
+			}
+			return tokenString, nil
+		}
+	}
+
+	return "", ErrMissingAuthHeader
+}
+
+// defaultMaxTokenBytes es el tamaño máximo por defecto de un token (ver WithMaxTokenBytes).
+const defaultMaxTokenBytes = 8 << 10
+
+// checkTokenSize rechaza con ErrTokenTooLarge los tokens que superan el tamaño máximo.
+func (v *Validator) checkTokenSize(tokenString string) error {
+	if len(tokenString) > v.maxTokenBytes {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrTokenTooLarge, len(tokenString), v.maxTokenBytes)
+	}
+	return nil
+}
+
+// HeaderSource devuelve la fuente por defecto, que lee el token de la cabecera Authorization
+// con el esquema configurado (WithAuthScheme, WithSchemelessToken).
+func HeaderSource() TokenSource {
+	return headerTokenSource
+}
+
+// headerTokenSource extracts the JWT from the Authorization header,
+// handling the scheme ("Bearer" by default) in a case-insensitive manner as per RFC 6750.
+func headerTokenSource(r *http.Request) (string, error) {
+	scheme, ok := r.Context().Value(authSchemeKey{}).(authScheme)
+	if !ok {
+		scheme = defaultAuthScheme
+	}
+	return scheme.parseValues(r.Header.Values("Authorization"))
+}
+
+// CookieSource devuelve una fuente que lee el token en bruto de la cookie indicada.
+func CookieSource(name string) TokenSource {
+	return func(r *http.Request) (string, error) {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return "", nil
+		}
+
+		return cookie.Value, nil
+	}
+}
+
+// QuerySource devuelve una fuente que lee el token en bruto del parámetro de consulta indicado.
+// Tras validar, el parámetro se elimina de la URL que reciben los handlers posteriores.
+func QuerySource(param string) TokenSource {
+	return func(r *http.Request) (string, error) {
+		if r.URL == nil {
+			return "", nil
+		}
+		return r.URL.Query().Get(param), nil
+	}
+}
+
+// stripQueryToken devuelve la petición sin los parámetros de consulta que transportan el token,
+// para que no acaben en los logs de acceso de los handlers posteriores. Se buscan por valor, de
+// modo que funciona con cualquier fuente. No modifica la URL original, que puede estar
+// compartida con otras copias de la petición.
+func stripQueryToken(r *http.Request, tokenString string) *http.Request {
+	if r.URL == nil || r.URL.RawQuery == "" {
+		return r
+	}
+
+	query := r.URL.Query()
+	found := false
+	for param, values := range query {
+		if slices.Contains(values, tokenString) {
+			query.Del(param)
+			found = true
+		}
+	}
+	if !found {
+		return r
+	}
+
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+	return r
+}
+
+// authSchemeKey es la clave de contexto con la que extractToken pasa el esquema a HeaderSource.
+type authSchemeKey struct{}
+
+// authScheme describe cómo se interpreta un valor de Authorization: el esquema esperado
+// y si se acepta también el token en bruto, sin esquema.
+type authScheme struct {
+	name       string
+	schemeless bool
+}
+
+// defaultAuthScheme es el esquema por defecto, "Bearer" (RFC 6750).
+var defaultAuthScheme = authScheme{name: "Bearer"}
+
+// parseValues devuelve el token del primer valor de Authorization válido. Algunos proxies duplican
+// la cabecera, por lo que se recorren todos los valores y solo se devuelve
+// ErrInvalidAuthHeaderFormat si ninguno corresponde al esquema. Sin valores devuelve ("", nil).
+func (s authScheme) parseValues(values []string) (string, error) {
+	var err error
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+
+		var tokenString string
+		tokenString, err = s.parse(value)
+		if err == nil {
+			return tokenString, nil
+		}
+	}
+
+	return "", err
+}
+
+// parse parses a raw Authorization value ("{scheme} {token}") and returns the token.
+// It is shared by the HTTP middleware and the gRPC interceptor.
+func (s authScheme) parse(authHeader string) (string, error) {
+	if authHeader == "" {
+		return "", ErrMissingAuthHeader
+	}
+
+	// The scheme is case-insensitive. Check for the "{scheme} " prefix.
+	prefixLen := len(s.name) + 1
+	if len(authHeader) > prefixLen && strings.EqualFold(authHeader[:prefixLen-1], s.name) && authHeader[prefixLen-1] == ' ' {
+		return authHeader[prefixLen:], nil
+	}
+
+	// Sin esquema, el valor completo es el token, que nunca contiene espacios.
+	if s.schemeless && !strings.ContainsRune(authHeader, ' ') {
+		return authHeader, nil
+	}
+
+	return "", ErrInvalidAuthHeaderFormat
+}
@@ -0,0 +1,296 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tokenRequest construye una petición con el token en la cabecera Authorization (valor completo)
+// y en la cookie "session", omitiendo los vacíos.
+func tokenRequest(target, authorization, cookie string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+	}
+	return r
+}
+
+func TestWithTokenFromCookie(t *testing.T) {
+	v := applyOptions([]Option{WithTokenFromCookie("session")})
+
+	tests := []struct {
+		name          string
+		authorization string
+		cookie        string
+		want          string
+		wantErr       error
+	}{
+		{name: "header only", authorization: "Bearer header-token", want: "header-token"},
+		{name: "cookie only", cookie: "cookie-token", want: "cookie-token"},
+		{name: "both present", authorization: "Bearer header-token", cookie: "cookie-token", want: "header-token"},
+		{name: "neither", wantErr: ErrMissingAuthHeader},
+		{name: "malformed header with cookie", authorization: "Basic abc", cookie: "cookie-token", wantErr: ErrInvalidAuthHeaderFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.extractToken(tokenRequest("/", tt.authorization, tt.cookie))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("token = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTokenFromCookieMiddleware(t *testing.T) {
+	v, keySet := newTestValidator(t, WithTokenFromCookie("session"))
+
+	rec := httptest.NewRecorder()
+	v.Middleware(okHandler).ServeHTTP(rec, tokenRequest("/", "", testToken(keySet)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestWithTokenFromQuery(t *testing.T) {
+	v, keySet := newTestValidator(t, WithTokenFromQuery("access_token"))
+	token := testToken(keySet)
+
+	tests := []struct {
+		name          string
+		target        string
+		authorization string
+		want          int
+	}{
+		{name: "query only", target: "/ws?access_token=" + token, want: http.StatusOK},
+		{name: "header wins over query", target: "/ws?access_token=not-a-jwt", authorization: "Bearer " + token, want: http.StatusOK},
+		{name: "invalid header with valid query", target: "/ws?access_token=" + token, authorization: "Bearer not-a-jwt", want: http.StatusUnauthorized},
+		{name: "other parameter", target: "/ws?token=" + token, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			v.Middleware(okHandler).ServeHTTP(rec, tokenRequest(tt.target, tt.authorization, ""))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryAfterCookie(t *testing.T) {
+	// La consulta va detrás de la cookie sea cual sea el orden de las opciones.
+	for name, opts := range map[string][]Option{
+		"cookie first": {WithTokenFromCookie("session"), WithTokenFromQuery("access_token")},
+		"query first":  {WithTokenFromQuery("access_token"), WithTokenFromCookie("session")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := applyOptions(opts)
+
+			got, err := v.extractToken(tokenRequest("/ws?access_token=query-token", "", "cookie-token"))
+			if err != nil || got != "cookie-token" {
+				t.Fatalf("token = %q, %v; want the cookie token", got, err)
+			}
+			if got, _ := v.extractToken(tokenRequest("/ws?access_token=query-token", "", "")); got != "query-token" {
+				t.Fatalf("without cookie: token = %q, want the query token", got)
+			}
+		})
+	}
+}
+
+func TestWithTokenFromQueryStripsToken(t *testing.T) {
+	v, keySet := newTestValidator(t, WithTokenFromQuery("access_token"))
+
+	var gotURL string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	v.Middleware(next).ServeHTTP(rec, tokenRequest("/ws?room=1&access_token="+testToken(keySet), "", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// El handler posterior no debe ver el token en la URL.
+	if gotURL != "/ws?room=1" {
+		t.Fatalf("URL = %q, want %q", gotURL, "/ws?room=1")
+	}
+}
+
+func TestQueryIgnoredWithoutOption(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	rec := httptest.NewRecorder()
+	v.Middleware(okHandler).ServeHTTP(rec, tokenRequest("/ws?access_token="+testToken(keySet), "", ""))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestWithTokenSources(t *testing.T) {
+	tests := []struct {
+		name          string
+		sources       []TokenSource
+		target        string
+		authorization string
+		cookie        string
+		want          string
+		wantErr       error
+	}{
+		{name: "cookie before header", sources: []TokenSource{CookieSource("session"), HeaderSource()}, authorization: "Bearer header-token", cookie: "cookie-token", want: "cookie-token"},
+		{name: "falls back to header", sources: []TokenSource{CookieSource("session"), HeaderSource()}, authorization: "Bearer header-token", want: "header-token"},
+		{name: "query before cookie", sources: []TokenSource{QuerySource("access_token"), CookieSource("session")}, target: "/?access_token=query-token", cookie: "cookie-token", want: "query-token"},
+		{name: "header not enabled", sources: []TokenSource{CookieSource("session")}, authorization: "Bearer header-token", wantErr: ErrMissingAuthHeader},
+		{name: "no sources", authorization: "Bearer header-token", wantErr: ErrMissingAuthHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/"
+			}
+			v := applyOptions([]Option{WithTokenSources(tt.sources...)})
+
+			got, err := v.extractToken(tokenRequest(target, tt.authorization, tt.cookie))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("token = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithAuthScheme(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		authorization string
+		want          string
+		wantErr       error
+	}{
+		{name: "default bearer", authorization: "Bearer abc", want: "abc"},
+		{name: "bearer case-insensitive", authorization: "bEaReR abc", want: "abc"},
+		{name: "default rejects raw token", authorization: "abc", wantErr: ErrInvalidAuthHeaderFormat},
+		{name: "custom scheme", opts: []Option{WithAuthScheme("token")}, authorization: "Token abc", want: "abc"},
+		{name: "custom scheme rejects bearer", opts: []Option{WithAuthScheme("token")}, authorization: "Bearer abc", wantErr: ErrInvalidAuthHeaderFormat},
+		{name: "schemeless raw token", opts: []Option{WithSchemelessToken()}, authorization: "abc", want: "abc"},
+		{name: "schemeless keeps bearer", opts: []Option{WithSchemelessToken()}, authorization: "Bearer abc", want: "abc"},
+		{name: "schemeless rejects other scheme", opts: []Option{WithSchemelessToken()}, authorization: "Basic abc", wantErr: ErrInvalidAuthHeaderFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := applyOptions(tt.opts)
+
+			got, err := v.extractToken(tokenRequest("/", tt.authorization, ""))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("token = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithAuthSchemeMiddleware(t *testing.T) {
+	v, keySet := newTestValidator(t, WithAuthScheme("token"), WithSchemelessToken())
+	token := testToken(keySet)
+
+	for _, authorization := range []string{"token " + token, token} {
+		rec := httptest.NewRecorder()
+		v.Middleware(okHandler).ServeHTTP(rec, tokenRequest("/", authorization, ""))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Authorization %.12q...: status = %d, want %d", authorization, rec.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestMultipleAuthorizationHeaders(t *testing.T) {
+	v, keySet := newTestValidator(t)
+
+	tests := []struct {
+		name   string
+		values []string
+		want   int
+	}{
+		{name: "bearer second", values: []string{"Basic dXNlcjpwYXNz", "Bearer " + testToken(keySet)}, want: http.StatusOK},
+		{name: "empty first", values: []string{"", "Bearer " + testToken(keySet)}, want: http.StatusOK},
+		{name: "no bearer", values: []string{"Basic dXNlcjpwYXNz", "Digest abc"}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, value := range tt.values {
+				r.Header.Add("Authorization", value)
+			}
+
+			rec := httptest.NewRecorder()
+			v.Middleware(okHandler).ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Add("Authorization", "Basic dXNlcjpwYXNz")
+	r.Header.Add("Authorization", "Digest abc")
+	if _, err := v.extractToken(r); !errors.Is(err, ErrInvalidAuthHeaderFormat) {
+		t.Fatalf("no bearer value: got %v, want ErrInvalidAuthHeaderFormat", err)
+	}
+}
+
+func TestWithMaxTokenBytes(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		padding    int
+		wantErr    error
+		wantStatus int
+	}{
+		{name: "default limit, normal token", wantStatus: http.StatusOK},
+		{name: "default limit, oversized token", padding: 9 << 10, wantErr: ErrTokenTooLarge, wantStatus: http.StatusUnauthorized},
+		{name: "raised limit", opts: []Option{WithMaxTokenBytes(16 << 10)}, padding: 9 << 10, wantStatus: http.StatusOK},
+		{name: "lowered limit", opts: []Option{WithMaxTokenBytes(256)}, wantErr: ErrTokenTooLarge, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, append([]Option{WithoutV1Endpoint()}, tt.opts...)...)
+			calls := countKeyLookups(v)
+			token := testToken(keySet, withClaim("padding", strings.Repeat("x", tt.padding)))
+
+			_, err := v.Validate(context.Background(), token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			// Los tokens demasiado grandes se rechazan antes de decodificarlos y buscar la clave.
+			if tt.wantErr != nil && calls.Load() != 0 {
+				t.Fatalf("key lookups = %d for an oversized token, want 0", calls.Load())
+			}
+
+			rec := httptest.NewRecorder()
+			v.Middleware(okHandler).ServeHTTP(rec, tokenRequest("/", "Bearer "+token, ""))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Middleware status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
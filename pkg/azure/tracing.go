@@ -0,0 +1,82 @@
+package azure
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// =============================================================================
+// Trazas (OpenTelemetry)
+// =============================================================================
+
+const (
+	// tracerName identifica al paquete como origen de los spans.
+	tracerName = "github.com/norlis/jwtazure/pkg/azure"
+	// validateSpanName es el nombre del span que envuelve cada validación de token.
+	validateSpanName = "jwt.validate"
+
+	// baggageUserID y baggageTenantID son las entradas de baggage añadidas con WithBaggage.
+	baggageUserID   = "user.id"
+	baggageTenantID = "tenant.id"
+)
+
+// WithTracerProvider habilita la emisión de un span "jwt.validate" por cada validación, con
+// atributos del emisor, la coincidencia de audiencia y el resultado. Sin esta opción se usa
+// un tracer no-op. El contexto recibido por Validate (o el de la petición) es el span padre.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(v *Validator) {
+		v.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithBaggage añade al contexto de la petición, tras validar el token en Middleware, las entradas
+// de baggage de OpenTelemetry "user.id" (claim `oid`) y "tenant.id" (claim `tid`), de modo que los
+// servicios posteriores puedan etiquetar sus spans sin código adicional. Se propagan a otros
+// servicios solo si el cliente HTTP usa un propagador de baggage.
+func WithBaggage() Option {
+	return func(v *Validator) {
+		v.baggage = true
+	}
+}
+
+// contextWithClaimsBaggage añade al baggage del contexto el usuario y el inquilino de los claims.
+// Los claims vacíos o con valores no representables se omiten.
+func contextWithClaimsBaggage(ctx context.Context, claims *UserClaims) context.Context {
+	bag := baggage.FromContext(ctx)
+	for key, value := range map[string]string{
+		baggageUserID:   claims.ObjectID,
+		baggageTenantID: claims.TenantID,
+	} {
+		if value == "" {
+			continue
+		}
+		member, err := baggage.NewMember(key, value)
+		if err != nil {
+			continue
+		}
+		if updated, err := bag.SetMember(member); err == nil {
+			bag = updated
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// defaultTracer devuelve el tracer no-op usado cuando no se configura un TracerProvider.
+func defaultTracer() trace.Tracer {
+	return noop.NewTracerProvider().Tracer(tracerName)
+}
+
+// endValidationSpan registra el resultado de la validación en el span y lo finaliza.
+func endValidationSpan(span trace.Span, err error) {
+	span.SetAttributes(attribute.String("jwt.result", validationResult(err)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,151 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// spanRecorder es un TracerProvider en memoria que guarda los spans creados.
+type spanRecorder struct {
+	noop.TracerProvider
+
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+// recordedSpan guarda lo que el validador registra en un span.
+type recordedSpan struct {
+	noop.Span
+
+	name   string
+	parent trace.Span
+	attrs  map[attribute.Key]attribute.Value
+	errs   []error
+	status codes.Code
+	ended  bool
+}
+
+// recordingTracer crea los spans de un spanRecorder.
+type recordingTracer struct {
+	noop.Tracer
+	recorder *spanRecorder
+}
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{recorder: r}
+}
+
+// recorded devuelve los spans creados hasta ahora.
+func (r *spanRecorder) recorded() []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*recordedSpan(nil), r.spans...)
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{name: name, parent: trace.SpanFromContext(ctx), attrs: map[attribute.Key]attribute.Value{}}
+	t.recorder.mu.Lock()
+	t.recorder.spans = append(t.recorder.spans, span)
+	t.recorder.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+func (s *recordedSpan) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *recordedSpan) End(...trace.SpanEndOption)                    { s.ended = true }
+
+func TestWithTracerProvider(t *testing.T) {
+	recorder := &spanRecorder{}
+	v, keySet := newTestValidator(t, WithTracerProvider(recorder))
+
+	tests := []struct {
+		name          string
+		token         string
+		wantResult    string
+		wantAudience  bool
+		wantAudAttr   bool
+		wantErrStatus bool
+	}{
+		{name: "success", token: testToken(keySet), wantResult: ResultSuccess, wantAudience: true, wantAudAttr: true},
+		{name: "wrong audience", token: testToken(keySet, withClaim("aud", "api://other")), wantResult: ResultBadAudience, wantAudAttr: true, wantErrStatus: true},
+		{name: "malformed", token: "not-a-jwt", wantResult: ResultParseError, wantErrStatus: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parentCtx, parent := recordingTracer{recorder: recorder}.Start(context.Background(), "request")
+			_, _ = v.Validate(parentCtx, tt.token)
+
+			spans := recorder.recorded()
+			span := spans[len(spans)-1]
+			if span.name != validateSpanName || span.parent != parent || !span.ended {
+				t.Fatalf("span %q (parent %v, ended %t), want an ended %q child of the request span",
+					span.name, span.parent, span.ended, validateSpanName)
+			}
+			if got := span.attrs["jwt.result"].AsString(); got != tt.wantResult {
+				t.Fatalf("jwt.result = %q, want %q", got, tt.wantResult)
+			}
+			match, ok := span.attrs["jwt.audience_match"]
+			if ok != tt.wantAudAttr || match.AsBool() != tt.wantAudience {
+				t.Fatalf("jwt.audience_match = %v (set: %t), want %t (set: %t)", match.AsBool(), ok, tt.wantAudience, tt.wantAudAttr)
+			}
+			if tt.wantAudAttr && span.attrs["jwt.issuer"].AsString() == "" {
+				t.Fatal("jwt.issuer not set")
+			}
+			if tt.wantErrStatus != (span.status == codes.Error) || tt.wantErrStatus != (len(span.errs) == 1) {
+				t.Fatalf("status = %v, recorded errors = %v; want error recorded: %t", span.status, span.errs, tt.wantErrStatus)
+			}
+		})
+	}
+}
+
+func TestWithBaggage(t *testing.T) {
+	const oid = "6c1b4c2e-9f4a-4d8e-b1a7-3e2f5d6c7b8a"
+
+	tests := []struct {
+		name string
+		opts []Option
+		want map[string]string
+	}{
+		{name: "enabled", opts: []Option{WithBaggage()}, want: map[string]string{baggageUserID: oid, baggageTenantID: testTenantID}},
+		{name: "disabled", want: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, keySet := newTestValidator(t, tt.opts...)
+
+			var bag baggage.Baggage
+			handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				bag = baggage.FromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+			if rec := serve(handler, testToken(keySet, withClaim("oid", oid))); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			if bag.Len() != len(tt.want) {
+				t.Fatalf("baggage = %s, want %v", bag, tt.want)
+			}
+			for key, value := range tt.want {
+				if got := bag.Member(key).Value(); got != value {
+					t.Errorf("baggage %s = %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}